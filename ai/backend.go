@@ -0,0 +1,200 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	BackendOpenAI   = "openai"
+	BackendOllama   = "ollama"
+	BackendLlamaCPP = "llamacpp"
+
+	dfltBackendTimeoutSecs = 120
+	retryDelay             = 500 * time.Millisecond
+)
+
+var (
+	ErrUnknownBackend = errors.New("unknown LLM backend")
+	ErrNoBackend      = errors.New("no LLM backend configured")
+)
+
+// BackendConf configures an LLM server with an OpenAI-compatible API
+type BackendConf struct {
+	Name string `json:"name"`
+
+	// Type is one of "openai", "ollama" and "llamacpp". It only affects
+	// the default URL.
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	APIKey    string `json:"apiKey"`
+	ModelName string `json:"modelName"`
+
+	// TimeoutSecs limits a single request to the server
+	// (in case of streaming, including reading of the whole response)
+	TimeoutSecs int `json:"timeoutSecs"`
+
+	// MaxRetries specifies how many times a failed request is repeated
+	// before the next backend is tried. Only server errors (5xx, 429) and
+	// network errors are retried.
+	MaxRetries int `json:"maxRetries"`
+}
+
+func (conf *BackendConf) validateAndDefaults() error {
+	switch conf.Type {
+	case "":
+		conf.Type = BackendOpenAI
+	case BackendOpenAI, BackendOllama, BackendLlamaCPP:
+	default:
+		return fmt.Errorf("unsupported backend type %s", conf.Type)
+	}
+	if conf.URL == "" {
+		switch conf.Type {
+		case BackendOllama:
+			conf.URL = "http://localhost:11434/v1"
+		case BackendLlamaCPP:
+			conf.URL = "http://localhost:8080/v1"
+		default:
+			conf.URL = openai.DefaultConfig("").BaseURL
+		}
+	}
+	// llama.cpp server provides a single model so its name is not needed
+	if conf.ModelName == "" && conf.Type != BackendLlamaCPP {
+		return fmt.Errorf("missing modelName")
+	}
+	if conf.TimeoutSecs < 0 || conf.MaxRetries < 0 {
+		return fmt.Errorf("negative timeoutSecs or maxRetries")
+	}
+	if conf.TimeoutSecs == 0 {
+		conf.TimeoutSecs = dfltBackendTimeoutSecs
+	}
+	return nil
+}
+
+// BackendInfo is a public description of a configured backend
+type BackendInfo struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	ModelName string `json:"modelName"`
+}
+
+// backend is a configured LLM server along with its (reused) client
+type backend struct {
+	conf   BackendConf
+	client *openai.Client
+}
+
+func newBackend(conf BackendConf) *backend {
+	config := openai.DefaultConfig(conf.APIKey)
+	config.BaseURL = conf.URL
+	config.HTTPClient = &http.Client{Timeout: time.Duration(conf.TimeoutSecs) * time.Second}
+	return &backend{
+		conf:   conf,
+		client: openai.NewClientWithConfig(config),
+	}
+}
+
+// complete obtains a model response, repeating failed requests
+// up to conf.MaxRetries times
+func (b *backend) complete(
+	ctx context.Context,
+	req openai.ChatCompletionRequest,
+	onEvent func(TranslationEvent),
+) (openai.ChatCompletionMessage, error) {
+	req.Model = b.conf.ModelName
+	for attempt := 0; ; attempt++ {
+		msg, err := complete(ctx, b.client, req, onEvent)
+		if err == nil {
+			return msg, nil
+		}
+		if ctx.Err() != nil || !isRetryable(err) || attempt >= b.conf.MaxRetries {
+			return msg, err
+		}
+		log.Warn().
+			Err(err).
+			Str("backend", b.conf.Name).
+			Int("attempt", attempt+1).
+			Msg("LLM request failed, retrying")
+		select {
+		case <-ctx.Done():
+			return msg, ctx.Err()
+		case <-time.After(time.Duration(attempt+1) * retryDelay):
+		}
+	}
+}
+
+// isRetryable tells whether a failed request may succeed when repeated
+func isRetryable(err error) bool {
+	status := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	if errors.As(err, &apiErr) {
+		status = apiErr.HTTPStatusCode
+
+	} else if errors.As(err, &reqErr) {
+		status = reqErr.HTTPStatusCode
+	}
+	return status == 0 || status >= 500 || status == http.StatusTooManyRequests
+}
+
+// backendOrder returns backends in the order they should be tried -
+// the preferred one (if specified) first, then the rest in the configured order
+func (ct *CQLTranslator) backendOrder(preferred string) ([]*backend, error) {
+	if len(ct.backends) == 0 {
+		return nil, ErrNoBackend
+	}
+	if preferred == "" {
+		return ct.backends, nil
+	}
+	ans := make([]*backend, 0, len(ct.backends))
+	for _, b := range ct.backends {
+		if b.conf.Name == preferred {
+			ans = append(ans, b)
+		}
+	}
+	if len(ans) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, preferred)
+	}
+	for _, b := range ct.backends {
+		if b.conf.Name != preferred {
+			ans = append(ans, b)
+		}
+	}
+	return ans, nil
+}
+
+// completeWithFallback tries the backends one by one until one of them
+// provides a response. Besides the response, the number of failed backends
+// is returned so the caller can skip them in subsequent requests.
+func completeWithFallback(
+	ctx context.Context,
+	backends []*backend,
+	req openai.ChatCompletionRequest,
+	onEvent func(TranslationEvent),
+) (openai.ChatCompletionMessage, int, error) {
+	var lastErr error
+	for i, b := range backends {
+		msg, err := b.complete(ctx, req, onEvent)
+		if err == nil {
+			return msg, i, nil
+		}
+		if ctx.Err() != nil {
+			return msg, i, err
+		}
+		lastErr = fmt.Errorf("backend %s: %w", b.conf.Name, err)
+		if i < len(backends)-1 {
+			log.Warn().
+				Err(err).
+				Str("backend", b.conf.Name).
+				Str("fallback", backends[i+1].conf.Name).
+				Msg("LLM backend failed, trying another one")
+		}
+	}
+	return openai.ChatCompletionMessage{}, len(backends), lastErr
+}
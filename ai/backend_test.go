@@ -0,0 +1,122 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/czcorpus/cqlizer/ai/prompts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFailingLLM(t *testing.T, status int) (*httptest.Server, *atomic.Int32) {
+	var numCalls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numCalls.Add(1)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error": {"message": "failed"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &numCalls
+}
+
+func TestTranslateFallsBackToNextBackend(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	failing, numCalls := newFailingLLM(t, http.StatusServiceUnavailable)
+	srv, _ := newFakeLLM(t, []string{"[word=\"dog\"]"})
+	backends := testBackends(failing.URL, srv.URL)
+	backends[0].MaxRetries = 1
+	ct, err := NewCQLTRanslator(backends, "prompt", store, nil)
+	require.NoError(t, err)
+
+	res, err := ct.TranslateToCQL(t.Context(), "dog", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, `[word="dog"]`, res.Query)
+	assert.Equal(t, "backend1", res.Backend)
+	assert.Equal(t, int32(2), numCalls.Load())
+}
+
+func TestTranslateDoesNotRetryClientErrors(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	failing, numCalls := newFailingLLM(t, http.StatusUnauthorized)
+	backends := testBackends(failing.URL)
+	backends[0].MaxRetries = 3
+	ct, err := NewCQLTRanslator(backends, "prompt", store, nil)
+	require.NoError(t, err)
+
+	_, err = ct.TranslateToCQL(t.Context(), "dog", "", "")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), numCalls.Load())
+}
+
+func TestTranslateWithPreferredBackend(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	failing, numCalls := newFailingLLM(t, http.StatusInternalServerError)
+	srv, _ := newFakeLLM(t, []string{"[word=\"dog\"]"})
+	ct, err := NewCQLTRanslator(testBackends(failing.URL, srv.URL), "prompt", store, nil)
+	require.NoError(t, err)
+
+	res, err := ct.TranslateToCQL(t.Context(), "dog", "", "backend1")
+	require.NoError(t, err)
+	assert.Equal(t, "backend1", res.Backend)
+	assert.Equal(t, int32(0), numCalls.Load())
+
+	_, err = ct.TranslateToCQL(t.Context(), "dog", "", "missing")
+	assert.ErrorIs(t, err, ErrUnknownBackend)
+}
+
+func TestTranslateWithoutBackends(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	ct, err := NewCQLTRanslator(nil, "prompt", store, nil)
+	require.NoError(t, err)
+	_, err = ct.TranslateToCQL(t.Context(), "dog", "", "")
+	assert.ErrorIs(t, err, ErrNoBackend)
+}
+
+func TestConfValidateLegacyBackend(t *testing.T) {
+	conf := Conf{APIURL: "http://localhost:1234/v1", ModelName: "llama"}
+	require.NoError(t, conf.Validate())
+	require.Len(t, conf.Backends, 1)
+	assert.Equal(t, "default", conf.Backends[0].Name)
+	assert.Equal(t, BackendOpenAI, conf.Backends[0].Type)
+	assert.Equal(t, "http://localhost:1234/v1", conf.Backends[0].URL)
+	assert.Equal(t, dfltBackendTimeoutSecs, conf.Backends[0].TimeoutSecs)
+}
+
+func TestConfValidateBackends(t *testing.T) {
+	conf := Conf{Backends: []BackendConf{
+		{Name: "local", Type: BackendOllama, ModelName: "qwen3"},
+		{Name: "cpp", Type: BackendLlamaCPP},
+	}}
+	require.NoError(t, conf.Validate())
+	assert.Equal(t, "http://localhost:11434/v1", conf.Backends[0].URL)
+	assert.Equal(t, "http://localhost:8080/v1", conf.Backends[1].URL)
+
+	conf = Conf{Backends: []BackendConf{{Name: "a", ModelName: "x"}, {Name: "a", ModelName: "y"}}}
+	assert.Error(t, conf.Validate())
+	conf = Conf{Backends: []BackendConf{{Name: "a", Type: "foo", ModelName: "x"}}}
+	assert.Error(t, conf.Validate())
+	conf = Conf{Backends: []BackendConf{{Name: "a", Type: BackendOllama}}}
+	assert.Error(t, conf.Validate())
+}
@@ -1,9 +1,73 @@
 package ai
 
+import "fmt"
+
+const dfltNumExamples = 3
+
 type Conf struct {
 	SystemPromptFile       string `json:"systemPromptFile"`
 	CustomSystemPromptsDir string `json:"customSystemPromptsDir"`
-	APIURL                 string `json:"apiUrl"`
-	ModelName              string `json:"modelName"`
-	CorporaRegistryDir     string `json:"corporaRegistryDir"`
+
+	// APIURL and ModelName define a single backend named "default"
+	// in case Backends are not configured (legacy configuration)
+	APIURL    string `json:"apiUrl"`
+	ModelName string `json:"modelName"`
+
+	// Backends are LLM servers used for translation. Unless a request
+	// chooses a backend, they are tried in the configured order.
+	Backends []BackendConf `json:"backends"`
+
+	CorporaRegistryDir string `json:"corporaRegistryDir"`
+
+	// PreloadRegistries makes the server parse all the registry
+	// files at startup (otherwise they are loaded on demand)
+	PreloadRegistries bool `json:"preloadRegistries"`
+
+	// ExamplesPath is a JSON file with few-shot examples
+	// (if empty, examples are not used)
+	ExamplesPath string `json:"examplesPath"`
+
+	// NumExamples is the max. number of examples provided to the model
+	NumExamples int `json:"numExamples"`
+
+	// MaxRevisions specifies how many times the model is asked to fix
+	// a generated query which is invalid or predicted to be slow
+	// (0 = the query is only checked)
+	MaxRevisions int `json:"maxRevisions"`
+
+	// RejectSlowQueries makes the API respond with an error status
+	// in case the final query is still invalid or slow
+	RejectSlowQueries bool `json:"rejectSlowQueries"`
+}
+
+func (conf *Conf) Validate() error {
+	if conf.NumExamples < 0 {
+		return fmt.Errorf("invalid numExamples %d", conf.NumExamples)
+	}
+	if conf.MaxRevisions < 0 {
+		return fmt.Errorf("invalid maxRevisions %d", conf.MaxRevisions)
+	}
+	if conf.ExamplesPath != "" && conf.NumExamples == 0 {
+		conf.NumExamples = dfltNumExamples
+	}
+	if len(conf.Backends) == 0 && conf.APIURL != "" {
+		conf.Backends = []BackendConf{
+			{Name: "default", URL: conf.APIURL, ModelName: conf.ModelName},
+		}
+	}
+	names := make(map[string]bool)
+	for i := range conf.Backends {
+		b := &conf.Backends[i]
+		if b.Name == "" {
+			return fmt.Errorf("missing name of the backend %d", i)
+		}
+		if names[b.Name] {
+			return fmt.Errorf("duplicate backend name %s", b.Name)
+		}
+		names[b.Name] = true
+		if err := b.validateAndDefaults(); err != nil {
+			return fmt.Errorf("invalid backend %s: %w", b.Name, err)
+		}
+	}
+	return nil
 }
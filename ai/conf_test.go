@@ -0,0 +1,35 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfValidate(t *testing.T) {
+	conf := Conf{ExamplesPath: "examples.json"}
+	assert.NoError(t, conf.Validate())
+	assert.Equal(t, dfltNumExamples, conf.NumExamples)
+
+	conf = Conf{NumExamples: -1}
+	assert.Error(t, conf.Validate())
+
+	conf = Conf{MaxRevisions: -1}
+	assert.Error(t, conf.Validate())
+}
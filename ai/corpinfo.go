@@ -1,34 +1,166 @@
 package ai
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/czcorpus/rexplorer/parser"
+	"github.com/rs/zerolog/log"
 )
 
+var ErrCorpusNotFound = errors.New("corpus not found")
+
+var ErrNoRegistryDir = errors.New("registry directory not configured")
+
+// cachedRegistry is a parsed registry file along with
+// properties of the file used to detect its changes
+type cachedRegistry struct {
+	doc      *parser.Document
+	modTime  time.Time
+	fileSize int64
+}
+
+// CorpusInfo is an overview of a corpus based on its registry file
+type CorpusInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	Lang string `json:"lang,omitempty"`
+
+	// Size is taken from a SIZE entry of the registry. Such an entry
+	// is not a standard Manatee one so typically, the size is unknown (0).
+	Size int `json:"size"`
+}
+
+// CorpInfoProvider provides parsed registry files. Parsed files are cached
+// and reloaded once their modification time (or size) changes. The provider
+// is safe for concurrent use.
 type CorpInfoProvider struct {
 	registryDirPath string
-	regCache        map[string]*parser.Document
+	regCache        map[string]cachedRegistry
+	mu              sync.RWMutex
+}
+
+func validCorpname(corpname string) bool {
+	return corpname != "" && !strings.ContainsAny(corpname, "/\\") && !strings.HasPrefix(corpname, ".")
+}
+
+func (cp *CorpInfoProvider) evict(corpname string) {
+	cp.mu.Lock()
+	delete(cp.regCache, corpname)
+	cp.mu.Unlock()
 }
 
 func (cp *CorpInfoProvider) GetRegistry(corpname string) (*parser.Document, error) {
+	if !validCorpname(corpname) {
+		return nil, fmt.Errorf("%w: invalid corpus name %s", ErrCorpusNotFound, corpname)
+	}
+	path := filepath.Join(cp.registryDirPath, corpname)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) || err == nil && info.IsDir() {
+		cp.evict(corpname)
+		return nil, fmt.Errorf("%w: %s", ErrCorpusNotFound, corpname)
+
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read registry file for %s: %w", corpname, err)
+	}
+	cp.mu.RLock()
 	curr, ok := cp.regCache[corpname]
-	if ok {
-		return curr, nil
+	cp.mu.RUnlock()
+	if ok && curr.modTime.Equal(info.ModTime()) && curr.fileSize == info.Size() {
+		return curr.doc, nil
 	}
-	data, err := os.ReadFile(filepath.Join(cp.registryDirPath, corpname))
-	if err != nil {
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		cp.evict(corpname)
+		return nil, fmt.Errorf("%w: %s", ErrCorpusNotFound, corpname)
+
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to read registry file for %s: %w", corpname, err)
 	}
 	doc, err := parser.ParseRegistryBytes(corpname, data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse registry file for %s: %w", corpname, err)
 	}
+	cp.mu.Lock()
+	cp.regCache[corpname] = cachedRegistry{doc: doc, modTime: info.ModTime(), fileSize: info.Size()}
+	cp.mu.Unlock()
+	if ok {
+		log.Info().Str("corpus", corpname).Msg("registry file changed, reloaded")
+	}
 	return doc, nil
 }
 
+// listRegistryFiles returns names of all the (possible) registry files
+func (cp *CorpInfoProvider) listRegistryFiles() ([]string, error) {
+	if cp.registryDirPath == "" {
+		return nil, ErrNoRegistryDir
+	}
+	entries, err := os.ReadDir(cp.registryDirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry directory: %w", err)
+	}
+	ans := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && validCorpname(entry.Name()) {
+			ans = append(ans, entry.Name())
+		}
+	}
+	return ans, nil
+}
+
+// Preload parses all the registry files so requests do not have to wait
+// for them. Files which cannot be parsed are skipped. The number
+// of loaded registries is returned.
+func (cp *CorpInfoProvider) Preload() (int, error) {
+	files, err := cp.listRegistryFiles()
+	if err != nil {
+		return 0, err
+	}
+	var ans int
+	for _, corpname := range files {
+		if _, err := cp.GetRegistry(corpname); err != nil {
+			log.Warn().Err(err).Str("corpus", corpname).Msg("skipping invalid registry file")
+			continue
+		}
+		ans++
+	}
+	return ans, nil
+}
+
+// ListCorpora provides an overview of all the corpora with
+// a valid registry file (ordered by their IDs)
+func (cp *CorpInfoProvider) ListCorpora() ([]CorpusInfo, error) {
+	files, err := cp.listRegistryFiles()
+	if err != nil {
+		return nil, err
+	}
+	ans := make([]CorpusInfo, 0, len(files))
+	for _, corpname := range files {
+		reg, err := cp.GetRegistry(corpname)
+		if err != nil {
+			log.Debug().Err(err).Str("corpus", corpname).Msg("skipping invalid registry file")
+			continue
+		}
+		size, _ := strconv.Atoi(reg.Entries.Get("SIZE").Value())
+		ans = append(ans, CorpusInfo{
+			ID:   corpname,
+			Name: reg.Entries.Get("NAME").Value(),
+			Lang: reg.Entries.Get("LANGUAGE").Value(),
+			Size: size,
+		})
+	}
+	sort.Slice(ans, func(i, j int) bool { return ans[i].ID < ans[j].ID })
+	return ans, nil
+}
+
 func (cp *CorpInfoProvider) GetAttributes(corpname string) ([]string, error) {
 	reg, err := cp.GetRegistry(corpname)
 	if err != nil {
@@ -41,9 +173,139 @@ func (cp *CorpInfoProvider) GetAttributes(corpname string) ([]string, error) {
 	return ans, nil
 }
 
+// GetStructures returns names of all the corpus structures
+func (cp *CorpInfoProvider) GetStructures(corpname string) ([]string, error) {
+	reg, err := cp.GetRegistry(corpname)
+	if err != nil {
+		return []string{}, err
+	}
+	ans := make([]string, len(reg.Structures))
+	for i, v := range reg.Structures {
+		ans[i] = v.Name
+	}
+	return ans, nil
+}
+
+// GetStructAttrs returns names of all the attributes of a structure
+func (cp *CorpInfoProvider) GetStructAttrs(corpname, structure string) ([]string, error) {
+	reg, err := cp.GetRegistry(corpname)
+	if err != nil {
+		return []string{}, err
+	}
+	st := reg.GetStructure(structure)
+	if st == nil {
+		return []string{}, fmt.Errorf("structure %s not found in %s", structure, corpname)
+	}
+	ans := make([]string, len(st.Attrs))
+	for i, v := range st.Attrs {
+		ans[i] = v.Name
+	}
+	return ans, nil
+}
+
+// DescribeAttribute provides registry properties of a positional attribute
+// (e.g. "tag") or a structural attribute (e.g. "doc.genre"). For known
+// tagsets, a description of the tag format is attached.
+func (cp *CorpInfoProvider) DescribeAttribute(corpname, attrName string) (string, error) {
+	reg, err := cp.GetRegistry(corpname)
+	if err != nil {
+		return "", err
+	}
+	var attr *parser.Attr
+	var ans strings.Builder
+	if stName, stAttrName, ok := strings.Cut(attrName, "."); ok {
+		st := reg.GetStructure(stName)
+		if st == nil {
+			return "", fmt.Errorf("structure %s not found in %s", stName, corpname)
+		}
+		attr = st.GetAttribute(stAttrName)
+		if attr == nil {
+			return "", fmt.Errorf("structural attribute %s not found in %s", attrName, corpname)
+		}
+		fmt.Fprintf(&ans, "structural attribute %s\n", attrName)
+
+	} else {
+		attr = reg.GetPosAttr(attrName)
+		if attr == nil {
+			return "", fmt.Errorf("positional attribute %s not found in %s", attrName, corpname)
+		}
+		fmt.Fprintf(&ans, "positional attribute %s\n", attrName)
+	}
+	for _, entry := range attr.Entries {
+		fmt.Fprintf(&ans, "%s: %s\n", entry.Name, entry.Value)
+	}
+	if attr.Entries.Get("TAGSETDOC").IsEmpty() && attrName == "tag" {
+		if tagsetDoc := reg.Entries.Get("TAGSETDOC").Value(); tagsetDoc != "" {
+			fmt.Fprintf(&ans, "TAGSETDOC: %s\n", tagsetDoc)
+		}
+	}
+	if tagset := findTagset(reg, attrName); tagset != "" {
+		ans.WriteString("\n" + tagset)
+	}
+	return ans.String(), nil
+}
+
+// DescribeCorpus creates a textual description of the corpus' positional
+// attributes, structures and structural attributes suitable for an LLM context
+func (cp *CorpInfoProvider) DescribeCorpus(corpname string) (string, error) {
+	reg, err := cp.GetRegistry(corpname)
+	if err != nil {
+		return "", err
+	}
+	return describeCorpus(corpname, reg), nil
+}
+
+func describeCorpus(corpname string, reg *parser.Document) string {
+	var ans strings.Builder
+	fmt.Fprintf(&ans, "The query is intended for the corpus %s", corpname)
+	if name := reg.Entries.Get("NAME").Value(); name != "" {
+		fmt.Fprintf(&ans, " (%s)", name)
+	}
+	if lang := reg.Entries.Get("LANGUAGE").Value(); lang != "" {
+		fmt.Fprintf(&ans, ", language: %s", lang)
+	}
+	ans.WriteString(".\n\nPositional attributes (usable as [attr=\"...\"]):\n")
+	for _, attr := range reg.PosAttrs {
+		ans.WriteString("- " + describeAttr(attr) + "\n")
+	}
+	if tagsetDoc := reg.Entries.Get("TAGSETDOC").Value(); tagsetDoc != "" {
+		fmt.Fprintf(&ans, "\nTagset documentation: %s\n", tagsetDoc)
+	}
+	if len(reg.Structures) > 0 {
+		ans.WriteString("\nStructures and their attributes (usable as within <struct attr=\"...\"/>):\n")
+		for _, st := range reg.Structures {
+			ans.WriteString("- " + st.Name)
+			if len(st.Attrs) > 0 {
+				attrs := make([]string, len(st.Attrs))
+				for i, attr := range st.Attrs {
+					attrs[i] = describeAttr(attr)
+				}
+				ans.WriteString(": " + strings.Join(attrs, ", "))
+			}
+			ans.WriteString("\n")
+		}
+	}
+	ans.WriteString("\nUse only the attributes and structures listed above.")
+	return ans.String()
+}
+
+func describeAttr(attr *parser.Attr) string {
+	props := make([]string, 0, 2)
+	if label := attr.Entries.Get("LABEL").Value(); label != "" {
+		props = append(props, label)
+	}
+	if tagsetDoc := attr.Entries.Get("TAGSETDOC").Value(); tagsetDoc != "" {
+		props = append(props, "tagset: "+tagsetDoc)
+	}
+	if len(props) == 0 {
+		return attr.Name
+	}
+	return fmt.Sprintf("%s (%s)", attr.Name, strings.Join(props, "; "))
+}
+
 func NewCorpInfoProvider(registryPath string) *CorpInfoProvider {
 	return &CorpInfoProvider{
 		registryDirPath: registryPath,
-		regCache:        make(map[string]*parser.Document),
+		regCache:        make(map[string]cachedRegistry),
 	}
 }
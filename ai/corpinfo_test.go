@@ -0,0 +1,146 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRegistry = `NAME "Test corpus"
+LANGUAGE "English"
+TAGSETDOC "https://example.org/tagset"
+
+ATTRIBUTE word
+ATTRIBUTE lemma {
+	LABEL "base form"
+}
+ATTRIBUTE tag
+
+STRUCTURE doc {
+	ATTRIBUTE genre
+	ATTRIBUTE year
+}
+
+STRUCTURE s {
+	TYPE "file64"
+}
+`
+
+// newTestCorpInfoProvider creates a provider with a single corpus "testcorp"
+func newTestCorpInfoProvider(t *testing.T) *CorpInfoProvider {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "testcorp"), []byte(testRegistry), 0644))
+	return NewCorpInfoProvider(dir)
+}
+
+func TestGetRegistryNotFound(t *testing.T) {
+	cp := newTestCorpInfoProvider(t)
+	_, err := cp.GetRegistry("missing")
+	assert.ErrorIs(t, err, ErrCorpusNotFound)
+	_, err = cp.GetRegistry("../testcorp")
+	assert.ErrorIs(t, err, ErrCorpusNotFound)
+}
+
+func TestDescribeCorpus(t *testing.T) {
+	cp := newTestCorpInfoProvider(t)
+	desc, err := cp.DescribeCorpus("testcorp")
+	require.NoError(t, err)
+	assert.Contains(t, desc, "testcorp (Test corpus), language: English")
+	assert.Contains(t, desc, "- lemma (base form)\n")
+	assert.Contains(t, desc, "- tag\n")
+	assert.Contains(t, desc, "Tagset documentation: https://example.org/tagset")
+	assert.Contains(t, desc, "- doc: genre, year\n")
+	assert.Contains(t, desc, "- s\n")
+}
+
+func TestGetRegistryCached(t *testing.T) {
+	cp := newTestCorpInfoProvider(t)
+	reg1, err := cp.GetRegistry("testcorp")
+	require.NoError(t, err)
+	reg2, err := cp.GetRegistry("testcorp")
+	require.NoError(t, err)
+	assert.Same(t, reg1, reg2)
+}
+
+func TestGetRegistryReloadsChangedFile(t *testing.T) {
+	cp := newTestCorpInfoProvider(t)
+	reg1, err := cp.GetRegistry("testcorp")
+	require.NoError(t, err)
+	assert.Equal(t, "English", reg1.Entries.Get("LANGUAGE").Value())
+
+	path := filepath.Join(cp.registryDirPath, "testcorp")
+	updated := strings.Replace(testRegistry, `"English"`, `"Czech"`, 1)
+	require.NoError(t, os.WriteFile(path, []byte(updated), 0644))
+	mtime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+
+	reg2, err := cp.GetRegistry("testcorp")
+	require.NoError(t, err)
+	assert.Equal(t, "Czech", reg2.Entries.Get("LANGUAGE").Value())
+
+	require.NoError(t, os.Remove(path))
+	_, err = cp.GetRegistry("testcorp")
+	assert.ErrorIs(t, err, ErrCorpusNotFound)
+}
+
+func TestGetRegistryConcurrent(t *testing.T) {
+	cp := newTestCorpInfoProvider(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cp.GetRegistry("testcorp")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPreloadAndListCorpora(t *testing.T) {
+	cp := newTestCorpInfoProvider(t)
+	dir := cp.registryDirPath
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "other"), []byte("NAME \"Other\"\nLANGUAGE \"Czech\"\nSIZE \"1200\"\nATTRIBUTE word\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte(testRegistry), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0755))
+
+	n, err := cp.Preload()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	corpora, err := cp.ListCorpora()
+	require.NoError(t, err)
+	assert.Equal(t, []CorpusInfo{
+		{ID: "other", Name: "Other", Lang: "Czech", Size: 1200},
+		{ID: "testcorp", Name: "Test corpus", Lang: "English"},
+	}, corpora)
+}
+
+func TestListCorporaNoRegistryDir(t *testing.T) {
+	cp := NewCorpInfoProvider("")
+	_, err := cp.ListCorpora()
+	assert.ErrorIs(t, err, ErrNoRegistryDir)
+}
@@ -0,0 +1,166 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/czcorpus/cqlizer/cql"
+	"github.com/czcorpus/rexplorer/parser"
+	"github.com/rs/zerolog/log"
+)
+
+// CostEstimate is a prediction of how expensive a query is
+// to evaluate in a corpus
+type CostEstimate struct {
+	Corpname     string `json:"corpname,omitempty"`
+	CorpusSize   int    `json:"corpusSize"`
+	IsSlow       bool   `json:"isSlow"`
+	VotesFor     int    `json:"votesFor"`
+	VotesAgainst int    `json:"votesAgainst"`
+}
+
+func (ce CostEstimate) String() string {
+	verdict := "fast"
+	if ce.IsSlow {
+		verdict = "slow"
+	}
+	corp := ce.Corpname
+	if corp == "" {
+		corp = fmt.Sprintf("a corpus of %d tokens", ce.CorpusSize)
+	}
+	return fmt.Sprintf(
+		"%s (slow votes: %d, fast votes: %d) in %s",
+		verdict, ce.VotesFor, ce.VotesAgainst, corp,
+	)
+}
+
+// CostEstimator predicts whether a query is slow. An empty corpname
+// means a default (large) corpus.
+type CostEstimator interface {
+	EstimateQueryCost(query, corpname string) (CostEstimate, error)
+}
+
+// Revision is a query proposed by the model along with
+// its syntax check and cost estimation
+type Revision struct {
+	Query       string `json:"query"`
+	SyntaxError string `json:"syntaxError,omitempty"`
+
+	// Issues lists attributes and structures not defined
+	// in the target corpus
+	Issues []ValidationIssue `json:"issues,omitempty"`
+
+	// Estimate is nil in case the cost could not be estimated
+	Estimate *CostEstimate `json:"estimate,omitempty"`
+}
+
+func (rev Revision) needsRevision() bool {
+	return rev.SyntaxError != "" || len(rev.Issues) > 0 || rev.Estimate != nil && rev.Estimate.IsSlow
+}
+
+// revisionRequest creates a message asking the model to fix
+// the revision's problem
+func (rev Revision) revisionRequest() string {
+	if rev.SyntaxError != "" {
+		return fmt.Sprintf(
+			"The query %s is not valid CQL: %s. Please fix it and respond with the query only.",
+			rev.Query, rev.SyntaxError,
+		)
+	}
+	if len(rev.Issues) > 0 {
+		issues := make([]string, len(rev.Issues))
+		for i, v := range rev.Issues {
+			issues[i] = v.String()
+		}
+		return fmt.Sprintf(
+			"The query %s uses items not defined in the corpus: %s. Please fix it using only "+
+				"the available attributes and structures and respond with the query only.",
+			rev.Query, strings.Join(issues, "; "),
+		)
+	}
+	return fmt.Sprintf(
+		"The query %s is predicted to be slow: %s. Please revise it to be more specific "+
+			"(e.g. avoid leading wildcards, very general regular expressions and unrestricted "+
+			"repetitions like []*) while keeping its meaning. Respond with the query only.",
+		rev.Query, rev.Estimate,
+	)
+}
+
+// TranslationResult is a final CQL query along with all the queries
+// the model has proposed before.
+type TranslationResult struct {
+	Query string `json:"query"`
+
+	// IsSlow is nil in case the cost of the query could not be estimated
+	IsSlow   *bool         `json:"isSlow"`
+	Estimate *CostEstimate `json:"estimate,omitempty"`
+
+	// Rejected means the final query is still invalid or slow
+	// even after all the allowed revisions
+	Rejected  bool       `json:"rejected"`
+	Revisions []Revision `json:"revisions"`
+
+	// Backend is the name of the LLM backend which provided the final answer
+	Backend string `json:"backend"`
+
+	// Examples contains IDs of stored examples provided to the model
+	Examples []int `json:"examples,omitempty"`
+}
+
+func (tr *TranslationResult) setFinal(rev Revision) {
+	tr.Query = rev.Query
+	tr.Estimate = rev.Estimate
+	if rev.Estimate != nil {
+		isSlow := rev.Estimate.IsSlow
+		tr.IsSlow = &isSlow
+	}
+	tr.Rejected = rev.needsRevision()
+}
+
+// -----
+
+// checkQuery validates syntax of a query proposed by the model,
+// tests its attributes against the corpus registry (if provided) and
+// estimates its cost (if an estimator is available)
+func (ct *CQLTranslator) checkQuery(query, corpname string, reg *parser.Document) Revision {
+	ans := Revision{Query: query}
+	parsed, err := cql.ParseCQL("", query)
+	if err != nil {
+		ans.SyntaxError = err.Error()
+		return ans
+	}
+	if reg != nil {
+		ans.Issues = validateProps(reg, parsed)
+		if len(ans.Issues) > 0 {
+			return ans
+		}
+	}
+	if ct.costEstimator == nil {
+		return ans
+	}
+	est, err := ct.costEstimator.EstimateQueryCost(query, corpname)
+	if err != nil {
+		log.Warn().Err(err).Str("query", query).Msg("failed to estimate query cost")
+		return ans
+	}
+	ans.Estimate = &est
+	return ans
+}
+
+// extractQuery obtains a CQL query from the model's final answer.
+// Models tend to wrap queries in Markdown code blocks or backticks.
+func extractQuery(content string) string {
+	content = strings.TrimSpace(content)
+	if start := strings.Index(content, "```"); start >= 0 {
+		block := content[start+3:]
+		if end := strings.Index(block, "```"); end >= 0 {
+			block = block[:end]
+		}
+		// skip an optional language tag
+		if nl := strings.IndexByte(block, '\n'); nl >= 0 && !strings.ContainsAny(block[:nl], "[\"<") {
+			block = block[nl+1:]
+		}
+		content = strings.TrimSpace(block)
+	}
+	return strings.TrimSpace(strings.Trim(content, "`"))
+}
@@ -0,0 +1,38 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractQuery(t *testing.T) {
+	assert.Equal(t, `[lemma="dog"]`, extractQuery(`  [lemma="dog"]  `))
+	assert.Equal(t, `[lemma="dog"]`, extractQuery("`[lemma=\"dog\"]`"))
+	assert.Equal(t, `[lemma="dog"] [tag="N.*"]`, extractQuery("Here you are:\n```cql\n[lemma=\"dog\"] [tag=\"N.*\"]\n```\n"))
+	assert.Equal(t, `[word="a"]`, extractQuery("```\n[word=\"a\"]\n```"))
+	assert.Equal(t, `[word="a"]`, extractQuery("```[word=\"a\"]```"))
+}
+
+func TestRevisionNeedsRevision(t *testing.T) {
+	assert.False(t, Revision{Query: "[word=\"a\"]"}.needsRevision())
+	assert.True(t, Revision{Query: "[word=", SyntaxError: "err"}.needsRevision())
+	assert.True(t, Revision{Estimate: &CostEstimate{IsSlow: true}}.needsRevision())
+	assert.False(t, Revision{Estimate: &CostEstimate{IsSlow: false}}.needsRevision())
+}
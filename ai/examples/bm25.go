@@ -0,0 +1,97 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package examples
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// tokenize splits text into lowercase words
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	})
+}
+
+// bm25Index is an in-memory Okapi BM25 index of short documents.
+// It is immutable - any change of the documents requires a new index.
+type bm25Index struct {
+	// termFreqs contains term frequencies of individual documents
+	termFreqs []map[string]int
+	docLens   []int
+	avgDocLen float64
+
+	// docFreqs contains numbers of documents containing a term
+	docFreqs map[string]int
+}
+
+func newBM25Index(docs []string) *bm25Index {
+	ans := &bm25Index{
+		termFreqs: make([]map[string]int, len(docs)),
+		docLens:   make([]int, len(docs)),
+		docFreqs:  make(map[string]int),
+	}
+	var totalLen int
+	for i, doc := range docs {
+		tokens := tokenize(doc)
+		freqs := make(map[string]int, len(tokens))
+		for _, t := range tokens {
+			freqs[t]++
+		}
+		for t := range freqs {
+			ans.docFreqs[t]++
+		}
+		ans.termFreqs[i] = freqs
+		ans.docLens[i] = len(tokens)
+		totalLen += len(tokens)
+	}
+	if len(docs) > 0 {
+		ans.avgDocLen = float64(totalLen) / float64(len(docs))
+	}
+	return ans
+}
+
+// scores calculates BM25 scores of all the documents for the query
+func (idx *bm25Index) scores(query string) []float64 {
+	ans := make([]float64, len(idx.termFreqs))
+	if idx.avgDocLen == 0 {
+		return ans
+	}
+	numDocs := float64(len(idx.termFreqs))
+	for _, term := range tokenize(query) {
+		df, ok := idx.docFreqs[term]
+		if !ok {
+			continue
+		}
+		idf := math.Log(1 + (numDocs-float64(df)+0.5)/(float64(df)+0.5))
+		for i, freqs := range idx.termFreqs {
+			tf := float64(freqs[term])
+			if tf == 0 {
+				continue
+			}
+			norm := 1 - bm25B + bm25B*float64(idx.docLens[i])/idx.avgDocLen
+			ans[i] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	return ans
+}
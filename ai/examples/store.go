@@ -0,0 +1,190 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package examples provides a storage of (natural language, CQL) pairs
+// used as few-shot examples for the NL -> CQL translation. Examples similar
+// to a translated request are found using a BM25 index of the NL texts.
+package examples
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/cqlizer/cql"
+	"github.com/czcorpus/cqlizer/internal/fsutil"
+)
+
+var (
+	ErrInvalidExample = errors.New("invalid example")
+	ErrNotFound       = errors.New("example not found")
+)
+
+// Example is a natural language request along with its CQL translation
+type Example struct {
+	ID        int       `json:"id"`
+	Input     string    `json:"input"`
+	Query     string    `json:"query"`
+	Author    string    `json:"author,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Match is an example found for a request
+type Match struct {
+	Example
+	Score float64 `json:"score"`
+}
+
+// Store keeps examples in a single JSON file along with
+// an in-memory retrieval index
+type Store struct {
+	path     string
+	examples []Example
+	index    *bm25Index
+	nextID   int
+	mu       sync.RWMutex
+}
+
+// NewStore loads examples from the file (which does not have
+// to exist yet - it is created once an example is added)
+func NewStore(path string) (*Store, error) {
+	ans := &Store{path: path, nextID: 1}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &ans.examples); err != nil {
+			return nil, fmt.Errorf("failed to load examples: %w", err)
+		}
+
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load examples: %w", err)
+
+	} else if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create examples directory: %w", err)
+	}
+	for _, ex := range ans.examples {
+		ans.nextID = max(ans.nextID, ex.ID+1)
+	}
+	ans.reindex()
+	return ans, nil
+}
+
+func (s *Store) reindex() {
+	docs := make([]string, len(s.examples))
+	for i, ex := range s.examples {
+		docs[i] = ex.Input
+	}
+	s.index = newBM25Index(docs)
+}
+
+// save writes examples to the file; the caller must hold the write lock
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.examples, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to save examples: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to save examples: %w", err)
+	}
+	return nil
+}
+
+// Add stores a new example. The query must be a valid CQL.
+func (s *Store) Add(input, query, author, comment string) (Example, error) {
+	input = strings.TrimSpace(input)
+	query = strings.TrimSpace(query)
+	if input == "" || query == "" {
+		return Example{}, fmt.Errorf("%w: empty input or query", ErrInvalidExample)
+	}
+	if _, err := cql.ParseCQL("", query); err != nil {
+		return Example{}, fmt.Errorf("%w: %s", ErrInvalidExample, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ex := Example{
+		ID:        s.nextID,
+		Input:     input,
+		Query:     query,
+		Author:    author,
+		Comment:   comment,
+		CreatedAt: time.Now(),
+	}
+	s.examples = append(s.examples, ex)
+	if err := s.save(); err != nil {
+		s.examples = s.examples[:len(s.examples)-1]
+		return Example{}, err
+	}
+	s.nextID++
+	s.reindex()
+	return ex, nil
+}
+
+// Remove deletes an example
+func (s *Store) Remove(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := -1
+	for i, ex := range s.examples {
+		if ex.ID == id {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	orig := s.examples
+	s.examples = append(append(make([]Example, 0, len(orig)-1), orig[:idx]...), orig[idx+1:]...)
+	if err := s.save(); err != nil {
+		s.examples = orig
+		return err
+	}
+	s.reindex()
+	return nil
+}
+
+// List returns all the examples ordered by their IDs
+func (s *Store) List() []Example {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ans := make([]Example, len(s.examples))
+	copy(ans, s.examples)
+	return ans
+}
+
+// Search finds at most k examples most similar to the text.
+// Examples without any common word are not returned.
+func (s *Store) Search(text string, k int) []Match {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scores := s.index.scores(text)
+	ans := make([]Match, 0, len(scores))
+	for i, score := range scores {
+		if score > 0 {
+			ans = append(ans, Match{Example: s.examples[i], Score: score})
+		}
+	}
+	sort.SliceStable(ans, func(i, j int) bool { return ans[i].Score > ans[j].Score })
+	if len(ans) > k {
+		ans = ans[:k]
+	}
+	return ans
+}
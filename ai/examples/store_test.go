@@ -0,0 +1,105 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package examples
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) (*Store, string) {
+	path := filepath.Join(t.TempDir(), "data", "examples.json")
+	store, err := NewStore(path)
+	require.NoError(t, err)
+	return store, path
+}
+
+func TestAddAndReload(t *testing.T) {
+	store, path := newTestStore(t)
+	ex, err := store.Add(" all forms of the word dog ", `[lemma="dog"]`, "john", "basic lemma")
+	require.NoError(t, err)
+	assert.Equal(t, 1, ex.ID)
+	assert.Equal(t, "all forms of the word dog", ex.Input)
+	_, err = store.Add("dog followed by a verb", `[lemma="dog"][tag="V.*"]`, "", "")
+	require.NoError(t, err)
+
+	reloaded, err := NewStore(path)
+	require.NoError(t, err)
+	items := reloaded.List()
+	require.Len(t, items, 2)
+	assert.Equal(t, "john", items[0].Author)
+	ex, err = reloaded.Add("cats", `[lemma="cat"]`, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, ex.ID)
+}
+
+func TestAddInvalid(t *testing.T) {
+	store, _ := newTestStore(t)
+	_, err := store.Add("dog", `[lemma="dog"`, "", "")
+	assert.ErrorIs(t, err, ErrInvalidExample)
+	_, err = store.Add("", `[lemma="dog"]`, "", "")
+	assert.ErrorIs(t, err, ErrInvalidExample)
+	assert.Empty(t, store.List())
+}
+
+func TestRemove(t *testing.T) {
+	store, path := newTestStore(t)
+	_, err := store.Add("dog", `[lemma="dog"]`, "", "")
+	require.NoError(t, err)
+	_, err = store.Add("cat", `[lemma="cat"]`, "", "")
+	require.NoError(t, err)
+
+	require.NoError(t, store.Remove(1))
+	assert.ErrorIs(t, store.Remove(1), ErrNotFound)
+	assert.Empty(t, store.Search("dog", 3))
+
+	reloaded, err := NewStore(path)
+	require.NoError(t, err)
+	items := reloaded.List()
+	require.Len(t, items, 1)
+	assert.Equal(t, 2, items[0].ID)
+}
+
+func TestSearch(t *testing.T) {
+	store, _ := newTestStore(t)
+	for _, v := range [][2]string{
+		{"all forms of the word dog", `[lemma="dog"]`},
+		{"adjective followed by a noun", `[tag="A.*"][tag="N.*"]`},
+		{"the word house in a sentence with the word garden", `[lemma="house"] within <s/> containing [lemma="garden"]`},
+		{"nouns in genitive", `[tag="N...2.*"]`},
+	} {
+		_, err := store.Add(v[0], v[1], "", "")
+		require.NoError(t, err)
+	}
+	ans := store.Search("an adjective before the noun 'dog'", 2)
+	require.Len(t, ans, 2)
+	assert.Equal(t, 2, ans[0].ID)
+	assert.Greater(t, ans[0].Score, ans[1].Score)
+
+	ans = store.Search("lemma cat", 3)
+	assert.Empty(t, ans)
+
+	ans = store.Search("word", 5)
+	require.Len(t, ans, 2)
+	assert.ElementsMatch(t, []int{1, 3}, []int{ans[0].ID, ans[1].ID})
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"slovo", "pes", "v", "2", "pádě"}, tokenize("Slovo 'pes' v 2. pádě!"))
+}
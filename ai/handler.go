@@ -3,87 +3,184 @@ package ai
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 
-	"github.com/czcorpus/cqlizer/cql"
+	"github.com/czcorpus/cqlizer/ai/examples"
+	"github.com/czcorpus/cqlizer/ai/prompts"
+	"github.com/czcorpus/rexplorer/parser"
 	"github.com/sashabaranov/go-openai"
 )
 
 type CQLTranslator struct {
-	modelURL               string
-	systemPrompt           string
-	modelName              string
-	corpinfo               *CorpInfoProvider
-	customSystemPromptsDir string
-	tools                  []openai.Tool
+	// backends are LLM servers in the configured order
+	backends            []*backend
+	systemPrompt        string
+	defaultSystemPrompt string
+	corpinfo            *CorpInfoProvider
+	prompts             *prompts.Store
+	tools               []openai.Tool
+
+	// costEstimator is nil in case queries are not checked for their cost
+	costEstimator CostEstimator
+
+	// examples is nil in case few-shot examples are not used
+	examples    *examples.Store
+	numExamples int
+
+	// maxRevisions specifies how many times the model is asked to revise
+	// an invalid or slow query
+	maxRevisions int
+
+	// activePrompt is nil in case the default prompt is used
+	activePrompt *prompts.Active
+
+	// promptMu guards systemPrompt and activePrompt which
+	// can be changed at runtime
+	promptMu sync.RWMutex
 }
 
+var ErrNoPromptStore = errors.New("prompt store not configured")
+
+// NewCQLTRanslator creates a new translator using (already validated) backends.
+// In case the prompt store contains an active prompt, it is used instead
+// of the (default) systemPrompt. The promptStore can be nil in which case
+// only the default prompt is available.
 func NewCQLTRanslator(
-	modelURL string,
+	backends []BackendConf,
 	systemPrompt string,
-	customSystemPromptsDir string,
-	modelName string,
+	promptStore *prompts.Store,
 	corpusInfo *CorpInfoProvider,
-) *CQLTranslator {
-	tools := []openai.Tool{
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "validate_cql",
-				Description: "Checks if the CQL syntax is valid. Returns 'valid' or an error message describing the problem.",
-				Parameters: json.RawMessage(`{
-					"type": "object",
-					"properties": {
-						"query": {"type": "string", "description": "The CQL query to validate"}
-					},
-					"required": ["query"]
-				}`),
-			},
-		},
-		{
-			Type: openai.ToolTypeFunction,
-			Function: &openai.FunctionDefinition{
-				Name:        "get_token_attrs",
-				Description: "Provides a list of attributes applicable for token search (word, lemma, tag,...)",
-				Parameters: json.RawMessage(`{
-					"type": "object",
-					"properties": {
-						"corpname": {"type": "string", "description": "A corpus to get attributes for"}
-					},
-					"required": ["corpname"]
-				}`),
-			},
-		},
+) (*CQLTranslator, error) {
+	ans := &CQLTranslator{
+		backends:            make([]*backend, len(backends)),
+		systemPrompt:        systemPrompt,
+		defaultSystemPrompt: systemPrompt,
+		prompts:             promptStore,
+		corpinfo:            corpusInfo,
+		tools:               baseTools(),
+	}
+	for i, conf := range backends {
+		ans.backends[i] = newBackend(conf)
 	}
-	return &CQLTranslator{
-		modelURL:               modelURL,
-		systemPrompt:           systemPrompt,
-		customSystemPromptsDir: customSystemPromptsDir,
-		modelName:              modelName,
-		corpinfo:               corpusInfo,
-		tools:                  tools,
+	if promptStore == nil {
+		return ans, nil
+	}
+	active, activePrompt, err := promptStore.Active()
+	if err == nil {
+		ans.systemPrompt = activePrompt
+		ans.activePrompt = &active
+
+	} else if !errors.Is(err, prompts.ErrNotFound) {
+		return nil, err
 	}
+	return ans, nil
 }
 
-type validateCQLArgs struct {
-	Query string `json:"query"`
+// SetCostEstimator enables the estimate_query_cost tool and checking
+// of the final query's cost. Queries predicted to be slow (or invalid ones)
+// are sent back to the model for revision up to maxRevisions times.
+// The method is expected to be called before the translator is used.
+func (ct *CQLTranslator) SetCostEstimator(estimator CostEstimator, maxRevisions int) {
+	ct.costEstimator = estimator
+	ct.maxRevisions = maxRevisions
+	ct.tools = append(ct.tools, costEstimationTool())
 }
 
-type corpinfoArgs struct {
-	Corpname string `json:"corpname"`
+// SetExampleStore enables adding (at most numExamples) stored examples
+// similar to the translated request to the messages sent to the model.
+// The method is expected to be called before the translator is used.
+func (ct *CQLTranslator) SetExampleStore(store *examples.Store, numExamples int) {
+	ct.examples = store
+	ct.numExamples = numExamples
+}
+
+// Examples returns the example store (nil if not enabled)
+func (ct *CQLTranslator) Examples() *examples.Store {
+	return ct.examples
 }
 
 func (ct *CQLTranslator) GetSystemPrompt() string {
+	ct.promptMu.RLock()
+	defer ct.promptMu.RUnlock()
 	return ct.systemPrompt
 }
 
+// GetActivePrompt returns the activated prompt version.
+// In case the default prompt is used, false is returned.
+func (ct *CQLTranslator) GetActivePrompt() (prompts.Active, bool) {
+	ct.promptMu.RLock()
+	defer ct.promptMu.RUnlock()
+	if ct.activePrompt == nil {
+		return prompts.Active{}, false
+	}
+	return *ct.activePrompt, true
+}
+
+// ActivatePrompt switches the translator to a stored prompt version
+// (0 = latest). The choice is persisted in the prompt store.
+func (ct *CQLTranslator) ActivatePrompt(name string, version int, activatedBy string) (prompts.Active, error) {
+	if ct.prompts == nil {
+		return prompts.Active{}, ErrNoPromptStore
+	}
+	ct.promptMu.Lock()
+	defer ct.promptMu.Unlock()
+	active, err := ct.prompts.SetActive(name, version, activatedBy)
+	if err != nil {
+		return prompts.Active{}, err
+	}
+	content, _, err := ct.prompts.Get(active.Name, active.Version)
+	if err != nil {
+		return prompts.Active{}, err
+	}
+	ct.systemPrompt = content
+	ct.activePrompt = &active
+	return active, nil
+}
+
+// ResetPrompt switches the translator back to the default prompt
+func (ct *CQLTranslator) ResetPrompt() error {
+	if ct.prompts == nil {
+		return ErrNoPromptStore
+	}
+	ct.promptMu.Lock()
+	defer ct.promptMu.Unlock()
+	if err := ct.prompts.ClearActive(); err != nil {
+		return err
+	}
+	ct.systemPrompt = ct.defaultSystemPrompt
+	ct.activePrompt = nil
+	return nil
+}
+
+// GetModelName returns the model of the first configured backend
 func (ct *CQLTranslator) GetModelName() string {
-	return ct.modelName
+	if len(ct.backends) == 0 {
+		return ""
+	}
+	return ct.backends[0].conf.ModelName
 }
 
-func (ct *CQLTranslator) GetCustomSystemPromptsDir() string {
-	return ct.customSystemPromptsDir
+// Backends describes the configured backends in the order they are tried
+func (ct *CQLTranslator) Backends() []BackendInfo {
+	ans := make([]BackendInfo, len(ct.backends))
+	for i, b := range ct.backends {
+		ans[i] = BackendInfo{Name: b.conf.Name, Type: b.conf.Type, ModelName: b.conf.ModelName}
+	}
+	return ans
+}
+
+// GetDefaultSystemPrompt returns the prompt loaded from the configured
+// system prompt file
+func (ct *CQLTranslator) GetDefaultSystemPrompt() string {
+	return ct.defaultSystemPrompt
+}
+
+// Prompts returns the prompt store (nil if not configured)
+func (ct *CQLTranslator) Prompts() *prompts.Store {
+	return ct.prompts
 }
 
 func (ct *CQLTranslator) GetToolsJSON() (string, error) {
@@ -94,82 +191,129 @@ func (ct *CQLTranslator) GetToolsJSON() (string, error) {
 	return string(data), nil
 }
 
-func (ct *CQLTranslator) TranslateToCQLWithPrompt(ctx context.Context, userInput string, customPrompt string) (string, error) {
-	return ct.translateToCQLInternal(ctx, userInput, customPrompt)
+// TranslateToCQLWithPrompt translates userInput using a custom system prompt.
+// The corpname is optional - if specified, the corpus' attributes are provided
+// to the model and the resulting query is validated against them.
+// The backendName is also optional - if specified, the backend is tried first
+// and the other ones are used as fallbacks.
+func (ct *CQLTranslator) TranslateToCQLWithPrompt(
+	ctx context.Context,
+	userInput string,
+	corpname string,
+	customPrompt string,
+	backendName string,
+) (TranslationResult, error) {
+	return ct.translateToCQLInternal(ctx, userInput, corpname, customPrompt, backendName, nil)
 }
 
-func (ct *CQLTranslator) TranslateToCQL(ctx context.Context, userInput string) (string, error) {
-	return ct.translateToCQLInternal(ctx, userInput, ct.systemPrompt)
+// TranslateToCQL translates userInput using the active system prompt.
+// The corpname and backendName are optional (see TranslateToCQLWithPrompt).
+func (ct *CQLTranslator) TranslateToCQL(
+	ctx context.Context,
+	userInput string,
+	corpname string,
+	backendName string,
+) (TranslationResult, error) {
+	return ct.translateToCQLInternal(ctx, userInput, corpname, ct.GetSystemPrompt(), backendName, nil)
 }
 
-func (ct *CQLTranslator) translateToCQLInternal(ctx context.Context, userInput string, systemPrompt string) (string, error) {
-	config := openai.DefaultConfig("")
-	config.BaseURL = ct.modelURL
-	client := openai.NewClientWithConfig(config)
-
+func (ct *CQLTranslator) translateToCQLInternal(
+	ctx context.Context,
+	userInput string,
+	corpname string,
+	systemPrompt string,
+	backendName string,
+	onEvent func(TranslationEvent),
+) (TranslationResult, error) {
+	var ans TranslationResult
+	backends, err := ct.backendOrder(backendName)
+	if err != nil {
+		return ans, err
+	}
 	messages := []openai.ChatCompletionMessage{
 		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: userInput},
 	}
-
-	maxIterations := 5 // prevent infinite loops
-	for range maxIterations {
-		resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-			Model:       ct.modelName,
-			Messages:    messages,
-			Tools:       ct.tools,
-			Temperature: 0.1,
-		})
+	// targetCorpus is either the requested corpus or the last corpus the model asked about
+	targetCorpus := corpname
+	var reg *parser.Document
+	if corpname != "" {
+		reg, err = ct.corpinfo.GetRegistry(corpname)
 		if err != nil {
-			return "", fmt.Errorf("completion request failed: %w", err)
+			return ans, err
 		}
-
-		if len(resp.Choices) == 0 {
-			return "", fmt.Errorf("no choices in response")
+		messages = append(
+			messages,
+			openai.ChatCompletionMessage{Role: "system", Content: describeCorpus(corpname, reg)},
+		)
+	}
+	if ct.examples != nil && ct.numExamples > 0 {
+		if matches := ct.examples.Search(userInput, ct.numExamples); len(matches) > 0 {
+			messages = append(
+				messages,
+				openai.ChatCompletionMessage{Role: "system", Content: examplesMessage(matches)},
+			)
+			ans.Examples = make([]int, len(matches))
+			for i, m := range matches {
+				ans.Examples[i] = m.ID
+			}
 		}
+	}
+	messages = append(messages, openai.ChatCompletionMessage{Role: "user", Content: userInput})
 
-		msg := resp.Choices[0].Message
+	maxIterations := 5 // prevent infinite loops
+	for range maxIterations * (ct.maxRevisions + 1) {
+		msg, numFailed, err := completeWithFallback(
+			ctx,
+			backends,
+			openai.ChatCompletionRequest{
+				Messages:    messages,
+				Tools:       ct.tools,
+				Temperature: 0.1,
+			},
+			onEvent,
+		)
+		if err != nil {
+			return ans, err
+		}
+		// the failed backends are not used for the rest of the conversation
+		backends = backends[numFailed:]
+		ans.Backend = backends[0].conf.Name
 
 		if len(msg.ToolCalls) == 0 {
-			return msg.Content, nil
+			rev := ct.checkQuery(extractQuery(msg.Content), targetCorpus, reg)
+			ans.Revisions = append(ans.Revisions, rev)
+			if onEvent != nil {
+				onEvent(TranslationEvent{Type: EventRevision, Revision: &rev})
+			}
+			if !rev.needsRevision() || len(ans.Revisions) > ct.maxRevisions {
+				ans.setFinal(rev)
+				return ans, nil
+			}
+			messages = append(
+				messages,
+				msg,
+				openai.ChatCompletionMessage{Role: "user", Content: rev.revisionRequest()},
+			)
+			continue
 		}
 
 		messages = append(messages, msg)
 
 		for _, call := range msg.ToolCalls {
-			var result string
-
-			switch call.Function.Name {
-			case "validate_cql":
-				var args validateCQLArgs
-				if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
-					result = fmt.Sprintf("error parsing arguments: %v", err)
-
-				} else {
-					_, err := cql.ParseCQL("", args.Query)
-					if err != nil {
-						result = fmt.Sprintf("invalid: %v", err)
-
-					} else {
-						result = "valid"
-					}
-				}
-			case "get_token_attrs":
-				var args corpinfoArgs
-				if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
-					result = fmt.Sprintf("error parsing arguments: %v", err)
-
-				} else {
-					tmp, err := ct.corpinfo.GetAttributes(args.Corpname)
-					if err != nil {
-						result = fmt.Sprintf("failed to get supported attributes: %s", err)
-					}
-					result = strings.Join(tmp, ", ")
-				}
-			default:
-				result = fmt.Sprintf("unknown tool: %s", call.Function.Name)
+			if onEvent != nil {
+				onEvent(TranslationEvent{
+					Type:      EventToolCall,
+					Tool:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				})
+			}
+			result, toolCorpname := ct.runTool(call.Function.Name, call.Function.Arguments)
+			if onEvent != nil {
+				onEvent(TranslationEvent{Type: EventToolResult, Tool: call.Function.Name, Result: result})
+			}
+			if corpname == "" && toolCorpname != "" {
+				targetCorpus = toolCorpname
 			}
-
 			messages = append(messages, openai.ChatCompletionMessage{
 				Role:       "tool",
 				Content:    result,
@@ -178,5 +322,15 @@ func (ct *CQLTranslator) translateToCQLInternal(ctx context.Context, userInput s
 		}
 	}
 
-	return "", fmt.Errorf("max iterations reached without final response")
+	return ans, fmt.Errorf("max iterations reached without final response")
+}
+
+// examplesMessage presents the examples to the model
+func examplesMessage(matches []examples.Match) string {
+	var sb strings.Builder
+	sb.WriteString("Examples of similar requests and their CQL queries:\n")
+	for _, m := range matches {
+		fmt.Fprintf(&sb, "\nRequest: %s\nCQL: %s\n", m.Input, m.Query)
+	}
+	return sb.String()
 }
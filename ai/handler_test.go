@@ -0,0 +1,278 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/czcorpus/cqlizer/ai/examples"
+	"github.com/czcorpus/cqlizer/ai/prompts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivatePrompt(t *testing.T) {
+	dir := t.TempDir()
+	store, err := prompts.NewStore(dir)
+	require.NoError(t, err)
+	_, err = store.Save("custom", "custom prompt v1", "", "")
+	require.NoError(t, err)
+	_, err = store.Save("custom", "custom prompt v2", "", "")
+	require.NoError(t, err)
+
+	ct, err := NewCQLTRanslator(nil, "default prompt", store, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "default prompt", ct.GetSystemPrompt())
+	_, ok := ct.GetActivePrompt()
+	assert.False(t, ok)
+
+	active, err := ct.ActivatePrompt("custom", 1, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 1, active.Version)
+	assert.Equal(t, "custom prompt v1", ct.GetSystemPrompt())
+
+	_, err = ct.ActivatePrompt("missing", 0, "alice")
+	assert.ErrorIs(t, err, prompts.ErrNotFound)
+	assert.Equal(t, "custom prompt v1", ct.GetSystemPrompt())
+
+	// a new translator (e.g. after restart) uses the persisted choice
+	store2, err := prompts.NewStore(dir)
+	require.NoError(t, err)
+	ct2, err := NewCQLTRanslator(nil, "default prompt", store2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "custom prompt v1", ct2.GetSystemPrompt())
+	active, ok = ct2.GetActivePrompt()
+	assert.True(t, ok)
+	assert.Equal(t, "custom", active.Name)
+
+	require.NoError(t, ct2.ResetPrompt())
+	assert.Equal(t, "default prompt", ct2.GetSystemPrompt())
+	ct3, err := NewCQLTRanslator(nil, "default prompt", store2, nil)
+	require.NoError(t, err)
+	_, ok = ct3.GetActivePrompt()
+	assert.False(t, ok)
+}
+
+func TestTranslatorWithoutPromptStore(t *testing.T) {
+	ct, err := NewCQLTRanslator(nil, "default prompt", nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, ct.Prompts())
+	assert.Equal(t, "default prompt", ct.GetSystemPrompt())
+	_, err = ct.ActivatePrompt("custom", 0, "alice")
+	assert.ErrorIs(t, err, ErrNoPromptStore)
+	assert.ErrorIs(t, ct.ResetPrompt(), ErrNoPromptStore)
+	assert.Equal(t, "default prompt", ct.GetSystemPrompt())
+}
+
+func TestActivatePromptConcurrently(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	_, err = store.Save("custom", "custom prompt", "", "")
+	require.NoError(t, err)
+	ct, err := NewCQLTRanslator(nil, "default prompt", store, nil)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				_, err := ct.ActivatePrompt("custom", 0, "")
+				assert.NoError(t, err)
+
+			} else {
+				assert.NoError(t, ct.ResetPrompt())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			p := ct.GetSystemPrompt()
+			assert.Contains(t, []string{"default prompt", "custom prompt"}, p)
+		}()
+	}
+	wg.Wait()
+}
+
+type fakeEstimator struct {
+	slowQueries map[string]bool
+	corpora     []string
+}
+
+func (fe *fakeEstimator) EstimateQueryCost(query, corpname string) (CostEstimate, error) {
+	fe.corpora = append(fe.corpora, corpname)
+	return CostEstimate{Corpname: corpname, IsSlow: fe.slowQueries[query]}, nil
+}
+
+// newFakeLLM creates an OpenAI compatible server responding with
+// the provided answers (one per completion request)
+func testBackends(urls ...string) []BackendConf {
+	ans := make([]BackendConf, len(urls))
+	for i, u := range urls {
+		ans[i] = BackendConf{Name: fmt.Sprintf("backend%d", i), URL: u, ModelName: "test"}
+	}
+	return ans
+}
+
+func newFakeLLM(t *testing.T, answers []string) (*httptest.Server, *[]string) {
+	var lastMessages []string
+	var i int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+			Stream bool `json:"stream"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		lastMessages = lastMessages[:0]
+		for _, m := range req.Messages {
+			lastMessages = append(lastMessages, m.Content)
+		}
+		if !assert.Less(t, i, len(answers)) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		answer := answers[i]
+		i++
+		if req.Stream {
+			// send the answer in two chunks to test merging
+			w.Header().Set("Content-Type", "text/event-stream")
+			half := len(answer) / 2
+			for _, part := range []string{answer[:half], answer[half:]} {
+				content, _ := json.Marshal(part)
+				fmt.Fprintf(w, "data: {\"choices\": [{\"index\": 0, \"delta\": {\"content\": %s}}]}\n\n", content)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		content, _ := json.Marshal(answer)
+		fmt.Fprintf(
+			w,
+			`{"choices": [{"index": 0, "message": {"role": "assistant", "content": %s}, "finish_reason": "stop"}]}`,
+			content,
+		)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &lastMessages
+}
+
+func TestTranslateRevisesSlowQuery(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	srv, lastMessages := newFakeLLM(t, []string{"`[word=\".*\"]`", "[word=\"dog\"]"})
+	ct, err := NewCQLTRanslator(testBackends(srv.URL), "prompt", store, nil)
+	require.NoError(t, err)
+	ct.SetCostEstimator(&fakeEstimator{slowQueries: map[string]bool{`[word=".*"]`: true}}, 2)
+
+	res, err := ct.TranslateToCQL(t.Context(), "any dog", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, `[word="dog"]`, res.Query)
+	require.NotNil(t, res.IsSlow)
+	assert.False(t, *res.IsSlow)
+	assert.False(t, res.Rejected)
+	require.Len(t, res.Revisions, 2)
+	assert.True(t, res.Revisions[0].Estimate.IsSlow)
+	assert.True(t, strings.Contains((*lastMessages)[len(*lastMessages)-1], "predicted to be slow"))
+}
+
+func TestTranslateRejectsAfterMaxRevisions(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	srv, _ := newFakeLLM(t, []string{"[word=", "[word=\".*\"]"})
+	ct, err := NewCQLTRanslator(testBackends(srv.URL), "prompt", store, nil)
+	require.NoError(t, err)
+	ct.SetCostEstimator(&fakeEstimator{slowQueries: map[string]bool{`[word=".*"]`: true}}, 1)
+
+	res, err := ct.TranslateToCQL(t.Context(), "anything", "", "")
+	require.NoError(t, err)
+	require.Len(t, res.Revisions, 2)
+	assert.NotEmpty(t, res.Revisions[0].SyntaxError)
+	assert.Equal(t, `[word=".*"]`, res.Query)
+	assert.True(t, *res.IsSlow)
+	assert.True(t, res.Rejected)
+}
+
+func TestTranslateWithoutEstimator(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	srv, _ := newFakeLLM(t, []string{"[word=\"dog\"]"})
+	ct, err := NewCQLTRanslator(testBackends(srv.URL), "prompt", store, nil)
+	require.NoError(t, err)
+
+	res, err := ct.TranslateToCQL(t.Context(), "dog", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, `[word="dog"]`, res.Query)
+	assert.Nil(t, res.IsSlow)
+	assert.False(t, res.Rejected)
+}
+
+func TestTranslateWithCorpus(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	srv, lastMessages := newFakeLLM(t, []string{"[lema=\"dog\"]", "[lemma=\"dog\"]"})
+	ct, err := NewCQLTRanslator(testBackends(srv.URL), "prompt", store, newTestCorpInfoProvider(t))
+	require.NoError(t, err)
+	estimator := &fakeEstimator{}
+	ct.SetCostEstimator(estimator, 2)
+
+	res, err := ct.TranslateToCQL(t.Context(), "dog", "testcorp", "")
+	require.NoError(t, err)
+	assert.Equal(t, `[lemma="dog"]`, res.Query)
+	require.Len(t, res.Revisions, 2)
+	require.Len(t, res.Revisions[0].Issues, 1)
+	assert.Equal(t, []string{"lemma"}, res.Revisions[0].Issues[0].Suggestions)
+	assert.Contains(t, (*lastMessages)[1], "The query is intended for the corpus testcorp")
+	assert.Equal(t, []string{"testcorp"}, estimator.corpora)
+
+	_, err = ct.TranslateToCQL(t.Context(), "dog", "missing", "")
+	assert.ErrorIs(t, err, ErrCorpusNotFound)
+}
+
+func TestTranslateWithExamples(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	exampleStore, err := examples.NewStore(filepath.Join(t.TempDir(), "examples.json"))
+	require.NoError(t, err)
+	_, err = exampleStore.Add("all forms of the word dog", `[lemma="dog"]`, "", "")
+	require.NoError(t, err)
+	_, err = exampleStore.Add("nouns in genitive", `[tag="N...2.*"]`, "", "")
+	require.NoError(t, err)
+	srv, lastMessages := newFakeLLM(t, []string{"[lemma=\"cat\"]", "[tag=\"N.*\"]"})
+	ct, err := NewCQLTRanslator(testBackends(srv.URL), "prompt", store, nil)
+	require.NoError(t, err)
+	ct.SetExampleStore(exampleStore, 3)
+
+	res, err := ct.TranslateToCQL(t.Context(), "all forms of the word cat", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, res.Examples)
+	require.Len(t, *lastMessages, 3)
+	assert.Contains(t, (*lastMessages)[1], "Request: all forms of the word dog\nCQL: [lemma=\"dog\"]")
+	assert.Equal(t, "all forms of the word cat", (*lastMessages)[2])
+
+	res, err = ct.TranslateToCQL(t.Context(), "verbs", "", "")
+	require.NoError(t, err)
+	assert.Empty(t, res.Examples)
+	assert.Len(t, *lastMessages, 2)
+}
@@ -0,0 +1,72 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package nleval measures quality of the NL -> CQL translation
+// using a gold dataset of natural language requests and expected queries.
+package nleval
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Case is a single item of a gold dataset
+type Case struct {
+	ID    string `json:"id"`
+	Input string `json:"input"`
+
+	// Corpname is optional (the translation is then not corpus-aware)
+	Corpname string `json:"corpname"`
+	Expected string `json:"expected"`
+}
+
+// LoadDataset reads a JSONL file with one Case per line.
+// Empty lines are ignored and missing IDs are replaced with line numbers.
+func LoadDataset(path string) ([]Case, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dataset: %w", err)
+	}
+	defer f.Close()
+	ans := make([]Case, 0, 100)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var lineNum int
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var item Case
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			return nil, fmt.Errorf("failed to parse dataset line %d: %w", lineNum, err)
+		}
+		if item.Input == "" || item.Expected == "" {
+			return nil, fmt.Errorf("missing input or expected query on dataset line %d", lineNum)
+		}
+		if item.ID == "" {
+			item.ID = fmt.Sprintf("line%d", lineNum)
+		}
+		ans = append(ans, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dataset: %w", err)
+	}
+	return ans, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nleval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// PromptReport summarizes results of a single prompt
+type PromptReport struct {
+	Prompt          string  `json:"prompt"`
+	NumErrors       int     `json:"numErrors"`
+	ExactMatch      float64 `json:"exactMatch"`
+	StructuralMatch float64 `json:"structuralMatch"`
+	Valid           float64 `json:"valid"`
+
+	// Slow is a ratio of queries predicted to be slow
+	// (out of the queries with an estimated cost)
+	Slow float64 `json:"slow"`
+
+	// NumEstimated is a number of queries with an estimated cost
+	NumEstimated    int          `json:"numEstimated"`
+	AvgRevisions    float64      `json:"avgRevisions"`
+	AvgDurationSecs float64      `json:"avgDurationSecs"`
+	Cases           []CaseResult `json:"cases"`
+}
+
+func newPromptReport(label string, results []CaseResult) PromptReport {
+	ans := PromptReport{Prompt: label, Cases: results}
+	var numExact, numStructural, numValid, numSlow, numRevisions int
+	var duration float64
+	for _, r := range results {
+		duration += r.DurationSecs
+		if r.Error != "" {
+			ans.NumErrors++
+			continue
+		}
+		if r.ExactMatch {
+			numExact++
+		}
+		if r.StructuralMatch {
+			numStructural++
+		}
+		if r.Valid {
+			numValid++
+		}
+		if r.IsSlow != nil {
+			ans.NumEstimated++
+			if *r.IsSlow {
+				numSlow++
+			}
+		}
+		numRevisions += r.NumRevisions
+	}
+	// errors count as failures in all the ratios
+	ratio := func(v, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(v) / float64(total)
+	}
+	ans.ExactMatch = ratio(numExact, len(results))
+	ans.StructuralMatch = ratio(numStructural, len(results))
+	ans.Valid = ratio(numValid, len(results))
+	ans.Slow = ratio(numSlow, ans.NumEstimated)
+	ans.AvgRevisions = ratio(numRevisions, len(results)-ans.NumErrors)
+	if len(results) > 0 {
+		ans.AvgDurationSecs = duration / float64(len(results))
+	}
+	return ans
+}
+
+// Report compares results of all the evaluated prompts
+type Report struct {
+	CreatedAt time.Time      `json:"createdAt"`
+	Backend   string         `json:"backend,omitempty"`
+	NumCases  int            `json:"numCases"`
+	Prompts   []PromptReport `json:"prompts"`
+}
+
+// WriteText writes a human-readable comparison of the prompts
+// along with a list of cases the prompts disagree on
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "PROMPT\tERRORS\tEXACT\tSTRUCTURAL\tVALID\tSLOW\tREVISIONS\tAVG. TIME\n")
+	for _, p := range r.Prompts {
+		slow := "-"
+		if p.NumEstimated > 0 {
+			slow = fmt.Sprintf("%.1f%%", p.Slow*100)
+		}
+		fmt.Fprintf(
+			tw,
+			"%s\t%d\t%.1f%%\t%.1f%%\t%.1f%%\t%s\t%.2f\t%.2fs\n",
+			p.Prompt, p.NumErrors, p.ExactMatch*100, p.StructuralMatch*100, p.Valid*100,
+			slow, p.AvgRevisions, p.AvgDurationSecs,
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(r.Prompts) < 2 {
+		return nil
+	}
+	fmt.Fprintf(w, "\nCases with different results (structural match):\n")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := make([]string, len(r.Prompts))
+	for i, p := range r.Prompts {
+		header[i] = p.Prompt
+	}
+	fmt.Fprintf(tw, "CASE\t%s\n", strings.Join(header, "\t"))
+	for i := 0; i < r.NumCases; i++ {
+		row := make([]string, len(r.Prompts))
+		var numMatches int
+		for j, p := range r.Prompts {
+			row[j] = "no"
+			if p.Cases[i].Error != "" {
+				row[j] = "error"
+
+			} else if p.Cases[i].StructuralMatch {
+				row[j] = "yes"
+				numMatches++
+			}
+		}
+		if numMatches > 0 && numMatches < len(r.Prompts) {
+			fmt.Fprintf(tw, "%s\t%s\n", r.Prompts[0].Cases[i].CaseID, strings.Join(row, "\t"))
+		}
+	}
+	return tw.Flush()
+}
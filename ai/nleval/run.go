@@ -0,0 +1,169 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nleval
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/cqlizer/ai"
+	"github.com/czcorpus/cqlizer/ai/prompts"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// PromptDefault refers to the prompt loaded from ai.systemPromptFile
+	PromptDefault = "default"
+
+	// PromptActive refers to the prompt currently used by the translator
+	PromptActive = "active"
+)
+
+// Prompt is a system prompt to be evaluated
+type Prompt struct {
+	Label   string
+	Content string
+}
+
+// ResolvePrompts finds system prompts for the provided specifications which
+// are either "default", "active", a stored prompt name (= its latest version)
+// or "name@vN".
+func ResolvePrompts(specs []string, translator *ai.CQLTranslator) ([]Prompt, error) {
+	ans := make([]Prompt, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		switch spec {
+		case "":
+			continue
+		case PromptDefault:
+			ans = append(ans, Prompt{Label: spec, Content: translator.GetDefaultSystemPrompt()})
+		case PromptActive:
+			label := PromptDefault
+			if active, ok := translator.GetActivePrompt(); ok {
+				label = fmt.Sprintf("%s@v%d", active.Name, active.Version)
+			}
+			ans = append(ans, Prompt{Label: label, Content: translator.GetSystemPrompt()})
+		default:
+			name, version, err := parsePromptSpec(spec)
+			if err != nil {
+				return nil, err
+			}
+			if translator.Prompts() == nil {
+				return nil, fmt.Errorf("failed to load prompt %s: %w", spec, ai.ErrNoPromptStore)
+			}
+			content, ver, err := translator.Prompts().Get(name, version)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load prompt %s: %w", spec, err)
+			}
+			ans = append(ans, Prompt{Label: fmt.Sprintf("%s@v%d", name, ver.Version), Content: content})
+		}
+	}
+	if len(ans) == 0 {
+		return nil, fmt.Errorf("no prompt to evaluate")
+	}
+	return ans, nil
+}
+
+// parsePromptSpec parses "name" or "name@vN" (version 0 = latest)
+func parsePromptSpec(spec string) (string, int, error) {
+	name, rawVersion, found := strings.Cut(spec, "@")
+	if !found {
+		return name, 0, nil
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(rawVersion, "v"))
+	if err != nil || version < 1 {
+		return "", 0, fmt.Errorf("%w: %s", prompts.ErrInvalidVersion, spec)
+	}
+	return name, version, nil
+}
+
+// CaseResult is a result of a single translation
+type CaseResult struct {
+	CaseID   string `json:"caseId"`
+	Query    string `json:"query"`
+	Error    string `json:"error,omitempty"`
+	Backend  string `json:"backend,omitempty"`
+	Expected string `json:"expected"`
+	Score
+
+	// IsSlow is nil in case the query cost could not be estimated
+	IsSlow       *bool   `json:"isSlow"`
+	NumRevisions int     `json:"numRevisions"`
+	DurationSecs float64 `json:"durationSecs"`
+}
+
+// Run translates all the cases using all the prompts and evaluates
+// the results. Failed translations are recorded as errors; only
+// a cancelled ctx stops the evaluation.
+func Run(
+	ctx context.Context,
+	translator *ai.CQLTranslator,
+	evalPrompts []Prompt,
+	cases []Case,
+	backendName string,
+) (*Report, error) {
+	report := &Report{
+		CreatedAt: time.Now(),
+		Backend:   backendName,
+		NumCases:  len(cases),
+		Prompts:   make([]PromptReport, len(evalPrompts)),
+	}
+	for i, prompt := range evalPrompts {
+		results := make([]CaseResult, 0, len(cases))
+		for _, c := range cases {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			t0 := time.Now()
+			res, err := translator.TranslateToCQLWithPrompt(ctx, c.Input, c.Corpname, prompt.Content, backendName)
+			item := CaseResult{
+				CaseID:       c.ID,
+				Expected:     c.Expected,
+				DurationSecs: time.Since(t0).Seconds(),
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				log.Warn().Err(err).Str("prompt", prompt.Label).Str("case", c.ID).Msg("translation failed")
+				item.Error = err.Error()
+				results = append(results, item)
+				continue
+			}
+			item.Query = res.Query
+			item.Backend = res.Backend
+			item.IsSlow = res.IsSlow
+			item.NumRevisions = max(0, len(res.Revisions)-1)
+			var valid bool
+			if len(res.Revisions) > 0 {
+				last := res.Revisions[len(res.Revisions)-1]
+				valid = last.SyntaxError == "" && len(last.Issues) == 0
+			}
+			item.Score = scoreQuery(res.Query, c.Expected, valid)
+			results = append(results, item)
+			log.Debug().
+				Str("prompt", prompt.Label).
+				Str("case", c.ID).
+				Bool("structuralMatch", item.StructuralMatch).
+				Msg("evaluated case")
+		}
+		report.Prompts[i] = newPromptReport(prompt.Label, results)
+	}
+	return report, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nleval
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/cqlizer/ai"
+	"github.com/czcorpus/cqlizer/ai/prompts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockLLM creates an OpenAI-compatible server answering
+// user messages according to the system prompt (prompt -> input -> answer)
+func newMockLLM(t *testing.T, answers map[string]map[string]string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		answer, ok := answers[req.Messages[0].Content][req.Messages[len(req.Messages)-1].Content]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"message": "unexpected request"}}`))
+			return
+		}
+		content, _ := json.Marshal(answer)
+		fmt.Fprintf(
+			w,
+			`{"choices": [{"index": 0, "message": {"role": "assistant", "content": %s}, "finish_reason": "stop"}]}`,
+			content,
+		)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestTranslator(t *testing.T, url string) *ai.CQLTranslator {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	_, err = store.Save("better", "better prompt", "test", "")
+	require.NoError(t, err)
+	translator, err := ai.NewCQLTRanslator(
+		[]ai.BackendConf{{Name: "mock", URL: url, ModelName: "test"}},
+		"default prompt",
+		store,
+		nil,
+	)
+	require.NoError(t, err)
+	return translator
+}
+
+func TestLoadDataset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gold.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(
+		`{"id": "a", "input": "dog", "expected": "[lemma=\"dog\"]"}`+"\n\n"+
+			`{"input": "cat", "corpname": "syn2020", "expected": "[lemma=\"cat\"]"}`+"\n",
+	), 0644))
+	cases, err := LoadDataset(path)
+	require.NoError(t, err)
+	require.Len(t, cases, 2)
+	assert.Equal(t, "a", cases[0].ID)
+	assert.Equal(t, "line3", cases[1].ID)
+	assert.Equal(t, "syn2020", cases[1].Corpname)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"id": "a", "input": "dog"}`), 0644))
+	_, err = LoadDataset(path)
+	assert.Error(t, err)
+}
+
+func TestResolvePrompts(t *testing.T) {
+	translator := newTestTranslator(t, "")
+	ans, err := ResolvePrompts([]string{"default", " better", "better@v1", ""}, translator)
+	require.NoError(t, err)
+	require.Len(t, ans, 3)
+	assert.Equal(t, "default prompt", ans[0].Content)
+	assert.Equal(t, "better@v1", ans[1].Label)
+	assert.Equal(t, "better prompt", ans[2].Content)
+
+	_, err = ResolvePrompts([]string{"better@vX"}, translator)
+	assert.ErrorIs(t, err, prompts.ErrInvalidVersion)
+	_, err = ResolvePrompts([]string{"missing"}, translator)
+	assert.ErrorIs(t, err, prompts.ErrNotFound)
+	_, err = ResolvePrompts([]string{""}, translator)
+	assert.Error(t, err)
+}
+
+func TestRunComparesPrompts(t *testing.T) {
+	srv := newMockLLM(t, map[string]map[string]string{
+		"default prompt": {
+			"dog":  `[word="dog"]`,
+			"cats": `[lemma="cat"`,
+		},
+		"better prompt": {
+			"dog":  "`[lemma=\"dog\"]`",
+			"cats": `[tag="N.*" & lemma="cat"]`,
+		},
+	})
+	translator := newTestTranslator(t, srv.URL)
+	evalPrompts, err := ResolvePrompts([]string{"default", "better"}, translator)
+	require.NoError(t, err)
+	cases := []Case{
+		{ID: "dog", Input: "dog", Expected: `[lemma="dog"]`},
+		{ID: "cats", Input: "cats", Expected: `[lemma="cat" & tag="N.*"]`},
+		{ID: "err", Input: "unknown", Expected: `[]`},
+	}
+
+	report, err := Run(t.Context(), translator, evalPrompts, cases, "")
+	require.NoError(t, err)
+	require.Len(t, report.Prompts, 2)
+
+	dflt := report.Prompts[0]
+	assert.Equal(t, "default", dflt.Prompt)
+	assert.Equal(t, 1, dflt.NumErrors)
+	assert.Equal(t, 0.0, dflt.StructuralMatch)
+	assert.InDelta(t, 1.0/3, dflt.Valid, 0.001)
+	assert.Equal(t, 0, dflt.NumEstimated)
+
+	better := report.Prompts[1]
+	assert.Equal(t, "better@v1", better.Prompt)
+	assert.InDelta(t, 1.0/3, better.ExactMatch, 0.001)
+	assert.InDelta(t, 2.0/3, better.StructuralMatch, 0.001)
+	assert.InDelta(t, 2.0/3, better.Valid, 0.001)
+	assert.Equal(t, "mock", better.Cases[0].Backend)
+	assert.NotEmpty(t, better.Cases[2].Error)
+
+	var buff strings.Builder
+	require.NoError(t, report.WriteText(&buff))
+	assert.Contains(t, buff.String(), "better@v1")
+	assert.Contains(t, buff.String(), "66.7%")
+	assert.Contains(t, buff.String(), "Cases with different results")
+	assert.NotContains(t, buff.String(), "\nerr ")
+}
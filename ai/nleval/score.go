@@ -0,0 +1,119 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nleval
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/czcorpus/cqlizer/cql"
+)
+
+type dfsNode interface {
+	DFS(fn func(v cql.ASTNode))
+}
+
+// structuralTokens lists nodes of a syntax tree in post-order so that
+// formatting of the query does not matter. Operands of the & and | operators
+// within a position are sorted as their order does not affect the meaning.
+func structuralTokens(root dfsNode) []string {
+	ans := make([]string, 0, 50)
+	// replaceOperands replaces already listed tokens of the operands
+	// with their sorted variant
+	replaceOperands := func(operands []dfsNode) {
+		keys := make([]string, len(operands))
+		var n int
+		for i, op := range operands {
+			tokens := structuralTokens(op)
+			keys[i] = strings.Join(tokens, "|")
+			n += len(tokens)
+		}
+		sort.Strings(keys)
+		ans = append(ans[:len(ans)-n], keys...)
+	}
+	root.DFS(func(v cql.ASTNode) {
+		switch node := v.(type) {
+		case cql.ASTString:
+			if value := strings.TrimSpace(string(node)); value != "" {
+				ans = append(ans, value)
+			}
+			return
+		case *cql.RepOpt:
+			if node != nil {
+				ans = append(ans, strings.ReplaceAll(node.Text(), " ", ""))
+			}
+		case *cql.AttVal:
+			// negation is not represented by a node
+			if node.Variant1 != nil && node.Variant1.Not || node.Variant2 != nil && node.Variant2.Not {
+				ans = append(ans, "!")
+			}
+		case *cql.WithinOrContaining:
+			if node.NumNegWithinParts()+node.NumNegContainingParts() > 0 {
+				ans = append(ans, "!")
+			}
+		case *cql.AttValAnd:
+			operands := make([]dfsNode, len(node.AttVal))
+			for i, item := range node.AttVal {
+				operands[i] = item
+			}
+			replaceOperands(operands)
+		case *cql.AttValList:
+			operands := make([]dfsNode, len(node.AttValAnd))
+			for i, item := range node.AttValAnd {
+				operands[i] = item
+			}
+			replaceOperands(operands)
+		}
+		ans = append(ans, fmt.Sprintf("%T", v))
+	})
+	return ans
+}
+
+// Score describes how a generated query matches the expected one
+type Score struct {
+	ExactMatch bool `json:"exactMatch"`
+
+	// StructuralMatch means both queries have the same syntax tree
+	// (i.e. they differ only in formatting or order of & and | operands)
+	StructuralMatch bool `json:"structuralMatch"`
+
+	// Valid means the generated query is syntactically correct and
+	// (for corpus-aware translations) uses only existing attributes
+	Valid bool `json:"valid"`
+}
+
+func scoreQuery(generated, expected string, valid bool) Score {
+	ans := Score{
+		ExactMatch: strings.TrimSpace(generated) == strings.TrimSpace(expected),
+		Valid:      valid,
+	}
+	if ans.ExactMatch {
+		ans.StructuralMatch = true
+		return ans
+	}
+	genQuery, err := cql.ParseCQL("", generated)
+	if err != nil {
+		return ans
+	}
+	expQuery, err := cql.ParseCQL("", expected)
+	if err != nil {
+		return ans
+	}
+	ans.StructuralMatch = slices.Equal(structuralTokens(genQuery), structuralTokens(expQuery))
+	return ans
+}
@@ -0,0 +1,58 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nleval
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScoreQueryExactMatch(t *testing.T) {
+	s := scoreQuery(` [word="dog"] `, `[word="dog"]`, true)
+	assert.True(t, s.ExactMatch)
+	assert.True(t, s.StructuralMatch)
+	assert.True(t, s.Valid)
+}
+
+func TestScoreQueryStructuralMatch(t *testing.T) {
+	for _, pair := range [][2]string{
+		{`[ word = "dog" ]`, `[word="dog"]`},
+		{`[word="dog"]within<s/>`, `[word="dog"] within <s />`},
+		{`[tag="N.*" & lemma="dog"]`, `[lemma="dog" & tag="N.*"]`},
+		{`[tag="N.*" | lemma="dog"]`, `[lemma="dog" | tag="N.*"]`},
+	} {
+		s := scoreQuery(pair[0], pair[1], true)
+		assert.False(t, s.ExactMatch, pair[0])
+		assert.True(t, s.StructuralMatch, pair[0])
+	}
+}
+
+func TestScoreQueryStructuralMismatch(t *testing.T) {
+	for _, pair := range [][2]string{
+		{`[lemma="dog"]`, `[lemma="cat"]`},
+		{`[lemma="dog"]`, `[word="dog"]`},
+		{`[lemma!="dog"]`, `[lemma="dog"]`},
+		{`[lemma="dog"]{2}`, `[lemma="dog"]{3}`},
+		{`[lemma="dog"] []`, `[lemma="dog"]`},
+		{`[lemma="dog"] within <s/>`, `[lemma="dog"] !within <s/>`},
+		{`[lemma="dog"] within <doc genre="a"/>`, `[lemma="dog"] within <doc genre="b"/>`},
+		{`[lemma="dog"`, `[lemma="dog"]`},
+	} {
+		s := scoreQuery(pair[0], pair[1], false)
+		assert.False(t, s.StructuralMatch, pair[0])
+	}
+}
@@ -0,0 +1,414 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prompts provides a versioned storage of system prompts
+// used for the NL -> CQL translation.
+//
+// Each prompt has its own directory containing all the saved versions
+// (v1.txt, v2.txt,...) and a history file with metadata of the versions.
+// Prompt names are validated so they can never point outside the store.
+// Flat prompt files saved by older versions (name.yyyy-mm-dd.txt) are
+// imported once the store is created.
+package prompts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/cqlizer/internal/fsutil"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	historyFileName = "history.json"
+	activeFileName  = "active.json"
+	diffContextSize = 3
+)
+
+var (
+	ErrInvalidName    = errors.New("invalid prompt name")
+	ErrInvalidVersion = errors.New("invalid prompt version")
+	ErrNotFound       = errors.New("prompt not found")
+
+	namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,63}$`)
+
+	// legacyFilePattern matches prompt files saved by older versions
+	legacyFilePattern = regexp.MustCompile(`^(.+)\.(\d{4}-\d{2}-\d{2})\.txt$`)
+)
+
+// Version describes a single saved version of a prompt
+type Version struct {
+	Version   int       `json:"version"`
+	Author    string    `json:"author,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int       `json:"size"`
+	SHA256    string    `json:"sha256"`
+}
+
+// Info is an overview of a stored prompt
+type Info struct {
+	Name        string  `json:"name"`
+	NumVersions int     `json:"numVersions"`
+	Latest      Version `json:"latest"`
+}
+
+// Active identifies a prompt version used by the translator
+type Active struct {
+	Name        string    `json:"name"`
+	Version     int       `json:"version"`
+	ActivatedAt time.Time `json:"activatedAt"`
+	ActivatedBy string    `json:"activatedBy,omitempty"`
+}
+
+// ValidateName tests whether the name can be used as a prompt name.
+// Only letters, digits, '_' and '-' are allowed.
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// Store is a directory based storage of versioned prompts
+type Store struct {
+	rootDir string
+	mu      sync.RWMutex
+}
+
+func (s *Store) promptDir(name string) string {
+	return filepath.Join(s.rootDir, name)
+}
+
+func (s *Store) versionPath(name string, version int) string {
+	return filepath.Join(s.promptDir(name), fmt.Sprintf("v%d.txt", version))
+}
+
+func (s *Store) loadHistory(name string) ([]Version, error) {
+	data, err := os.ReadFile(filepath.Join(s.promptDir(name), historyFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load history of prompt %s: %w", name, err)
+	}
+	var ans []Version
+	if err := json.Unmarshal(data, &ans); err != nil {
+		return nil, fmt.Errorf("failed to load history of prompt %s: %w", name, err)
+	}
+	return ans, nil
+}
+
+func (s *Store) findVersion(name string, version int) (Version, error) {
+	if err := ValidateName(name); err != nil {
+		return Version{}, err
+	}
+	if version < 0 {
+		return Version{}, fmt.Errorf("%w: %d", ErrInvalidVersion, version)
+	}
+	history, err := s.loadHistory(name)
+	if err != nil {
+		return Version{}, err
+	}
+	if version == 0 {
+		return history[len(history)-1], nil
+	}
+	for _, v := range history {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return Version{}, fmt.Errorf("%w: %s@v%d", ErrNotFound, name, version)
+}
+
+func (s *Store) readVersion(name string, version int) (string, Version, error) {
+	ver, err := s.findVersion(name, version)
+	if err != nil {
+		return "", Version{}, err
+	}
+	data, err := os.ReadFile(s.versionPath(name, ver.Version))
+	if err != nil {
+		return "", Version{}, fmt.Errorf("failed to read prompt %s@v%d: %w", name, ver.Version, err)
+	}
+	return string(data), ver, nil
+}
+
+// Save stores the content as a new version of the prompt. If the prompt
+// does not exist yet, it is created.
+func (s *Store) Save(name, content, author, comment string) (Version, error) {
+	if err := ValidateName(name); err != nil {
+		return Version{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(name, content, author, comment, time.Now())
+}
+
+func (s *Store) save(name, content, author, comment string, createdAt time.Time) (Version, error) {
+	history, err := s.loadHistory(name)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return Version{}, err
+	}
+	if err := os.MkdirAll(s.promptDir(name), 0755); err != nil {
+		return Version{}, fmt.Errorf("failed to save prompt %s: %w", name, err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	ver := Version{
+		Version:   len(history) + 1,
+		Author:    author,
+		Comment:   comment,
+		CreatedAt: createdAt,
+		Size:      len(content),
+		SHA256:    hex.EncodeToString(sum[:]),
+	}
+	if err := fsutil.WriteFileAtomic(s.versionPath(name, ver.Version), []byte(content)); err != nil {
+		return Version{}, fmt.Errorf("failed to save prompt %s: %w", name, err)
+	}
+	history = append(history, ver)
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to save prompt %s: %w", name, err)
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(s.promptDir(name), historyFileName), data); err != nil {
+		return Version{}, fmt.Errorf("failed to save prompt %s: %w", name, err)
+	}
+	return ver, nil
+}
+
+// Get returns content of a prompt version. Version 0 means the latest one.
+func (s *Store) Get(name string, version int) (string, Version, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.readVersion(name, version)
+}
+
+// History returns all the versions of the prompt (oldest first)
+func (s *Store) History(name string) ([]Version, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loadHistory(name)
+}
+
+// List returns all the stored prompts sorted by name
+func (s *Store) List() ([]Info, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries, err := os.ReadDir(s.rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompts: %w", err)
+	}
+	ans := make([]Info, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || ValidateName(entry.Name()) != nil {
+			continue
+		}
+		history, err := s.loadHistory(entry.Name())
+		if errors.Is(err, ErrNotFound) {
+			continue
+
+		} else if err != nil {
+			return nil, err
+		}
+		ans = append(ans, Info{
+			Name:        entry.Name(),
+			NumVersions: len(history),
+			Latest:      history[len(history)-1],
+		})
+	}
+	sort.Slice(ans, func(i, j int) bool { return ans[i].Name < ans[j].Name })
+	return ans, nil
+}
+
+// Diff returns a unified diff between two versions of the prompt
+func (s *Store) Diff(name string, fromVersion, toVersion int) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fromContent, fromVer, err := s.readVersion(name, fromVersion)
+	if err != nil {
+		return "", err
+	}
+	toContent, toVer, err := s.readVersion(name, toVersion)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(fromContent),
+		B:        difflib.SplitLines(toContent),
+		FromFile: fmt.Sprintf("%s@v%d", name, fromVer.Version),
+		ToFile:   fmt.Sprintf("%s@v%d", name, toVer.Version),
+		Context:  diffContextSize,
+	})
+}
+
+// SetActive marks a prompt version as the one to be used by the translator.
+// Version 0 means the latest one. The choice is persisted in the store.
+func (s *Store) SetActive(name string, version int, activatedBy string) (Active, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ver, err := s.findVersion(name, version)
+	if err != nil {
+		return Active{}, err
+	}
+	ans := Active{
+		Name:        name,
+		Version:     ver.Version,
+		ActivatedAt: time.Now(),
+		ActivatedBy: activatedBy,
+	}
+	data, err := json.MarshalIndent(ans, "", "  ")
+	if err != nil {
+		return Active{}, fmt.Errorf("failed to set active prompt: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(s.rootDir, activeFileName), data); err != nil {
+		return Active{}, fmt.Errorf("failed to set active prompt: %w", err)
+	}
+	return ans, nil
+}
+
+// Active returns the active prompt along with its content.
+// If no prompt has been activated, ErrNotFound is returned.
+func (s *Store) Active() (Active, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := os.ReadFile(filepath.Join(s.rootDir, activeFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return Active{}, "", fmt.Errorf("%w: no active prompt", ErrNotFound)
+
+	} else if err != nil {
+		return Active{}, "", fmt.Errorf("failed to load active prompt: %w", err)
+	}
+	var ans Active
+	if err := json.Unmarshal(data, &ans); err != nil {
+		return Active{}, "", fmt.Errorf("failed to load active prompt: %w", err)
+	}
+	content, _, err := s.readVersion(ans.Name, ans.Version)
+	if err != nil {
+		return Active{}, "", err
+	}
+	return ans, content, nil
+}
+
+// ClearActive unsets the active prompt so the translator's default
+// prompt is used
+func (s *Store) ClearActive() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(filepath.Join(s.rootDir, activeFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to clear active prompt: %w", err)
+	}
+	return nil
+}
+
+type legacyPrompt struct {
+	fileName  string
+	createdAt time.Time
+}
+
+// importLegacy imports flat prompt files (name.yyyy-mm-dd.txt or name.txt)
+// saved by older versions. Files with the same name become consecutive
+// versions ordered by their date. Names already present in the store are
+// skipped so the files are imported just once. The files are left untouched.
+func (s *Store) importLegacy() (int, error) {
+	entries, err := os.ReadDir(s.rootDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to import legacy prompts: %w", err)
+	}
+	legacy := make(map[string][]legacyPrompt)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || filepath.Ext(entry.Name()) != ".txt" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return 0, fmt.Errorf("failed to import legacy prompts: %w", err)
+		}
+		item := legacyPrompt{fileName: entry.Name(), createdAt: info.ModTime()}
+		name := entry.Name()[:len(entry.Name())-len(".txt")]
+		if m := legacyFilePattern.FindStringSubmatch(entry.Name()); m != nil {
+			name = m[1]
+			if date, err := time.ParseInLocation("2006-01-02", m[2], time.Local); err == nil {
+				item.createdAt = date
+			}
+		}
+		if err := ValidateName(name); err != nil {
+			log.Warn().Str("file", entry.Name()).Msg("cannot import legacy prompt, unsupported name")
+			continue
+		}
+		legacy[name] = append(legacy[name], item)
+	}
+	var ans int
+	for name, items := range legacy {
+		if _, err := s.loadHistory(name); err == nil {
+			continue
+
+		} else if !errors.Is(err, ErrNotFound) {
+			return ans, err
+		}
+		sort.Slice(items, func(i, j int) bool {
+			if items[i].createdAt.Equal(items[j].createdAt) {
+				return items[i].fileName < items[j].fileName
+			}
+			return items[i].createdAt.Before(items[j].createdAt)
+		})
+		for _, item := range items {
+			content, err := os.ReadFile(filepath.Join(s.rootDir, item.fileName))
+			if err != nil {
+				return ans, fmt.Errorf("failed to import legacy prompt %s: %w", item.fileName, err)
+			}
+			comment := fmt.Sprintf("imported from %s", item.fileName)
+			if _, err := s.save(name, string(content), "", comment, item.createdAt); err != nil {
+				return ans, err
+			}
+			ans++
+		}
+	}
+	return ans, nil
+}
+
+// NewStore creates a prompt store in the rootDir (the directory
+// is created if it does not exist). Legacy prompt files found
+// in the directory are imported (see importLegacy).
+func NewStore(rootDir string) (*Store, error) {
+	if rootDir == "" {
+		return nil, fmt.Errorf("failed to initialize prompt store: directory not specified")
+	}
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to initialize prompt store: %w", err)
+	}
+	ans := &Store{rootDir: rootDir}
+	numImported, err := ans.importLegacy()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize prompt store: %w", err)
+	}
+	if numImported > 0 {
+		log.Info().Int("numVersions", numImported).Msg("imported legacy prompt files")
+	}
+	return ans, nil
+}
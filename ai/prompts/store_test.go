@@ -0,0 +1,190 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateName(t *testing.T) {
+	assert.NoError(t, ValidateName("sysprompt"))
+	assert.NoError(t, ValidateName("my_prompt-2"))
+	for _, name := range []string{"", "../etc", "a/b", ".hidden", "a.b", "-x", strings.Repeat("a", 65)} {
+		assert.ErrorIs(t, ValidateName(name), ErrInvalidName, name)
+	}
+}
+
+func TestSaveAndGet(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	v1, err := store.Save("test", "first\n", "alice", "initial")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v1.Version)
+	v2, err := store.Save("test", "second\n", "bob", "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, v2.Version)
+
+	content, ver, err := store.Get("test", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "second\n", content)
+	assert.Equal(t, "bob", ver.Author)
+
+	content, ver, err = store.Get("test", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "first\n", content)
+	assert.Equal(t, "initial", ver.Comment)
+
+	_, _, err = store.Get("test", 3)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = store.Get("missing", 0)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	history, err := store.History("test")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewStore(filepath.Join(root, "prompts"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644))
+
+	_, err = store.Save("../secret", "x", "", "")
+	assert.ErrorIs(t, err, ErrInvalidName)
+	_, _, err = store.Get("../secret", 0)
+	assert.ErrorIs(t, err, ErrInvalidName)
+	_, err = store.History("..")
+	assert.ErrorIs(t, err, ErrInvalidName)
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+	// legacy flat files and unrelated directories are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old.2025-01-01.txt"), []byte("x"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "empty"), 0755))
+
+	_, err = store.Save("b", "b1", "", "")
+	require.NoError(t, err)
+	_, err = store.Save("a", "a1", "", "")
+	require.NoError(t, err)
+	_, err = store.Save("a", "a2", "", "")
+	require.NoError(t, err)
+
+	items, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "a", items[0].Name)
+	assert.Equal(t, 2, items[0].NumVersions)
+	assert.Equal(t, 2, items[0].Latest.Version)
+	assert.Equal(t, "b", items[1].Name)
+}
+
+func TestDiff(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	_, err = store.Save("test", "line1\nline2\nline3\n", "", "")
+	require.NoError(t, err)
+	_, err = store.Save("test", "line1\nchanged\nline3\n", "", "")
+	require.NoError(t, err)
+
+	diff, err := store.Diff("test", 1, 2)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "--- test@v1")
+	assert.Contains(t, diff, "+++ test@v2")
+	assert.Contains(t, diff, "-line2\n")
+	assert.Contains(t, diff, "+changed\n")
+
+	diff, err = store.Diff("test", 2, 2)
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+}
+
+func TestActive(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+
+	_, _, err = store.Active()
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.SetActive("test", 0, "")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = store.Save("test", "v1", "", "")
+	require.NoError(t, err)
+	_, err = store.Save("test", "v2", "", "")
+	require.NoError(t, err)
+	act, err := store.SetActive("test", 1, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 1, act.Version)
+
+	// the choice is persisted
+	store2, err := NewStore(dir)
+	require.NoError(t, err)
+	act, content, err := store2.Active()
+	require.NoError(t, err)
+	assert.Equal(t, "test", act.Name)
+	assert.Equal(t, 1, act.Version)
+	assert.Equal(t, "alice", act.ActivatedBy)
+	assert.Equal(t, "v1", content)
+}
+
+func TestImportLegacyFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "update.2025-03-01.txt"), []byte("second"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "update.2025-01-15.txt"), []byte("first"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "custom-name.2025-02-01.txt"), []byte("custom"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sysprompt.txt"), []byte("default"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad name.2025-02-01.txt"), []byte("x"), 0644))
+
+	store, err := NewStore(dir)
+	require.NoError(t, err)
+	items, err := store.List()
+	require.NoError(t, err)
+	names := make([]string, len(items))
+	for i, v := range items {
+		names[i] = v.Name
+	}
+	assert.Equal(t, []string{"custom-name", "sysprompt", "update"}, names)
+
+	content, ver, err := store.Get("update", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "first", content)
+	assert.Equal(t, "imported from update.2025-01-15.txt", ver.Comment)
+	assert.Equal(t, "2025-01-15", ver.CreatedAt.Format("2006-01-02"))
+	content, _, err = store.Get("update", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "second", content)
+
+	// the import runs just once
+	_, err = store.Save("update", "third", "", "")
+	require.NoError(t, err)
+	store2, err := NewStore(dir)
+	require.NoError(t, err)
+	history, err := store2.History("update")
+	require.NoError(t, err)
+	assert.Len(t, history, 3)
+}
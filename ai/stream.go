@@ -0,0 +1,124 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	EventToolCall   = "tool_call"
+	EventToolResult = "tool_result"
+	EventPartial    = "partial"
+	EventRevision   = "revision"
+)
+
+// TranslationEvent describes a progress of a running translation
+type TranslationEvent struct {
+	Type      string    `json:"type"`
+	Tool      string    `json:"tool,omitempty"`
+	Arguments string    `json:"arguments,omitempty"`
+	Result    string    `json:"result,omitempty"`
+	Content   string    `json:"content,omitempty"`
+	Revision  *Revision `json:"revision,omitempty"`
+}
+
+// TranslateToCQLStream works like TranslateToCQLWithPrompt but the model's output
+// is streamed and each step (partial output, tool calls, revisions) is reported
+// via onEvent. An empty customPrompt means the active system prompt is used.
+// The translation stops once the ctx is cancelled. Please note that in case
+// a backend fails, partial events of the failed attempt may have been already
+// reported.
+func (ct *CQLTranslator) TranslateToCQLStream(
+	ctx context.Context,
+	userInput string,
+	corpname string,
+	customPrompt string,
+	backendName string,
+	onEvent func(TranslationEvent),
+) (TranslationResult, error) {
+	if customPrompt == "" {
+		customPrompt = ct.GetSystemPrompt()
+	}
+	return ct.translateToCQLInternal(ctx, userInput, corpname, customPrompt, backendName, onEvent)
+}
+
+// complete obtains a single model response. With onEvent specified,
+// the response is streamed and its content is reported as partial events.
+func complete(
+	ctx context.Context,
+	client *openai.Client,
+	req openai.ChatCompletionRequest,
+	onEvent func(TranslationEvent),
+) (openai.ChatCompletionMessage, error) {
+	if onEvent == nil {
+		resp, err := client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return openai.ChatCompletionMessage{}, fmt.Errorf("completion request failed: %w", err)
+		}
+		if len(resp.Choices) == 0 {
+			return openai.ChatCompletionMessage{}, fmt.Errorf("no choices in response")
+		}
+		return resp.Choices[0].Message, nil
+	}
+
+	stream, err := client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, fmt.Errorf("completion request failed: %w", err)
+	}
+	defer stream.Close()
+	msg := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	var content strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+
+		} else if err != nil {
+			return openai.ChatCompletionMessage{}, fmt.Errorf("completion stream failed: %w", err)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			onEvent(TranslationEvent{Type: EventPartial, Content: delta.Content})
+		}
+		for _, tc := range delta.ToolCalls {
+			msg.ToolCalls = mergeToolCallDelta(msg.ToolCalls, tc)
+		}
+	}
+	msg.Content = content.String()
+	return msg, nil
+}
+
+// mergeToolCallDelta adds a streamed tool call chunk to already received calls.
+// Chunks are matched by their index (or appended to the last call in case
+// the server does not provide indices).
+func mergeToolCallDelta(calls []openai.ToolCall, delta openai.ToolCall) []openai.ToolCall {
+	idx := len(calls) - 1
+	if delta.Index != nil {
+		idx = *delta.Index
+
+	} else if delta.ID != "" || idx < 0 {
+		idx = len(calls)
+	}
+	for len(calls) <= idx {
+		calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+	}
+	curr := &calls[idx]
+	if delta.ID != "" {
+		curr.ID = delta.ID
+	}
+	if delta.Type != "" {
+		curr.Type = delta.Type
+	}
+	curr.Function.Name += delta.Function.Name
+	curr.Function.Arguments += delta.Function.Arguments
+	return calls
+}
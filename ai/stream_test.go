@@ -0,0 +1,87 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/czcorpus/cqlizer/ai/prompts"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateToCQLStreamEvents(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	srv, _ := newFakeLLM(t, []string{"[word=\".*\"]", "[word=\"dog\"]"})
+	ct, err := NewCQLTRanslator(testBackends(srv.URL), "prompt", store, nil)
+	require.NoError(t, err)
+	ct.SetCostEstimator(&fakeEstimator{slowQueries: map[string]bool{`[word=".*"]`: true}}, 1)
+
+	var events []TranslationEvent
+	res, err := ct.TranslateToCQLStream(t.Context(), "any dog", "", "", "", func(evt TranslationEvent) {
+		events = append(events, evt)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `[word="dog"]`, res.Query)
+
+	types := make([]string, len(events))
+	for i, v := range events {
+		types[i] = v.Type
+	}
+	assert.Equal(
+		t,
+		[]string{EventPartial, EventPartial, EventRevision, EventPartial, EventPartial, EventRevision},
+		types,
+	)
+	assert.Equal(t, `[word`, events[0].Content)
+	assert.True(t, events[2].Revision.Estimate.IsSlow)
+	assert.Equal(t, `[word="dog"]`, events[5].Revision.Query)
+}
+
+func TestTranslateToCQLStreamCancelled(t *testing.T) {
+	store, err := prompts.NewStore(t.TempDir())
+	require.NoError(t, err)
+	srv, _ := newFakeLLM(t, []string{})
+	ct, err := NewCQLTRanslator(testBackends(srv.URL), "prompt", store, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err = ct.TranslateToCQLStream(ctx, "anything", "", "", "", func(evt TranslationEvent) {})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestMergeToolCallDelta(t *testing.T) {
+	idx0, idx1 := 0, 1
+	var calls []openai.ToolCall
+	calls = mergeToolCallDelta(calls, openai.ToolCall{
+		Index: &idx0, ID: "a", Function: openai.FunctionCall{Name: "validate_cql", Arguments: `{"que`}})
+	calls = mergeToolCallDelta(calls, openai.ToolCall{
+		Index: &idx1, ID: "b", Function: openai.FunctionCall{Name: "get_structures"}})
+	calls = mergeToolCallDelta(calls, openai.ToolCall{
+		Index: &idx0, Function: openai.FunctionCall{Arguments: `ry": "[]"}`}})
+	calls = mergeToolCallDelta(calls, openai.ToolCall{Function: openai.FunctionCall{Arguments: `{}`}})
+
+	require.Len(t, calls, 2)
+	assert.Equal(t, "a", calls[0].ID)
+	assert.Equal(t, openai.ToolTypeFunction, calls[0].Type)
+	assert.Equal(t, `{"query": "[]"}`, calls[0].Function.Arguments)
+	assert.Equal(t, "get_structures", calls[1].Function.Name)
+	assert.Equal(t, `{}`, calls[1].Function.Arguments)
+}
@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"strings"
+
+	"github.com/czcorpus/rexplorer/parser"
+)
+
+// czechPositionalTagset describes the positional tagset used in most
+// of the Czech corpora (based on the Prague Dependency Treebank)
+const czechPositionalTagset = `The attribute uses the Czech positional tagset. A tag has 15 positions, each one encoding
+a single grammatical category ('-' = not applicable, 'X' = any value):
+1. part of speech: N noun, A adjective, P pronoun, C numeral, V verb, D adverb, R preposition,
+   J conjunction, T particle, I interjection, Z punctuation, X unknown
+2. detailed part of speech (e.g. NN common noun, VB present tense verb, Vf infinitive, AA adjective)
+3. gender: M masculine animate, I masculine inanimate, F feminine, N neuter
+4. number: S singular, P plural, D dual
+5. case: 1 nominative, 2 genitive, 3 dative, 4 accusative, 5 vocative, 6 locative, 7 instrumental
+6. possessor's gender
+7. possessor's number
+8. person: 1, 2, 3
+9. tense: P present, F future, R past
+10. degree of comparison: 1 positive, 2 comparative, 3 superlative
+11. negation: A affirmative, N negated
+12. voice: A active, P passive
+13.-14. reserved
+15. variant/style
+Examples: [tag="N...1.*"] nouns in nominative, [tag="NNFP.*"] feminine plural common nouns,
+[tag="A.{8}3.*"] superlative adjectives, [tag="V.{9}N.*"] negated verbs.`
+
+// findTagset returns a description of a known tagset used
+// by the attribute (or an empty string if the tagset is not known)
+func findTagset(reg *parser.Document, attrName string) string {
+	lang := strings.ToLower(reg.Entries.Get("LANGUAGE").Value())
+	if attrName == "tag" && strings.HasPrefix(lang, "czech") {
+		return czechPositionalTagset
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/czcorpus/cqlizer/cql"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	toolValidateCQL       = "validate_cql"
+	toolGetTokenAttrs     = "get_token_attrs"
+	toolGetStructures     = "get_structures"
+	toolGetStructAttrs    = "get_struct_attrs"
+	toolDescribeAttribute = "describe_attribute"
+	toolEstimateQueryCost = "estimate_query_cost"
+)
+
+func newTool(name, description, params string) openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        name,
+			Description: description,
+			Parameters:  json.RawMessage(params),
+		},
+	}
+}
+
+// baseTools provides tools available regardless of configuration
+func baseTools() []openai.Tool {
+	return []openai.Tool{
+		newTool(
+			toolValidateCQL,
+			"Checks if the CQL syntax is valid and (if a corpus is specified) whether the query uses only attributes "+
+				"and structures defined in the corpus. Returns 'valid' or an error message describing the problem.",
+			`{
+				"type": "object",
+				"properties": {
+					"query": {"type": "string", "description": "The CQL query to validate"},
+					"corpname": {"type": "string", "description": "A corpus to validate the query against"}
+				},
+				"required": ["query"]
+			}`,
+		),
+		newTool(
+			toolGetTokenAttrs,
+			"Provides a list of attributes applicable for token search (word, lemma, tag,...)",
+			`{
+				"type": "object",
+				"properties": {
+					"corpname": {"type": "string", "description": "A corpus to get attributes for"}
+				},
+				"required": ["corpname"]
+			}`,
+		),
+		newTool(
+			toolGetStructures,
+			"Provides a list of structures (e.g. doc, p, s) applicable in 'within <structure />' expressions",
+			`{
+				"type": "object",
+				"properties": {
+					"corpname": {"type": "string", "description": "A corpus to get structures for"}
+				},
+				"required": ["corpname"]
+			}`,
+		),
+		newTool(
+			toolGetStructAttrs,
+			"Provides a list of attributes of a structure applicable in 'within <structure attr=\"value\" />' expressions",
+			`{
+				"type": "object",
+				"properties": {
+					"corpname": {"type": "string", "description": "A corpus the structure belongs to"},
+					"structure": {"type": "string", "description": "A structure name (e.g. doc)"}
+				},
+				"required": ["corpname", "structure"]
+			}`,
+		),
+		newTool(
+			toolDescribeAttribute,
+			"Describes a positional (e.g. tag) or structural (e.g. doc.genre) attribute including its tagset if available. "+
+				"Use it before writing regular expressions for tags.",
+			`{
+				"type": "object",
+				"properties": {
+					"corpname": {"type": "string", "description": "A corpus the attribute belongs to"},
+					"attribute": {"type": "string", "description": "A positional attribute (e.g. tag) or a structural one (e.g. doc.genre)"}
+				},
+				"required": ["corpname", "attribute"]
+			}`,
+		),
+	}
+}
+
+func costEstimationTool() openai.Tool {
+	return newTool(
+		toolEstimateQueryCost,
+		"Predicts whether the CQL query will be slow to evaluate. Slow queries should be made more specific.",
+		`{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "description": "The CQL query to estimate"},
+				"corpname": {"type": "string", "description": "A corpus the query is intended for"}
+			},
+			"required": ["query"]
+		}`,
+	)
+}
+
+// toolArgs contains all the arguments our tools use
+type toolArgs struct {
+	Query     string `json:"query"`
+	Corpname  string `json:"corpname"`
+	Structure string `json:"structure"`
+	Attribute string `json:"attribute"`
+}
+
+// runTool performs a tool call requested by the model. Besides the result,
+// the corpus the call refers to (if any) is returned. In case the call
+// fails (e.g. for an unknown corpus), no corpus is returned.
+func (ct *CQLTranslator) runTool(name, arguments string) (result string, corpname string) {
+	var args toolArgs
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return fmt.Sprintf("error parsing arguments: %v", err), ""
+	}
+	switch name {
+	case toolValidateCQL:
+		if args.Corpname == "" {
+			if _, err := cql.ParseCQL("", args.Query); err != nil {
+				return fmt.Sprintf("invalid: %v", err), ""
+			}
+			return "valid", ""
+		}
+		res, err := ct.corpinfo.ValidateQuery(args.Corpname, args.Query)
+		if err != nil {
+			return fmt.Sprintf("failed to validate query: %s", err), ""
+		}
+		return res.String(), args.Corpname
+	case toolGetTokenAttrs:
+		attrs, err := ct.corpinfo.GetAttributes(args.Corpname)
+		if err != nil {
+			return fmt.Sprintf("failed to get supported attributes: %s", err), ""
+		}
+		return strings.Join(attrs, ", "), args.Corpname
+	case toolGetStructures:
+		structs, err := ct.corpinfo.GetStructures(args.Corpname)
+		if err != nil {
+			return fmt.Sprintf("failed to get structures: %s", err), ""
+		}
+		return strings.Join(structs, ", "), args.Corpname
+	case toolGetStructAttrs:
+		attrs, err := ct.corpinfo.GetStructAttrs(args.Corpname, args.Structure)
+		if err != nil {
+			return fmt.Sprintf("failed to get structural attributes: %s", err), ""
+		}
+		return strings.Join(attrs, ", "), args.Corpname
+	case toolDescribeAttribute:
+		desc, err := ct.corpinfo.DescribeAttribute(args.Corpname, args.Attribute)
+		if err != nil {
+			return fmt.Sprintf("failed to describe attribute: %s", err), ""
+		}
+		return desc, args.Corpname
+	case toolEstimateQueryCost:
+		if ct.costEstimator == nil {
+			return "cost estimation not available", ""
+		}
+		est, err := ct.costEstimator.EstimateQueryCost(args.Query, args.Corpname)
+		if err != nil {
+			return fmt.Sprintf("failed to estimate query cost: %s", err), ""
+		}
+		return est.String(), args.Corpname
+	default:
+		return fmt.Sprintf("unknown tool: %s", name), ""
+	}
+}
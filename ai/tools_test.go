@@ -0,0 +1,89 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTranslator(t *testing.T) *CQLTranslator {
+	cp := newTestCorpInfoProvider(t)
+	return &CQLTranslator{corpinfo: cp, tools: baseTools()}
+}
+
+func TestRunToolValidateCQL(t *testing.T) {
+	ct := newTestTranslator(t)
+	res, _ := ct.runTool(toolValidateCQL, `{"query": "[word=\"x\"]"}`)
+	assert.Equal(t, "valid", res)
+	res, _ = ct.runTool(toolValidateCQL, `{"query": "[word="}`)
+	assert.Contains(t, res, "invalid:")
+	res, _ = ct.runTool(toolValidateCQL, `{"query": `)
+	assert.Contains(t, res, "error parsing arguments")
+}
+
+func TestRunToolCorpusInfo(t *testing.T) {
+	ct := newTestTranslator(t)
+	res, corp := ct.runTool(toolGetTokenAttrs, `{"corpname": "testcorp"}`)
+	assert.Equal(t, "word, lemma, tag", res)
+	assert.Equal(t, "testcorp", corp)
+
+	res, _ = ct.runTool(toolGetStructures, `{"corpname": "testcorp"}`)
+	assert.Equal(t, "doc, s", res)
+
+	res, _ = ct.runTool(toolGetStructAttrs, `{"corpname": "testcorp", "structure": "doc"}`)
+	assert.Equal(t, "genre, year", res)
+	res, _ = ct.runTool(toolGetStructAttrs, `{"corpname": "testcorp", "structure": "text"}`)
+	assert.Contains(t, res, "structure text not found")
+
+	res, _ = ct.runTool(toolDescribeAttribute, `{"corpname": "testcorp", "attribute": "lemma"}`)
+	assert.Equal(t, "positional attribute lemma\nLABEL: base form\n", res)
+	res, _ = ct.runTool(toolDescribeAttribute, `{"corpname": "testcorp", "attribute": "tag"}`)
+	assert.Contains(t, res, "TAGSETDOC: https://example.org/tagset")
+	res, _ = ct.runTool(toolDescribeAttribute, `{"corpname": "testcorp", "attribute": "doc.genre"}`)
+	assert.Equal(t, "structural attribute doc.genre\n", res)
+	res, _ = ct.runTool(toolDescribeAttribute, `{"corpname": "testcorp", "attribute": "doc.author"}`)
+	assert.Contains(t, res, "not found")
+
+	res, corp = ct.runTool(toolGetStructures, `{"corpname": "missing"}`)
+	assert.Contains(t, res, "corpus not found")
+	assert.Empty(t, corp)
+	res, corp = ct.runTool(toolValidateCQL, `{"corpname": "missing", "query": "[word=\"x\"]"}`)
+	assert.Contains(t, res, "corpus not found")
+	assert.Empty(t, corp)
+	res, _ = ct.runTool(toolEstimateQueryCost, `{"query": "[word=\"x\"]"}`)
+	assert.Equal(t, "cost estimation not available", res)
+	res, _ = ct.runTool("foo", `{}`)
+	assert.Equal(t, "unknown tool: foo", res)
+}
+
+func TestDescribeCzechTagset(t *testing.T) {
+	dir := t.TempDir()
+	reg := "LANGUAGE \"Czech\"\nATTRIBUTE word\nATTRIBUTE tag\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "syn"), []byte(reg), 0644))
+	cp := NewCorpInfoProvider(dir)
+	desc, err := cp.DescribeAttribute("syn", "tag")
+	require.NoError(t, err)
+	assert.Contains(t, desc, "Czech positional tagset")
+	desc, err = cp.DescribeAttribute("syn", "word")
+	require.NoError(t, err)
+	assert.NotContains(t, desc, "tagset")
+}
@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/czcorpus/cqlizer/cql"
+	"github.com/czcorpus/rexplorer/parser"
+)
+
+const (
+	IssueUnknownPosAttr    = "unknownPosAttr"
+	IssueUnknownStructure  = "unknownStructure"
+	IssueUnknownStructAttr = "unknownStructAttr"
+
+	maxSuggestions = 3
+)
+
+// ValidationIssue describes an attribute or a structure used in a query
+// which is not defined in the corpus
+type ValidationIssue struct {
+	Type        string   `json:"type"`
+	Name        string   `json:"name"`
+	Structure   string   `json:"structure,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+func (vi ValidationIssue) String() string {
+	var ans string
+	switch vi.Type {
+	case IssueUnknownPosAttr:
+		ans = fmt.Sprintf("unknown positional attribute %s", vi.Name)
+	case IssueUnknownStructure:
+		ans = fmt.Sprintf("unknown structure %s", vi.Name)
+	case IssueUnknownStructAttr:
+		ans = fmt.Sprintf("unknown attribute %s of structure %s", vi.Name, vi.Structure)
+	default:
+		ans = fmt.Sprintf("unknown item %s", vi.Name)
+	}
+	if len(vi.Suggestions) > 0 {
+		ans += fmt.Sprintf(" (did you mean %s?)", strings.Join(vi.Suggestions, ", "))
+	}
+	return ans
+}
+
+// ValidationResult is a result of syntactic and semantic
+// validation of a query
+type ValidationResult struct {
+	Valid       bool              `json:"valid"`
+	SyntaxError string            `json:"syntaxError,omitempty"`
+	Issues      []ValidationIssue `json:"issues"`
+}
+
+func (vr ValidationResult) String() string {
+	if vr.SyntaxError != "" {
+		return fmt.Sprintf("invalid: %s", vr.SyntaxError)
+	}
+	if len(vr.Issues) == 0 {
+		return "valid"
+	}
+	issues := make([]string, len(vr.Issues))
+	for i, v := range vr.Issues {
+		issues[i] = v.String()
+	}
+	return fmt.Sprintf("invalid: %s", strings.Join(issues, "; "))
+}
+
+// ValidateQuery checks syntax of the query and tests whether all its attributes
+// and structures are defined in the corpus
+func (cp *CorpInfoProvider) ValidateQuery(corpname, query string) (ValidationResult, error) {
+	reg, err := cp.GetRegistry(corpname)
+	if err != nil {
+		return ValidationResult{}, err
+	}
+	parsed, err := cql.ParseCQL("", query)
+	if err != nil {
+		return ValidationResult{SyntaxError: err.Error(), Issues: []ValidationIssue{}}, nil
+	}
+	issues := validateProps(reg, parsed)
+	return ValidationResult{Valid: len(issues) == 0, Issues: issues}, nil
+}
+
+// validateProps returns all the attributes and structures used
+// in the query which are not defined in the corpus registry
+func validateProps(reg *parser.Document, query *cql.Query) []ValidationIssue {
+	ans := make([]ValidationIssue, 0, 3)
+	seen := make(map[string]bool)
+	add := func(item ValidationIssue, candidates []string) {
+		key := item.Type + ":" + item.Structure + "." + item.Name
+		if !seen[key] {
+			seen[key] = true
+			item.Suggestions = suggest(item.Name, candidates)
+			ans = append(ans, item)
+		}
+	}
+	for _, prop := range query.ExtractProps() {
+		switch {
+		case prop.Structure == "" && prop.Name != "":
+			if reg.GetPosAttr(prop.Name) == nil {
+				add(
+					ValidationIssue{Type: IssueUnknownPosAttr, Name: prop.Name},
+					attrNames(reg.PosAttrs),
+				)
+			}
+		case prop.Structure != "":
+			st := reg.GetStructure(prop.Structure)
+			if st == nil {
+				structs := make([]string, len(reg.Structures))
+				for i, v := range reg.Structures {
+					structs[i] = v.Name
+				}
+				add(ValidationIssue{Type: IssueUnknownStructure, Name: prop.Structure}, structs)
+
+			} else if prop.Name != "" && st.GetAttribute(prop.Name) == nil {
+				add(
+					ValidationIssue{Type: IssueUnknownStructAttr, Name: prop.Name, Structure: prop.Structure},
+					attrNames(st.Attrs),
+				)
+			}
+		}
+	}
+	return ans
+}
+
+func attrNames(attrs []*parser.Attr) []string {
+	ans := make([]string, len(attrs))
+	for i, v := range attrs {
+		ans[i] = v.Name
+	}
+	return ans
+}
+
+// suggest finds candidates similar to the name (by edit distance)
+func suggest(name string, candidates []string) []string {
+	type scored struct {
+		value string
+		dist  int
+	}
+	maxDist := max(1, len(name)/3)
+	found := make([]scored, 0, len(candidates))
+	lname := strings.ToLower(name)
+	for _, c := range candidates {
+		lc := strings.ToLower(c)
+		d := editDistance(lname, lc)
+		if d <= maxDist || strings.HasPrefix(lc, lname) || strings.HasPrefix(lname, lc) {
+			found = append(found, scored{value: c, dist: d})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	ans := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(found) && i < maxSuggestions; i++ {
+		ans = append(ans, found[i].value)
+	}
+	return ans
+}
+
+// editDistance calculates the optimal string alignment distance of two
+// strings (i.e. Levenshtein distance with transpositions of adjacent characters)
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
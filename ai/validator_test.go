@@ -0,0 +1,80 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateQuery(t *testing.T) {
+	cp := newTestCorpInfoProvider(t)
+
+	res, err := cp.ValidateQuery("testcorp", `[lemma="dog"] [tag="N.*"] within <doc genre="fiction" />`)
+	require.NoError(t, err)
+	assert.True(t, res.Valid)
+	assert.Empty(t, res.Issues)
+	assert.Equal(t, "valid", res.String())
+
+	res, err = cp.ValidateQuery("testcorp", `[lema="dog"] [lema="cat"] within <doc yaer="2020" />`)
+	require.NoError(t, err)
+	assert.False(t, res.Valid)
+	assert.Equal(
+		t,
+		[]ValidationIssue{
+			{Type: IssueUnknownPosAttr, Name: "lema", Suggestions: []string{"lemma"}},
+			{Type: IssueUnknownStructAttr, Name: "yaer", Structure: "doc", Suggestions: []string{"year"}},
+		},
+		res.Issues,
+	)
+	assert.Equal(
+		t,
+		"invalid: unknown positional attribute lema (did you mean lemma?); "+
+			"unknown attribute yaer of structure doc (did you mean year?)",
+		res.String(),
+	)
+
+	res, err = cp.ValidateQuery("testcorp", `[word="dog"] within <sentence/>`)
+	require.NoError(t, err)
+	assert.Equal(
+		t,
+		[]ValidationIssue{{Type: IssueUnknownStructure, Name: "sentence", Suggestions: []string{"s"}}},
+		res.Issues,
+	)
+
+	res, err = cp.ValidateQuery("testcorp", `[word="dog"] within <foobar/>`)
+	require.NoError(t, err)
+	assert.Empty(t, res.Issues[0].Suggestions)
+
+	res, err = cp.ValidateQuery("testcorp", `[word=`)
+	require.NoError(t, err)
+	assert.False(t, res.Valid)
+	assert.NotEmpty(t, res.SyntaxError)
+
+	_, err = cp.ValidateQuery("missing", `[word="dog"]`)
+	assert.ErrorIs(t, err, ErrCorpusNotFound)
+}
+
+func TestEditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("lemma", "lemma"))
+	assert.Equal(t, 1, editDistance("lema", "lemma"))
+	assert.Equal(t, 1, editDistance("yaer", "year"))
+	assert.Equal(t, 3, editDistance("lemmma", "lem"))
+	assert.Equal(t, 3, editDistance("", "tag"))
+}
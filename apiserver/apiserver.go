@@ -19,15 +19,23 @@ package apiserver
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/czcorpus/cnc-gokit/logging"
 	"github.com/czcorpus/cnc-gokit/uniresp"
 	"github.com/czcorpus/cqlizer/ai"
+	"github.com/czcorpus/cqlizer/auth"
 	"github.com/czcorpus/cqlizer/cnf"
+	"github.com/czcorpus/cqlizer/corpprops"
 	"github.com/czcorpus/cqlizer/eval"
+	"github.com/czcorpus/cqlizer/feedback"
 	"github.com/czcorpus/cqlizer/monitoring"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
@@ -38,38 +46,183 @@ import (
 type apiServer struct {
 	conf          *cnf.Conf
 	server        *http.Server
-	rfEnsemble    []ensembleModel
 	version       VersionInfo
 	cqlTranslator *ai.CQLTranslator
+	corpInfo      *ai.CorpInfoProvider
+	corpProps     *corpprops.Provider
 	statusWriter  monitoring.StatusWriter
+
+	// metrics is nil in case Prometheus metrics are not enabled
+	metrics *monitoring.Metrics
+
+	// feedbackStore is nil in case feedback is not enabled
+	feedbackStore *feedback.Store
+
+	// ensemble contains the current models. It is replaced
+	// as a whole once models are reloaded.
+	ensemble   ensembleSnapshot
+	ensembleMu sync.RWMutex
+	numReloads int
+
+	// evalCache is nil in case caching is disabled
+	evalCache *evalCache
+
+	// guard is nil in case auth is disabled
+	guard *auth.Guard
 }
 
-func (api *apiServer) Start(ctx context.Context) {
-	if !api.conf.Logging.Level.IsDebugMode() {
-		gin.SetMode(gin.ReleaseMode)
+// ensembleSnapshot is a consistent set of models along with their
+// version. Each request must use a single snapshot so that predictions,
+// cached evaluations and reported votes always match the same models.
+type ensembleSnapshot struct {
+	live []ensembleModel
+
+	// shadow contains models evaluated along with the live
+	// ones but not affecting the result
+	shadow []ensembleModel
+
+	// stats collects results of the shadow models
+	stats *shadowStats
+
+	// version identifies the snapshot within evaluation cache keys
+	// (it changes with each reload, even if models versions do not)
+	version string
+}
+
+// ensembleVersion identifies a set of live and shadow models
+func ensembleVersion(live, shadow []ensembleModel) string {
+	versions := make([]string, 0, len(live)+len(shadow))
+	for _, md := range live {
+		versions = append(versions, md.version())
+	}
+	for _, md := range shadow {
+		versions = append(versions, "shadow:"+md.version())
 	}
+	return strings.Join(versions, ",")
+}
+
+// models returns a snapshot of the current models
+func (api *apiServer) models() ensembleSnapshot {
+	api.ensembleMu.RLock()
+	defer api.ensembleMu.RUnlock()
+	return api.ensemble
+}
+
+// reloadModels loads all the configured models again (e.g. after retraining)
+// and replaces the current ones. The evaluation cache is purged as models
+// may have changed even if their versions have not. In case any model
+// cannot be loaded, the current models are kept.
+func (api *apiServer) reloadModels() error {
+	live, shadow, err := loadEnsemble(api.conf, api.metrics)
+	if err != nil {
+		return err
+	}
+	api.ensembleMu.Lock()
+	api.numReloads++
+	api.ensemble = ensembleSnapshot{
+		live:    live,
+		shadow:  shadow,
+		stats:   newShadowStats(shadow),
+		version: fmt.Sprintf("%d:%s", api.numReloads, ensembleVersion(live, shadow)),
+	}
+	api.ensembleMu.Unlock()
+	// entries of the previous snapshot cannot be hit anymore
+	api.evalCache.purge()
+	log.Info().Int("numLive", len(live)).Int("numShadow", len(shadow)).Msg("models reloaded")
+	return nil
+}
+
+// watchReloadSignal reloads models each time the process receives SIGHUP
+func (api *apiServer) watchReloadSignal(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			if err := api.reloadModels(); err != nil {
+				log.Error().Err(err).Msg("failed to reload models, keeping the current ones")
+			}
+		}
+	}
+}
 
+// newEngine creates a gin engine with common middleware. Only the configured
+// proxies are trusted to provide a client IP (via X-Forwarded-For) so clients
+// cannot bypass per-IP rate limits by spoofing the header.
+func (api *apiServer) newEngine() (*gin.Engine, error) {
 	engine := gin.New()
+	if err := engine.SetTrustedProxies(api.conf.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trustedProxies: %w", err)
+	}
 	engine.Use(gin.Recovery())
 	engine.Use(logging.GinMiddleware())
+	engine.Use(api.metrics.GinMiddleware())
 	engine.Use(uniresp.AlwaysJSONContentType())
 	engine.Use(corsMiddleware(api.conf))
 	engine.NoMethod(uniresp.NoMethodHandler)
 	engine.NoRoute(uniresp.NotFoundHandler)
+	return engine, nil
+}
+
+func (api *apiServer) Start(ctx context.Context) {
+	if !api.conf.Logging.Level.IsDebugMode() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	engine, err := api.newEngine()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize HTTP server")
+		return
+	}
 
 	engine.GET("/test", api.handleTestPage)
 	engine.GET("/test-nl", api.handleNLTestPage)
-	engine.GET("/cql/:corpusId", api.handleEvalCQL)
-	engine.GET("/cql", api.handleEvalCQL)
-	engine.GET("/simple/:corpusId", api.handleEvalSimple)
-	engine.GET("/simple", api.handleEvalSimple)
-
-	engine.POST("/nl-to-cql", api.TranslateNLQueryToCQL)
-	engine.POST("/nl-to-cql/save-prompt", api.handleSaveSystemPrompt)
-	engine.GET("/nl-to-cql/load-prompt", api.handleLoadSystemPrompt)
-	engine.GET("/nl-to-cql/load-default-prompt", api.handleLoadDefaultPrompt)
-	engine.GET("/nl-to-cql/list-prompts", api.handleListPrompts)
-	engine.GET("/nl-to-cql/tools", api.handleGetTools)
+	engine.GET("/cql/:corpusId", api.guard.Require(auth.ScopeEvaluate), api.handleEvalCQL)
+	engine.GET("/cql", api.guard.Require(auth.ScopeEvaluate), api.handleEvalCQL)
+	engine.GET("/simple/:corpusId", api.guard.Require(auth.ScopeEvaluate), api.handleEvalSimple)
+	engine.GET("/simple", api.guard.Require(auth.ScopeEvaluate), api.handleEvalSimple)
+	engine.GET("/validate/:corpusId", api.guard.Require(auth.ScopeEvaluate), api.handleValidateCQL)
+	engine.GET("/corpora", api.guard.Require(auth.ScopeEvaluate), api.handleListCorpora)
+
+	engine.POST("/nl-to-cql", api.guard.Require(auth.ScopeTranslate), api.TranslateNLQueryToCQL)
+	engine.POST("/nl-to-cql/stream", api.guard.Require(auth.ScopeTranslate), api.TranslateNLQueryToCQLStream)
+	engine.GET("/nl-to-cql/load-prompt", api.guard.Require(auth.ScopeTranslate), api.handleLoadSystemPrompt)
+	engine.GET("/nl-to-cql/load-default-prompt", api.guard.Require(auth.ScopeTranslate), api.handleLoadDefaultPrompt)
+	if api.cqlTranslator.Prompts() != nil {
+		engine.POST("/nl-to-cql/save-prompt", api.guard.Require(auth.ScopeAdmin), api.handleSaveSystemPrompt)
+		engine.POST("/nl-to-cql/activate-prompt", api.guard.Require(auth.ScopeAdmin), api.handleActivatePrompt)
+		engine.GET("/nl-to-cql/list-prompts", api.guard.Require(auth.ScopeTranslate), api.handleListPrompts)
+		engine.GET("/nl-to-cql/prompt-history", api.guard.Require(auth.ScopeTranslate), api.handlePromptHistory)
+		engine.GET("/nl-to-cql/prompt-diff", api.guard.Require(auth.ScopeTranslate), api.handlePromptDiff)
+	}
+	if api.cqlTranslator.Examples() != nil {
+		engine.POST("/nl-to-cql/add-example", api.guard.Require(auth.ScopeAdmin), api.handleAddExample)
+		engine.POST("/nl-to-cql/remove-example", api.guard.Require(auth.ScopeAdmin), api.handleRemoveExample)
+		engine.GET("/nl-to-cql/list-examples", api.guard.Require(auth.ScopeTranslate), api.handleListExamples)
+		engine.GET("/nl-to-cql/search-examples", api.guard.Require(auth.ScopeTranslate), api.handleSearchExamples)
+	}
+	engine.GET("/nl-to-cql/tools", api.guard.Require(auth.ScopeTranslate), api.handleGetTools)
+	engine.GET("/nl-to-cql/backends", api.guard.Require(auth.ScopeTranslate), api.handleListBackends)
+
+	if api.feedbackStore != nil {
+		engine.POST("/feedback", api.guard.Require(auth.ScopeEvaluate), api.handleFeedback)
+	}
+
+	// shadow models may be added later by a reload
+	engine.GET("/shadow/summary", api.guard.Require(auth.ScopeAdmin), api.handleShadowSummary)
+
+	engine.POST("/models/reload", api.guard.Require(auth.ScopeAdmin), api.handleReloadModels)
+
+	if api.evalCache != nil {
+		engine.GET("/cache/stats", api.guard.Require(auth.ScopeAdmin), api.handleEvalCacheStats)
+	}
+
+	if api.metrics != nil {
+		engine.GET("/metrics", api.guard.Require(auth.ScopeAdmin), gin.WrapH(api.metrics.Handler()))
+	}
 
 	engine.GET("/version", api.handleVersion)
 
@@ -89,39 +242,124 @@ func (api *apiServer) Start(ctx context.Context) {
 
 func (api *apiServer) Stop(ctx context.Context) error {
 	log.Warn().Msg("shutting down CQLizer HTTP API server")
-	return api.server.Shutdown(ctx)
+	err := api.server.Shutdown(ctx)
+	if api.feedbackStore != nil {
+		if err := api.feedbackStore.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to close feedback store")
+		}
+	}
+	if c, ok := api.statusWriter.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to close status writer")
+		}
+	}
+	return err
 }
 
 // -------------------------
 
-func initStatusMonitoring(ctx context.Context, conf *monitoring.Conf, tz *time.Location) (statusWriter monitoring.StatusWriter) {
-	if conf != nil {
-		var err error
-		statusWriter, err = monitoring.NewTimescaleDBWriter(
-			ctx,
-			conf.DB,
-			tz,
-			func(err error) {
-				log.Error().Err(err).Msg("failed to process monitoring record")
-			},
-		)
-		if err != nil {
+func initStatusMonitoring(
+	conf *monitoring.Conf,
+	tz *time.Location,
+	metrics *monitoring.Metrics,
+) (statusWriter monitoring.StatusWriter) {
+	if conf == nil {
+		log.Warn().Msg("status writer not specified - NullStatusWriter will be used")
+		return new(monitoring.NullStatusWriter)
+	}
+	writers := make([]monitoring.StatusWriter, 0, len(conf.WriterConfs()))
+	for _, wc := range conf.WriterConfs() {
+		if err := wc.Validate(); err != nil {
 			log.Fatal().Err(err).Msg("failed to initialize status writer")
 			return
 		}
-		log.Warn().Str("host", conf.DB.Host).Msg("initialized status writer")
+		switch wc.Type {
+		case monitoring.WriterTypeTimescaleDB:
+			w, err := monitoring.NewTimescaleDBWriter(conf, tz)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to initialize status writer")
+				return
+			}
+			w.Start()
+			metrics.RegisterStatusQueue(monitoring.WriterTypeTimescaleDB, w)
+			writers = append(writers, w)
+			log.Warn().Str("host", conf.DB.Host).Msg("initialized TimescaleDB status writer")
+		case monitoring.WriterTypeJSONL:
+			writers = append(writers, monitoring.NewJSONLFileWriter(wc, tz))
+			log.Warn().Str("path", wc.Path).Msg("initialized JSONL status writer")
+		case monitoring.WriterTypeStdout:
+			writers = append(writers, monitoring.NewStdoutWriter(tz))
+			log.Warn().Msg("initialized stdout status writer")
+		}
+	}
+	if len(writers) == 1 {
+		return writers[0]
+	}
+	return monitoring.NewMultiWriter(writers...)
+}
 
-	} else {
-		log.Warn().Msg("status writer not specified - NullStatusWriter will be used")
-		statusWriter = new(monitoring.NullStatusWriter)
+// loadEnsemble loads all the enabled models of the configured ensemble
+func loadEnsemble(conf *cnf.Conf, metrics *monitoring.Metrics) (live, shadow []ensembleModel, err error) {
+	live = make([]ensembleModel, 0, len(conf.RFEnsemble))
+	for _, rfc := range conf.RFEnsemble {
+		if rfc.Disabled {
+			continue
+		}
+		mlModel, err := eval.GetMLModel(rfc.ModelType, rfc.ModelPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load model %s: %w", rfc.ModelPath, err)
+		}
+		mlModel.SetClassThreshold(rfc.VoteThreshold)
+
+		log.Info().
+			Float64("voteThreshold", rfc.VoteThreshold).
+			Str("type", rfc.ModelType).
+			Str("file", rfc.ModelPath).
+			Bool("shadow", rfc.Shadow).
+			Msg("loaded model")
+		metrics.SetModelInfo(rfc.ModelPath, rfc.ModelType, rfc.Shadow, time.Now())
+		md := ensembleModel{
+			model:     mlModel,
+			srcPath:   rfc.ModelPath,
+			modelType: rfc.ModelType,
+			threshold: rfc.VoteThreshold,
+		}
+		if rfc.Shadow {
+			shadow = append(shadow, md)
+
+		} else {
+			live = append(live, md)
+		}
 	}
-	return
+	return live, shadow, nil
+}
+
+// NewCostEstimator creates a query cost estimator based on the configured
+// live ensemble without running the API server (e.g. for offline evaluation).
+// In case no model is enabled, nil is returned. Corpora properties
+// are loaded just once.
+func NewCostEstimator(
+	ctx context.Context,
+	conf *cnf.Conf,
+	corpInfo *ai.CorpInfoProvider,
+) (ai.CostEstimator, error) {
+	live, _, err := loadEnsemble(conf, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(live) == 0 {
+		return nil, nil
+	}
+	corpProps := corpprops.NewProvider(conf.CorporaPropsSources, conf.CorporaProps, corpInfo)
+	corpProps.Refresh(ctx)
+	return &apiServer{conf: conf, ensemble: ensembleSnapshot{live: live}, corpProps: corpProps}, nil
 }
 
 func Run(
 	ctx context.Context,
 	conf *cnf.Conf,
 	cqlTranslator *ai.CQLTranslator,
+	corpInfo *ai.CorpInfoProvider,
 	version VersionInfo,
 ) {
 
@@ -133,36 +371,56 @@ func Run(
 
 	server := &apiServer{
 		conf:          conf,
-		rfEnsemble:    make([]ensembleModel, 0, len(conf.RFEnsemble)),
 		cqlTranslator: cqlTranslator,
+		corpInfo:      corpInfo,
 		version:       version,
-		statusWriter:  initStatusMonitoring(ctx, conf.Monitoring, tz),
 	}
 
-	for _, rfc := range conf.RFEnsemble {
-		if rfc.Disabled {
-			continue
-		}
-		mlModel, err := eval.GetMLModel(rfc.ModelType, rfc.ModelPath)
+	// properties are loaded in the background so a slow source cannot
+	// delay the startup (configured corporaProps are available immediately)
+	server.corpProps = corpprops.NewProvider(conf.CorporaPropsSources, conf.CorporaProps, corpInfo)
+	go server.corpProps.Run(ctx)
+
+	server.guard = auth.NewGuard(conf.Auth)
+	if server.guard != nil {
+		log.Info().Int("numKeys", len(conf.Auth.Keys)).Msg("enabled API authentication")
+	}
+
+	if conf.MetricsEnabled {
+		server.metrics = monitoring.NewMetrics()
+		log.Info().Msg("enabled Prometheus metrics")
+	}
+	server.statusWriter = initStatusMonitoring(conf.Monitoring, tz, server.metrics)
+
+	if conf.FeedbackStorePath != "" {
+		server.feedbackStore, err = feedback.NewStore(conf.FeedbackStorePath)
 		if err != nil {
-			log.Fatal().Err(err).Msg("Error loading RF model")
+			log.Fatal().Err(err).Msg("failed to initialize feedback store")
 			return
 		}
-		mlModel.SetClassThreshold(rfc.VoteThreshold)
+		log.Info().Str("path", conf.FeedbackStorePath).Msg("enabled query feedback")
+	}
 
-		log.Info().
-			Float64("voteThreshold", rfc.VoteThreshold).
-			Str("type", rfc.ModelType).
-			Str("file", rfc.ModelPath).
-			Msg("loaded model")
-		server.rfEnsemble = append(
-			server.rfEnsemble,
-			ensembleModel{
-				model:     mlModel,
-				srcPath:   rfc.ModelPath,
-				threshold: rfc.VoteThreshold,
-			},
+	if conf.EvalCache != nil && conf.EvalCache.MaxItems > 0 {
+		server.evalCache = newEvalCache(
+			conf.EvalCache.MaxItems,
+			time.Duration(conf.EvalCache.TTLSecs)*time.Second,
 		)
+		server.metrics.RegisterEvalCache(server.evalCache)
+		log.Info().
+			Int("maxItems", conf.EvalCache.MaxItems).
+			Int("ttlSecs", conf.EvalCache.TTLSecs).
+			Msg("enabled evaluation cache")
+	}
+
+	if err := server.reloadModels(); err != nil {
+		log.Fatal().Err(err).Msg("Error loading RF model")
+		return
+	}
+	go server.watchReloadSignal(ctx)
+
+	if len(server.models().live) > 0 {
+		cqlTranslator.SetCostEstimator(server, conf.AI.MaxRevisions)
 	}
 
 	services := []service{server}
@@ -0,0 +1,112 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/czcorpus/cqlizer/ai"
+	"github.com/czcorpus/cqlizer/auth"
+	"github.com/czcorpus/cqlizer/cnf"
+	"github.com/czcorpus/cqlizer/corpprops"
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRateLimitedTestEngine(t *testing.T, trustedProxies []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	api := &apiServer{conf: &cnf.Conf{TrustedProxies: trustedProxies}}
+	engine, err := api.newEngine()
+	require.NoError(t, err)
+	guard := auth.NewGuard(&auth.Conf{
+		AnonymousScopes: []string{auth.ScopeTranslate},
+		IPRateLimits:    map[string]auth.RateLimitConf{auth.ScopeTranslate: {RequestsPerSec: 0.001, Burst: 1}},
+	})
+	engine.POST("/nl-to-cql", guard.Require(auth.ScopeTranslate), func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, "ok")
+	})
+	return engine
+}
+
+func requestWithForwardedFor(engine *gin.Engine, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodPost, "/nl-to-cql", nil)
+	req.RemoteAddr = "192.0.2.10:40000"
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestSpoofedForwardedForDoesNotBypassRateLimit(t *testing.T) {
+	engine := newRateLimitedTestEngine(t, nil)
+	assert.Equal(t, http.StatusOK, requestWithForwardedFor(engine, "203.0.113.1"))
+	assert.Equal(t, http.StatusTooManyRequests, requestWithForwardedFor(engine, "203.0.113.2"))
+}
+
+func TestTrustedProxyForwardsClientIP(t *testing.T) {
+	engine := newRateLimitedTestEngine(t, []string{"192.0.2.10"})
+	assert.Equal(t, http.StatusOK, requestWithForwardedFor(engine, "203.0.113.1"))
+	assert.Equal(t, http.StatusOK, requestWithForwardedFor(engine, "203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, requestWithForwardedFor(engine, "203.0.113.2"))
+}
+
+func TestInvalidTrustedProxies(t *testing.T) {
+	api := &apiServer{conf: &cnf.Conf{TrustedProxies: []string{"not-an-ip"}}}
+	_, err := api.newEngine()
+	assert.Error(t, err)
+}
+
+func listCorpora(t *testing.T, registryDir string) string {
+	gin.SetMode(gin.TestMode)
+	corpProps := corpprops.NewProvider(nil, map[string]feats.CorpusProps{
+		"syn2020": {Size: 121826797, Lang: "cs"},
+		"other":   {Size: 500, Lang: "en"},
+	}, nil)
+	corpProps.Refresh(t.Context())
+	api := &apiServer{corpInfo: ai.NewCorpInfoProvider(registryDir), corpProps: corpProps}
+	engine := gin.New()
+	engine.GET("/corpora", api.handleListCorpora)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/corpora", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestListCorporaUsesCorporaProps(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "syn2020"), []byte("NAME \"SYN2020\"\nLANGUAGE \"Czech\"\nATTRIBUTE word\n"), 0644))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "other"), []byte("NAME \"Other\"\nSIZE \"1200\"\nATTRIBUTE word\n"), 0644))
+	assert.JSONEq(
+		t,
+		`{"corpora": [
+			{"id": "other", "name": "Other", "lang": "en", "size": 1200},
+			{"id": "syn2020", "name": "SYN2020", "lang": "Czech", "size": 121826797}
+		]}`,
+		listCorpora(t, dir),
+	)
+}
+
+func TestListCorporaWithoutRegistryDir(t *testing.T) {
+	assert.JSONEq(t, `{"corpora": []}`, listCorpora(t, ""))
+}
@@ -18,14 +18,22 @@ package apiserver
 
 import (
 	"context"
+	"math"
+	"path/filepath"
 
 	"github.com/czcorpus/cqlizer/cnf"
 	"github.com/czcorpus/cqlizer/eval"
 	"github.com/czcorpus/cqlizer/eval/feats"
 	"github.com/czcorpus/cqlizer/eval/predict"
+	"github.com/czcorpus/cqlizer/monitoring"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// dfltCorpusSize is used for queries without a specified corpus
+	dfltCorpusSize = 1000000000
+)
+
 // VersionInfo provides a detailed information about the actual build
 type VersionInfo struct {
 	Version   string `json:"version"`
@@ -56,6 +64,23 @@ type vote struct {
 	Result int       `json:"result"`
 }
 
+// slowVote returns the "slow query" probability of the vote
+func (v vote) slowVote() float64 {
+	if len(v.Votes) < 2 {
+		return 0
+	}
+	return v.Votes[1]
+}
+
+func (v vote) asModelVote(md ensembleModel, isShadow bool) monitoring.ModelVote {
+	return monitoring.ModelVote{
+		Model:    md.version(),
+		SlowVote: v.slowVote(),
+		Result:   v.Result,
+		IsShadow: isShadow,
+	}
+}
+
 // -------
 
 type voteList []vote
@@ -79,18 +104,54 @@ func (vl voteList) avgCertainty() (ct float64) {
 	return ct / float64(len(vl))
 }
 
+// isSlowQuery applies the majority rule to the votes
+func (vl voteList) isSlowQuery() bool {
+	var votesFor int
+	for _, v := range vl {
+		votesFor += v.Result
+	}
+	return votesFor > int(math.Floor(float64(len(vl))/2))
+}
+
 // ------
 
 type ensembleModel struct {
 	model     eval.MLModel
 	srcPath   string
+	modelType string
 	threshold float64
 }
 
+// version identifies the model by its file name and, if available,
+// by its training time (a retrained model may keep the file name)
+func (md ensembleModel) version() string {
+	name := filepath.Base(md.srcPath)
+	if mf := md.model.GetManifest(); !mf.IsZero() {
+		return name + "@" + mf.TrainedAt
+	}
+	return name
+}
+
 func (md ensembleModel) Predict(queryEval feats.QueryEvaluation) predict.Prediction {
 	return md.model.Predict(queryEval)
 }
 
+// predictWithEnsemble collects votes of all the models
+func predictWithEnsemble(models []ensembleModel, queryEval feats.QueryEvaluation) voteList {
+	ans := make(voteList, 0, len(models))
+	for _, md := range models {
+		pr := md.Predict(queryEval)
+		ans = append(
+			ans,
+			vote{
+				Votes:  pr.Votes,
+				Result: pr.PredictedClass,
+			},
+		)
+	}
+	return ans
+}
+
 // -----
 
 func corsMiddleware(conf *cnf.Conf) gin.HandlerFunc {
@@ -109,7 +170,7 @@ func corsMiddleware(conf *cnf.Conf) gin.HandlerFunc {
 			ctx.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 			ctx.Writer.Header().Set(
 				"Access-Control-Allow-Headers",
-				"Content-Type, Content-Length, Accept-Encoding, Authorization, Accept, Origin, Cache-Control, X-Requested-With",
+				"Content-Type, Content-Length, Accept-Encoding, Authorization, X-API-Key, Accept, Origin, Cache-Control, X-Requested-With",
 			)
 			ctx.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 		}
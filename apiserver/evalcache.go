@@ -0,0 +1,215 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiserver
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/gin-gonic/gin"
+)
+
+// cachedEvaluation contains everything needed to respond to
+// a repeated query without parsing and scoring it again
+type cachedEvaluation struct {
+	queryEval         feats.QueryEvaluation
+	predictions       voteList
+	shadowPredictions voteList
+}
+
+type evalCacheItem struct {
+	key      string
+	value    cachedEvaluation
+	storedAt time.Time
+}
+
+type evalCacheStats struct {
+	Size      int     `json:"size"`
+	MaxItems  int     `json:"maxItems"`
+	NumHits   int64   `json:"numHits"`
+	NumMisses int64   `json:"numMisses"`
+	HitRatio  float64 `json:"hitRatio"`
+}
+
+// evalCache is an LRU cache of query evaluations with a TTL.
+// All the methods can be called on a nil instance (= disabled cache).
+type evalCache struct {
+	mu        sync.Mutex
+	maxItems  int
+	ttl       time.Duration
+	items     map[string]*list.Element
+	order     *list.List
+	numHits   int64
+	numMisses int64
+}
+
+func (ec *evalCache) get(key string) (cachedEvaluation, bool) {
+	if ec == nil {
+		return cachedEvaluation{}, false
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	elm, ok := ec.items[key]
+	if !ok {
+		ec.numMisses++
+		return cachedEvaluation{}, false
+	}
+	item := elm.Value.(*evalCacheItem)
+	if ec.ttl > 0 && time.Since(item.storedAt) > ec.ttl {
+		ec.order.Remove(elm)
+		delete(ec.items, key)
+		ec.numMisses++
+		return cachedEvaluation{}, false
+	}
+	ec.order.MoveToFront(elm)
+	ec.numHits++
+	return item.value, true
+}
+
+func (ec *evalCache) put(key string, value cachedEvaluation) {
+	if ec == nil {
+		return
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	if elm, ok := ec.items[key]; ok {
+		item := elm.Value.(*evalCacheItem)
+		item.value = value
+		item.storedAt = time.Now()
+		ec.order.MoveToFront(elm)
+		return
+	}
+	ec.items[key] = ec.order.PushFront(&evalCacheItem{key: key, value: value, storedAt: time.Now()})
+	for ec.order.Len() > ec.maxItems {
+		oldest := ec.order.Back()
+		ec.order.Remove(oldest)
+		delete(ec.items, oldest.Value.(*evalCacheItem).key)
+	}
+}
+
+func (ec *evalCache) purge() {
+	if ec == nil {
+		return
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.items = make(map[string]*list.Element)
+	ec.order.Init()
+}
+
+func (ec *evalCache) NumHits() int64 {
+	if ec == nil {
+		return 0
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	return ec.numHits
+}
+
+func (ec *evalCache) NumMisses() int64 {
+	if ec == nil {
+		return 0
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	return ec.numMisses
+}
+
+func (ec *evalCache) Len() int {
+	if ec == nil {
+		return 0
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	return ec.order.Len()
+}
+
+func (ec *evalCache) stats() evalCacheStats {
+	if ec == nil {
+		return evalCacheStats{}
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ans := evalCacheStats{
+		Size:      ec.order.Len(),
+		MaxItems:  ec.maxItems,
+		NumHits:   ec.numHits,
+		NumMisses: ec.numMisses,
+	}
+	if total := ec.numHits + ec.numMisses; total > 0 {
+		ans.HitRatio = float64(ec.numHits) / float64(total)
+	}
+	return ans
+}
+
+// key creates a cache key of a query evaluated by models of the
+// ensemble version ensVersion (see ensembleSnapshot)
+func (ec *evalCache) key(q, corpname string, corpusSize int, lang, ensVersion string) string {
+	return fmt.Sprintf(
+		"%s\x00%s\x00%d\x00%s\x00%s",
+		normalizeQuery(q), corpname, corpusSize, lang, ensVersion,
+	)
+}
+
+func newEvalCache(maxItems int, ttl time.Duration) *evalCache {
+	return &evalCache{
+		maxItems: maxItems,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// normalizeQuery removes leading/trailing whitespaces and collapses
+// other whitespace sequences outside of quoted strings into a single space
+func normalizeQuery(q string) string {
+	var ans strings.Builder
+	var inQuotes, escaped, pendingSpace bool
+	for _, c := range strings.TrimSpace(q) {
+		if !inQuotes && unicode.IsSpace(c) {
+			pendingSpace = true
+			continue
+		}
+		if pendingSpace {
+			ans.WriteRune(' ')
+			pendingSpace = false
+		}
+		ans.WriteRune(c)
+		if escaped {
+			escaped = false
+
+		} else if c == '\\' {
+			escaped = true
+
+		} else if c == '"' {
+			inQuotes = !inQuotes
+		}
+	}
+	return ans.String()
+}
+
+// -----
+
+func (api *apiServer) handleEvalCacheStats(ctx *gin.Context) {
+	uniresp.WriteJSONResponse(ctx.Writer, api.evalCache.stats())
+}
@@ -0,0 +1,189 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/cqlizer/cnf"
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/czcorpus/cqlizer/monitoring"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	assert.Equal(t, `[word="a  b"] []{2} [lemma="x"]`, normalizeQuery("  [word=\"a  b\"]\n  []{2}\t[lemma=\"x\"] "))
+	assert.Equal(t, `[word="a\"  b"] [tag="N.*"]`, normalizeQuery(`[word="a\"  b"]   [tag="N.*"]`))
+}
+
+func TestEvalCacheLRU(t *testing.T) {
+	ec := newEvalCache(2, 0)
+	ec.put("a", cachedEvaluation{predictions: voteList{{Result: 1}}})
+	ec.put("b", cachedEvaluation{})
+	_, ok := ec.get("a") // "a" becomes the most recently used one
+	assert.True(t, ok)
+	ec.put("c", cachedEvaluation{})
+	_, ok = ec.get("b")
+	assert.False(t, ok)
+	v, ok := ec.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v.predictions[0].Result)
+	st := ec.stats()
+	assert.Equal(t, 2, st.Size)
+	assert.Equal(t, int64(2), st.NumHits)
+	assert.Equal(t, int64(1), st.NumMisses)
+}
+
+func TestEvalCacheTTL(t *testing.T) {
+	ec := newEvalCache(10, time.Millisecond)
+	ec.put("a", cachedEvaluation{})
+	time.Sleep(5 * time.Millisecond)
+	_, ok := ec.get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, ec.Len())
+}
+
+func TestEvalCacheKeyContainsEnsembleVersion(t *testing.T) {
+	ec := newEvalCache(10, 0)
+	k1 := ec.key("[word=\"x\"]", "syn", 100, "en", "1:m1")
+	assert.Equal(t, k1, ec.key("[word=\"x\"]", "syn", 100, "en", "1:m1"))
+	assert.NotEqual(t, k1, ec.key("[word=\"x\"]", "syn", 100, "en", "2:m1"))
+}
+
+func TestReloadModelsPurgesEvalCache(t *testing.T) {
+	conf := &cnf.Conf{
+		RFEnsemble: []cnf.RFEnsembleConf{
+			{ModelType: "ym", ModelPath: "m1.model", VoteThreshold: 0.5},
+			{ModelType: "ym", ModelPath: "s1.model", VoteThreshold: 0.5, Shadow: true},
+		},
+	}
+	api := &apiServer{conf: conf, evalCache: newEvalCache(10, 0)}
+	assert.NoError(t, api.reloadModels())
+	assert.Equal(t, "1:m1.model,shadow:s1.model", api.models().version)
+
+	corpus := feats.CorpusProps{Size: 1000000, Lang: "en"}
+	cached, err := api.evaluateQuery(api.models(), `[word="x"]`, "syn", corpus)
+	assert.NoError(t, err)
+	assert.Len(t, cached.predictions, 1)
+	assert.Len(t, cached.shadowPredictions, 1)
+	assert.Equal(t, 1, api.evalCache.Len())
+
+	// a failed reload keeps the current models and cache
+	conf.RFEnsemble[0].ModelType = "unknown"
+	assert.Error(t, api.reloadModels())
+	assert.Len(t, api.models().live, 1)
+	assert.Equal(t, 1, api.evalCache.Len())
+
+	conf.RFEnsemble[0] = cnf.RFEnsembleConf{ModelType: "ym", ModelPath: "m2.model", VoteThreshold: 0.5}
+	assert.NoError(t, api.reloadModels())
+	assert.Equal(t, 0, api.evalCache.Len())
+	assert.Equal(t, "2:m2.model,shadow:s1.model", api.models().version)
+	assert.Equal(t, "m2.model", api.models().live[0].srcPath)
+
+	// reloading the same models (e.g. replaced files without manifest) purges the cache too
+	snapshot := api.models()
+	_, err = api.evaluateQuery(snapshot, `[word="x"]`, "syn", corpus)
+	assert.NoError(t, err)
+	assert.NoError(t, api.reloadModels())
+	assert.Equal(t, 0, api.evalCache.Len())
+
+	// a request still using the previous snapshot cannot hit
+	// entries of the new one and vice versa
+	_, err = api.evaluateQuery(snapshot, `[word="x"]`, "syn", corpus)
+	assert.NoError(t, err)
+	_, ok := api.evalCache.get(api.evalCache.key(`[word="x"]`, "syn", corpus.Size, corpus.Lang, api.models().version))
+	assert.False(t, ok)
+}
+
+type recordingStatusWriter struct {
+	mu      sync.Mutex
+	reports []monitoring.VoteReport
+}
+
+func (w *recordingStatusWriter) Write(rec monitoring.VoteReport) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.reports = append(w.reports, rec)
+}
+
+func TestReloadToDifferentModelCountBetweenRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conf := &cnf.Conf{
+		RFEnsemble: []cnf.RFEnsembleConf{
+			{ModelType: "ym", ModelPath: "m1.model", VoteThreshold: 0.5},
+		},
+	}
+	writer := &recordingStatusWriter{}
+	api := &apiServer{conf: conf, evalCache: newEvalCache(10, 0), statusWriter: writer}
+	require.NoError(t, api.reloadModels())
+	engine := gin.New()
+	engine.GET("/cql", api.handleEvalCQL)
+	evaluate := func() int {
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, `/cql?q=[word="x"]&corpusSize=1000000`, nil))
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, evaluate())
+
+	conf.RFEnsemble = []cnf.RFEnsembleConf{
+		{ModelType: "ym", ModelPath: "m1.model", VoteThreshold: 0.5},
+		{ModelType: "ym", ModelPath: "m2.model", VoteThreshold: 0.5},
+		{ModelType: "ym", ModelPath: "s1.model", VoteThreshold: 0.5, Shadow: true},
+	}
+	// requests running along with the reload use a single snapshot each
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, http.StatusOK, evaluate())
+		}()
+	}
+	require.NoError(t, api.reloadModels())
+	wg.Wait()
+	assert.Equal(t, http.StatusOK, evaluate())
+
+	conf.RFEnsemble = conf.RFEnsemble[:1]
+	require.NoError(t, api.reloadModels())
+	assert.Equal(t, http.StatusOK, evaluate())
+
+	writer.mu.Lock()
+	defer writer.mu.Unlock()
+	for _, rep := range writer.reports {
+		assert.Equal(t, len(rep.ModelVersions), rep.VotesFor+rep.VotesAgainst)
+	}
+	last := writer.reports[len(writer.reports)-1]
+	assert.Len(t, last.ModelVersions, 1)
+	assert.Len(t, last.ModelVotes, 1)
+}
+
+func TestNilEvalCache(t *testing.T) {
+	var ec *evalCache
+	ec.put("a", cachedEvaluation{})
+	_, ok := ec.get("a")
+	assert.False(t, ok)
+	ec.purge()
+	assert.Equal(t, evalCacheStats{}, ec.stats())
+	assert.Equal(t, fmt.Sprintf("%s\x00%s\x00%d\x00%s\x00%s", "q", "c", 1, "en", "v"), ec.key("q", "c", 1, "en", "v"))
+}
@@ -17,19 +17,27 @@
 package apiserver
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"math"
 	"net/http"
-	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/czcorpus/cnc-gokit/unireq"
 	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/cqlizer/ai"
+	"github.com/czcorpus/cqlizer/ai/examples"
+	"github.com/czcorpus/cqlizer/ai/prompts"
+	"github.com/czcorpus/cqlizer/auth"
 	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/czcorpus/cqlizer/feedback"
 	"github.com/czcorpus/cqlizer/monitoring"
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 )
 
 func (api *apiServer) handleVersion(ctx *gin.Context) {
@@ -53,17 +61,72 @@ func (api *apiServer) handleEvalCQL(ctx *gin.Context) {
 	api.evaluateRawQuery(ctx, q)
 }
 
+// evaluateQuery obtains predictions of all the models of the snapshot
+// for the query (either from the cache or by evaluating them)
+func (api *apiServer) evaluateQuery(
+	models ensembleSnapshot,
+	q string,
+	corpname string,
+	corpusInfo feats.CorpusProps,
+) (cachedEvaluation, error) {
+	cacheKey := api.evalCache.key(q, corpname, corpusInfo.Size, corpusInfo.Lang, models.version)
+	cached, ok := api.evalCache.get(cacheKey)
+	if ok {
+		return cached, nil
+	}
+	charProb := feats.GetCharProbabilityProvider(corpusInfo.Lang)
+	queryEval, err := feats.NewQueryEvaluation(q, float64(corpusInfo.Size), 0, 3, charProb)
+	if err != nil {
+		return cachedEvaluation{}, err
+	}
+	cached = cachedEvaluation{
+		queryEval:         queryEval,
+		predictions:       predictWithEnsemble(models.live, queryEval),
+		shadowPredictions: predictWithEnsemble(models.shadow, queryEval),
+	}
+	api.evalCache.put(cacheKey, cached)
+	return cached, nil
+}
+
+// EstimateQueryCost implements ai.CostEstimator using the live ensemble
+func (api *apiServer) EstimateQueryCost(q, corpname string) (ai.CostEstimate, error) {
+	corpusInfo := feats.CorpusProps{Size: dfltCorpusSize}
+	if corpname != "" {
+		var ok bool
+		corpusInfo, ok = api.corpProps.Get(corpname)
+		if !ok {
+			return ai.CostEstimate{}, fmt.Errorf("unknown corpus %s", corpname)
+		}
+	}
+	cached, err := api.evaluateQuery(api.models(), q, corpname, corpusInfo)
+	if err != nil {
+		return ai.CostEstimate{}, err
+	}
+	vf, va := cached.predictions.forAndAgainst()
+	return ai.CostEstimate{
+		Corpname:     corpname,
+		CorpusSize:   corpusInfo.Size,
+		IsSlow:       cached.predictions.isSlowQuery(),
+		VotesFor:     vf,
+		VotesAgainst: va,
+	}, nil
+}
+
 func (api *apiServer) evaluateRawQuery(ctx *gin.Context, q string) {
 	corpname := ctx.Param("corpusId")
 	//aligned := ctx.QueryArray("aligned")
 	var corpusInfo feats.CorpusProps
 	var ok bool
-	var voteReport monitoring.VoteReport
+	voteReport := monitoring.VoteReport{QueryHash: queryHash(q)}
+	t0 := time.Now()
 
-	defer func() { api.statusWriter.Write(voteReport) }()
+	defer func() {
+		voteReport.LatencyMs = float64(time.Since(t0).Microseconds()) / 1000
+		api.statusWriter.Write(voteReport)
+	}()
 
 	if corpname != "" {
-		corpusInfo, ok = api.conf.CorporaProps[corpname]
+		corpusInfo, ok = api.corpProps.Get(corpname)
 
 		if !ok {
 			voteReport.IsError = true
@@ -82,44 +145,36 @@ func (api *apiServer) evaluateRawQuery(ctx *gin.Context, q string) {
 		}
 
 	} else {
-		corpusInfo.Size, ok = unireq.GetURLIntArgOrFail(ctx, "corpusSize", 1000000000)
+		corpusInfo.Size, ok = unireq.GetURLIntArgOrFail(ctx, "corpusSize", dfltCorpusSize)
 		if !ok {
 			voteReport.IsError = true
 			return
 		}
 		corpusInfo.Lang = ctx.Query("lang")
 	}
-	charProb := feats.GetCharProbabilityProvider(corpusInfo.Lang)
-	queryEval, err := feats.NewQueryEvaluation(q, float64(corpusInfo.Size), 0, 3, charProb)
+	models := api.models()
+	cached, err := api.evaluateQuery(models, q, corpname, corpusInfo)
 	if err != nil {
 		voteReport.IsError = true
+		api.metrics.ObserveParseError()
 		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
 		return
 	}
-	predictions := make(voteList, 0, len(api.rfEnsemble))
-	for _, md := range api.rfEnsemble {
-		pr := md.Predict(queryEval)
-		predictions = append(
-			predictions,
-			vote{
-				Votes:  pr.Votes,
-				Result: pr.PredictedClass,
-			},
-		)
-	}
+	predictions := cached.predictions
 
-	var votesFor int
-	for _, pred := range predictions {
-		votesFor += pred.Result
-	}
 	resp := evaluation{
 		CorpusSize:  corpusInfo.Size,
 		Votes:       predictions,
-		IsSlowQuery: votesFor > int(math.Floor(float64(len(api.rfEnsemble))/2)),
+		IsSlowQuery: predictions.isSlowQuery(),
 		AltCorpus:   corpusInfo.AltCorpus,
 	}
 
 	uniresp.WriteJSONResponse(ctx.Writer, resp)
+	api.metrics.ObserveDecision(corpname, resp.IsSlowQuery)
+
+	if len(models.shadow) > 0 {
+		api.compareShadowModels(models.stats, q, corpname, corpusInfo.Size, predictions, cached.shadowPredictions)
+	}
 
 	vf, va := predictions.forAndAgainst()
 	avgCrt := predictions.avgCertainty()
@@ -127,11 +182,138 @@ func (api *apiServer) evaluateRawQuery(ctx *gin.Context, q string) {
 	voteReport.VotesAgainst = va
 	voteReport.AvgCertainty = avgCrt
 	voteReport.Corpus = corpname
+	voteReport.ModelVersions = make([]string, len(models.live))
+	voteReport.ModelVotes = make([]monitoring.ModelVote, 0, len(predictions)+len(cached.shadowPredictions))
+	for i, md := range models.live {
+		api.metrics.ObserveModelVote(md.srcPath, predictions[i].slowVote())
+		voteReport.ModelVersions[i] = md.version()
+		voteReport.ModelVotes = append(voteReport.ModelVotes, predictions[i].asModelVote(md, false))
+	}
+	for i, md := range models.shadow {
+		api.metrics.ObserveModelVote(md.srcPath, cached.shadowPredictions[i].slowVote())
+		voteReport.ModelVotes = append(voteReport.ModelVotes, cached.shadowPredictions[i].asModelVote(md, true))
+	}
+	voteReport.Features = monitoring.NewQueryFeatures(cached.queryEval, corpusInfo.Size)
+}
+
+func queryHash(q string) string {
+	h := sha256.Sum256([]byte(q))
+	return hex.EncodeToString(h[:])
+}
+
+// handleFeedback stores an actual processing time of a query
+// so it can be used later for retraining.
+func (api *apiServer) handleFeedback(ctx *gin.Context) {
+	var rec feedback.Record
+	if err := ctx.BindJSON(&rec); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("invalid request: %w", err), http.StatusBadRequest)
+		return
+	}
+	if rec.Corpus != "" && rec.CorpusSize == 0 {
+		corpusInfo, ok := api.corpProps.Get(rec.Corpus)
+		if !ok {
+			uniresp.RespondWithErrorJSON(
+				ctx, fmt.Errorf("corpus not found"), http.StatusNotFound,
+			)
+			return
+		}
+		rec.CorpusSize = int64(corpusInfo.Size)
+	}
+	if err := rec.Validate(); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("invalid feedback: %w", err), http.StatusBadRequest)
+		return
+	}
+	rec.Time = time.Now()
+	if err := api.feedbackStore.Add(rec); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"ok": true})
+}
+
+// handleValidateCQL checks whether the query uses only attributes
+// and structures defined in the corpus
+func (api *apiServer) handleValidateCQL(ctx *gin.Context) {
+	q := ctx.Query("q")
+	if q == "" {
+		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("missing query"), http.StatusBadRequest)
+		return
+	}
+	ans, err := api.corpInfo.ValidateQuery(ctx.Param("corpusId"), q)
+	if errors.Is(err, ai.ErrCorpusNotFound) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, ans)
+}
+
+// handleReloadModels loads all the configured models again
+// (e.g. after their files have been replaced by retraining)
+func (api *apiServer) handleReloadModels(ctx *gin.Context) {
+	if err := api.reloadModels(); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	models := api.models()
+	resp := map[string]any{
+		"ok":      true,
+		"version": ensembleVersion(models.live, models.shadow),
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, resp)
+}
+
+// handleListCorpora lists corpora with a registry file. Missing sizes
+// and languages (standard registries contain no size) are taken
+// from the corpora properties.
+func (api *apiServer) handleListCorpora(ctx *gin.Context) {
+	corpora, err := api.corpInfo.ListCorpora()
+	if errors.Is(err, ai.ErrNoRegistryDir) {
+		corpora = []ai.CorpusInfo{}
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	for i, corp := range corpora {
+		props, ok := api.corpProps.Get(corp.ID)
+		if !ok {
+			continue
+		}
+		if corp.Size == 0 {
+			corpora[i].Size = props.Size
+		}
+		if corp.Lang == "" {
+			corpora[i].Lang = props.Lang
+		}
+	}
+	resp := map[string]any{
+		"corpora": corpora,
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, resp)
 }
 
 type nlToCQLRequest struct {
 	UserInput    string `json:"userInput"`
 	SystemPrompt string `json:"systemPrompt"`
+
+	// Corpname is optional. If specified, the translator gets
+	// the corpus' attributes and validates the query against them.
+	Corpname string `json:"corpname"`
+
+	// Backend is optional. If specified, the LLM backend is tried first
+	// and the other ones serve as fallbacks.
+	Backend string `json:"backend"`
+}
+
+type nlToCQLResponse struct {
+	// Response is the final query (kept for compatibility with older clients)
+	Response string `json:"response"`
+	Error    string `json:"error,omitempty"`
+	ai.TranslationResult
 }
 
 func (api *apiServer) TranslateNLQueryToCQL(ctx *gin.Context) {
@@ -143,26 +325,118 @@ func (api *apiServer) TranslateNLQueryToCQL(ctx *gin.Context) {
 
 	// If system prompt is provided in the request, use it temporarily
 	// Otherwise, use the default from the translator
-	var resp string
+	var resp ai.TranslationResult
 	var err error
+	t0 := time.Now()
 	if req.SystemPrompt != "" {
-		resp, err = api.cqlTranslator.TranslateToCQLWithPrompt(ctx, req.UserInput, req.SystemPrompt)
+		resp, err = api.cqlTranslator.TranslateToCQLWithPrompt(
+			ctx.Request.Context(), req.UserInput, req.Corpname, req.SystemPrompt, req.Backend)
 
 	} else {
-		resp, err = api.cqlTranslator.TranslateToCQL(ctx, req.UserInput)
+		resp, err = api.cqlTranslator.TranslateToCQL(
+			ctx.Request.Context(), req.UserInput, req.Corpname, req.Backend)
 	}
+	api.metrics.ObserveLLMTranslation(time.Since(t0), err)
 
-	if err != nil {
+	if errors.Is(err, ai.ErrCorpusNotFound) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+
+	} else if errors.Is(err, ai.ErrUnknownBackend) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+
+	} else if err != nil {
 		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
 		return
 	}
-	ans := map[string]any{"response": resp}
+	ans := nlToCQLResponse{Response: resp.Query, TranslationResult: resp}
+	if resp.Rejected && api.conf.AI.RejectSlowQueries {
+		ans.Error = "failed to generate a valid query which is not predicted to be slow"
+		uniresp.WriteJSONResponseWithStatus(ctx.Writer, http.StatusUnprocessableEntity, ans)
+		return
+	}
 	uniresp.WriteJSONResponse(ctx.Writer, ans)
 }
 
+// TranslateNLQueryToCQLStream works like TranslateNLQueryToCQL but the progress
+// of the translation is streamed as Server-Sent Events. The last event is either
+// "final" (containing the same data as the non-streaming variant) or "error".
+// The translation is stopped once the client disconnects.
+func (api *apiServer) TranslateNLQueryToCQLStream(ctx *gin.Context) {
+	var req nlToCQLRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("invalid request: %w", err), http.StatusBadRequest)
+		return
+	}
+	ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+	ctx.Writer.Header().Set("Cache-Control", "no-cache")
+	ctx.Writer.Header().Set("X-Accel-Buffering", "no")
+	emit := func(event string, data any) {
+		ctx.SSEvent(event, data)
+		ctx.Writer.Flush()
+	}
+
+	t0 := time.Now()
+	resp, err := api.cqlTranslator.TranslateToCQLStream(
+		ctx.Request.Context(),
+		req.UserInput,
+		req.Corpname,
+		req.SystemPrompt,
+		req.Backend,
+		func(evt ai.TranslationEvent) {
+			emit(evt.Type, evt)
+		},
+	)
+	api.metrics.ObserveLLMTranslation(time.Since(t0), err)
+
+	if ctx.Request.Context().Err() != nil {
+		log.Debug().Msg("NL to CQL translation cancelled by client")
+		return
+	}
+	if err != nil {
+		emit("error", map[string]any{"error": err.Error()})
+		return
+	}
+	ans := nlToCQLResponse{Response: resp.Query, TranslationResult: resp}
+	if resp.Rejected && api.conf.AI.RejectSlowQueries {
+		ans.Error = "failed to generate a valid query which is not predicted to be slow"
+		emit("error", ans)
+		return
+	}
+	emit("final", ans)
+}
+
 type savePromptRequest struct {
 	Content string `json:"content"`
 	Name    string `json:"name"`
+	Author  string `json:"author"`
+	Comment string `json:"comment"`
+}
+
+// promptErrorStatus maps prompt store errors to HTTP status codes
+func promptErrorStatus(err error) int {
+	if errors.Is(err, prompts.ErrInvalidName) || errors.Is(err, prompts.ErrInvalidVersion) {
+		return http.StatusBadRequest
+
+	} else if errors.Is(err, prompts.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// promptVersionArg parses an optional prompt version URL argument
+// (0 = latest version)
+func promptVersionArg(ctx *gin.Context, name string) (int, error) {
+	v := ctx.Query(name)
+	if v == "" {
+		return 0, nil
+	}
+	ans, err := strconv.Atoi(v)
+	if err != nil || ans < 0 {
+		return 0, fmt.Errorf("%w: %s", prompts.ErrInvalidVersion, v)
+	}
+	return ans, nil
 }
 
 func (api *apiServer) handleSaveSystemPrompt(ctx *gin.Context) {
@@ -176,102 +450,246 @@ func (api *apiServer) handleSaveSystemPrompt(ctx *gin.Context) {
 		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("system prompt cannot be empty"), http.StatusBadRequest)
 		return
 	}
-
-	// Create versioned filename with date
-	dateStamp := time.Now().Format("2006-01-02")
-	var filename string
-	if req.Name != "" {
-		// Custom name format: custom-name.yyyy-mm-dd.txt
-		filename = fmt.Sprintf("%s.%s.txt", req.Name, dateStamp)
-	} else {
-		// Default format: update.yyyy-mm-dd.txt
-		filename = fmt.Sprintf("update.%s.txt", dateStamp)
+	if req.Name == "" {
+		req.Name = "update"
+	}
+	if req.Author == "" {
+		req.Author = ctx.GetString(auth.ClientCtxKey)
 	}
 
-	promptsDir := api.cqlTranslator.GetCustomSystemPromptsDir()
-	filepath := filepath.Join(promptsDir, filename)
-	if err := os.WriteFile(filepath, []byte(req.Content), 0644); err != nil {
-		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("failed to save system prompt: %w", err), http.StatusInternalServerError)
+	ver, err := api.cqlTranslator.Prompts().Save(req.Name, req.Content, req.Author, req.Comment)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("failed to save system prompt: %w", err), promptErrorStatus(err))
 		return
 	}
 
 	resp := map[string]any{
-		"filename": filename,
-		"path":     filepath,
-		"size":     len(req.Content),
+		"filename": fmt.Sprintf("%s@v%d", req.Name, ver.Version),
+		"name":     req.Name,
+		"version":  ver,
 	}
 	uniresp.WriteJSONResponse(ctx.Writer, resp)
 }
 
 func (api *apiServer) handleLoadSystemPrompt(ctx *gin.Context) {
-	filename := ctx.Query("file")
+	name := ctx.Query("name")
+	active, hasActive := api.cqlTranslator.GetActivePrompt()
+	if name == "" {
+		// Return the current system prompt from the translator
+		resp := map[string]any{
+			"systemPrompt": api.cqlTranslator.GetSystemPrompt(),
+			"source":       "current translator (default)",
+			"active":       nil,
+		}
+		if hasActive {
+			resp["source"] = fmt.Sprintf("current translator (%s@v%d)", active.Name, active.Version)
+			resp["active"] = active
+		}
+		uniresp.WriteJSONResponse(ctx.Writer, resp)
+		return
+	}
+
+	version, err := promptVersionArg(ctx, "version")
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if api.cqlTranslator.Prompts() == nil {
+		uniresp.RespondWithErrorJSON(ctx, ai.ErrNoPromptStore, http.StatusNotFound)
+		return
+	}
+	content, ver, err := api.cqlTranslator.Prompts().Get(name, version)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("failed to load prompt: %w", err), promptErrorStatus(err))
+		return
+	}
+	resp := map[string]any{
+		"systemPrompt": content,
+		"source":       fmt.Sprintf("%s@v%d", name, ver.Version),
+		"name":         name,
+		"version":      ver,
+		"isActive":     hasActive && active.Name == name && active.Version == ver.Version,
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, resp)
+}
 
-	var prompt string
-	var source string
+type activatePromptRequest struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+}
 
-	if filename != "" {
-		promptsDir := api.cqlTranslator.GetCustomSystemPromptsDir()
-		filepath := filepath.Join(promptsDir, filename)
-		content, err := os.ReadFile(filepath)
-		if err != nil {
-			uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("failed to load prompt file: %w", err), http.StatusInternalServerError)
+// handleActivatePrompt switches the translator to a stored prompt version.
+// An empty name switches the translator back to the default prompt.
+func (api *apiServer) handleActivatePrompt(ctx *gin.Context) {
+	var req activatePromptRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("invalid request: %w", err), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		if err := api.cqlTranslator.ResetPrompt(); err != nil {
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
 			return
 		}
-		prompt = string(content)
-		source = filename
-	} else {
-		// Return the current system prompt from the translator
-		prompt = api.cqlTranslator.GetSystemPrompt()
-		source = "current translator"
+		log.Info().Str("client", ctx.GetString(auth.ClientCtxKey)).Msg("switched to the default system prompt")
+		uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"active": nil})
+		return
+	}
+	active, err := api.cqlTranslator.ActivatePrompt(req.Name, req.Version, ctx.GetString(auth.ClientCtxKey))
+	if err != nil {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("failed to activate prompt: %w", err), promptErrorStatus(err))
+		return
 	}
+	log.Info().
+		Str("name", active.Name).
+		Int("version", active.Version).
+		Str("client", active.ActivatedBy).
+		Msg("activated system prompt")
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"active": active})
+}
 
+func (api *apiServer) handleLoadDefaultPrompt(ctx *gin.Context) {
 	resp := map[string]any{
-		"systemPrompt": prompt,
-		"source":       source,
+		"systemPrompt": api.cqlTranslator.GetDefaultSystemPrompt(),
+		"source":       filepath.Base(api.conf.AI.SystemPromptFile),
 	}
 	uniresp.WriteJSONResponse(ctx.Writer, resp)
 }
 
-func (api *apiServer) handleLoadDefaultPrompt(ctx *gin.Context) {
-	promptsDir := api.cqlTranslator.GetCustomSystemPromptsDir()
-	content, err := os.ReadFile(filepath.Join(promptsDir, "sysprompt.txt"))
+func (api *apiServer) handleListPrompts(ctx *gin.Context) {
+	items, err := api.cqlTranslator.Prompts().List()
 	if err != nil {
-		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("failed to load default prompt: %w", err), http.StatusInternalServerError)
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
 		return
 	}
+	resp := map[string]any{
+		"prompts": items,
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, resp)
+}
 
+func (api *apiServer) handlePromptHistory(ctx *gin.Context) {
+	name := ctx.Query("name")
+	history, err := api.cqlTranslator.Prompts().History(name)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, promptErrorStatus(err))
+		return
+	}
 	resp := map[string]any{
-		"systemPrompt": string(content),
-		"source":       "sysprompt.txt",
+		"name":     name,
+		"versions": history,
 	}
 	uniresp.WriteJSONResponse(ctx.Writer, resp)
 }
 
-func (api *apiServer) handleListPrompts(ctx *gin.Context) {
-	promptsDir := api.cqlTranslator.GetCustomSystemPromptsDir()
-	entries, err := os.ReadDir(promptsDir)
+func (api *apiServer) handlePromptDiff(ctx *gin.Context) {
+	name := ctx.Query("name")
+	fromVersion, err := promptVersionArg(ctx, "from")
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	toVersion, err := promptVersionArg(ctx, "to")
 	if err != nil {
-		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("failed to read prompts directory: %w", err), http.StatusInternalServerError)
-		return
-	}
-
-	files := make([]map[string]any, 0)
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".txt") {
-			info, err := entry.Info()
-			if err != nil {
-				continue
-			}
-			files = append(files, map[string]any{
-				"name":    entry.Name(),
-				"size":    info.Size(),
-				"modTime": info.ModTime().Format(time.RFC3339),
-			})
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	if fromVersion == 0 {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("missing argument 'from'"), http.StatusBadRequest)
+		return
+	}
+	diff, err := api.cqlTranslator.Prompts().Diff(name, fromVersion, toVersion)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, promptErrorStatus(err))
+		return
+	}
+	resp := map[string]any{
+		"name": name,
+		"diff": diff,
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, resp)
+}
+
+type addExampleRequest struct {
+	Input   string `json:"input"`
+	Query   string `json:"query"`
+	Author  string `json:"author"`
+	Comment string `json:"comment"`
+}
+
+func (api *apiServer) handleAddExample(ctx *gin.Context) {
+	var req addExampleRequest
+	if err := ctx.BindJSON(&req); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("invalid request: %w", err), http.StatusBadRequest)
+		return
+	}
+	if req.Author == "" {
+		req.Author = ctx.GetString(auth.ClientCtxKey)
+	}
+	ex, err := api.cqlTranslator.Examples().Add(req.Input, req.Query, req.Author, req.Comment)
+	if errors.Is(err, examples.ErrInvalidExample) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, ex)
+}
+
+func (api *apiServer) handleRemoveExample(ctx *gin.Context) {
+	var req struct {
+		ID int `json:"id"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("invalid request: %w", err), http.StatusBadRequest)
+		return
+	}
+	err := api.cqlTranslator.Examples().Remove(req.ID)
+	if errors.Is(err, examples.ErrNotFound) {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+
+	} else if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"ok": true})
+}
+
+func (api *apiServer) handleListExamples(ctx *gin.Context) {
+	resp := map[string]any{
+		"examples": api.cqlTranslator.Examples().List(),
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, resp)
+}
+
+// handleSearchExamples shows which examples would be provided
+// to the model for a request (?q=...&k=...)
+func (api *apiServer) handleSearchExamples(ctx *gin.Context) {
+	k := api.conf.AI.NumExamples
+	if v := ctx.Query("k"); v != "" {
+		var err error
+		k, err = strconv.Atoi(v)
+		if err != nil || k < 1 {
+			uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("invalid k"), http.StatusBadRequest)
+			return
 		}
 	}
+	resp := map[string]any{
+		"matches": api.cqlTranslator.Examples().Search(ctx.Query("q"), k),
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, resp)
+}
 
+func (api *apiServer) handleListBackends(ctx *gin.Context) {
 	resp := map[string]any{
-		"files": files,
+		"backends": api.cqlTranslator.Backends(),
 	}
 	uniresp.WriteJSONResponse(ctx.Writer, resp)
 }
@@ -18,11 +18,11 @@
 // The test page allows users to:
 // - Edit the system prompt used for translation
 // - Enter natural language queries and translate them to CQL
-// - Save modified system prompts with automatic versioning (timestamp-based)
+// - Save modified system prompts with automatic versioning
 // - Load the current system prompt from the translator
 //
-// The system prompt versions are saved to the "prompts/" directory with filenames
-// in the format: system_prompt_YYYYMMDD-HHMMSS.txt
+// The system prompt versions are saved to the prompt store (see package ai/prompts)
+// located in the configured "customSystemPromptsDir".
 //
 // Access the test page at: /test-nl
 
@@ -439,10 +439,10 @@ func (api *apiServer) handleNLTestPage(ctx *gin.Context) {
                 	<label for="promptSelect">Load from saved prompts:</label>
                  	<div class="controls">
                         <select id="promptSelect">
-                            <option value="">-- Select a prompt file --</option>
+                            <option value="">-- Select a prompt --</option>
                         </select>
                         <button type="button" class="secondary-btn" id="loadDefaultBtn" style="width: 100%%;">
-                            Load Default (sysprompt.txt)
+                            Load Default
                         </button>
 					</div>
                 </div>
@@ -462,6 +462,12 @@ func (api *apiServer) handleNLTestPage(ctx *gin.Context) {
             <div class="query-fieldset">
                 <label for="userInput">Natural Language Query:</label>
                 <textarea id="userInput" name="userInput" placeholder='e.g., Find all occurrences of the word "test" in the corpus' required></textarea>
+                <label for="corpname">Corpus (optional):</label>
+                <input type="text" id="corpname" placeholder="e.g., syn2020">
+                <label for="backend">LLM backend:</label>
+                <select id="backend">
+                    <option value="">-- Default order --</option>
+                </select>
             </div>
 
             <button type="submit" id="submitBtn">
@@ -536,11 +542,11 @@ func (api *apiServer) handleNLTestPage(ctx *gin.Context) {
                 const response = await fetch(url);
                 if (response.ok) {
                     const data = await response.json();
-                    promptSelect.innerHTML = '<option value="">-- Select a prompt file --</option>';
-                    data.files.forEach(file => {
+                    promptSelect.innerHTML = '<option value="">-- Select a prompt --</option>';
+                    data.prompts.forEach(prompt => {
                         const option = document.createElement('option');
-                        option.value = file.name;
-                        option.textContent = file.name;
+                        option.value = prompt.name;
+                        option.textContent = prompt.name + ' (v' + prompt.latest.version + ')';
                         promptSelect.appendChild(option);
                     });
                 }
@@ -552,11 +558,34 @@ func (api *apiServer) handleNLTestPage(ctx *gin.Context) {
         // Load prompts list on page load
         loadPromptsList();
 
+        async function loadBackendsList() {
+            try {
+                const url = urlPrefix + '/nl-to-cql/backends';
+                const response = await fetch(url);
+                if (response.ok) {
+                    const data = await response.json();
+                    const backendSelect = document.getElementById('backend');
+                    data.backends.forEach(backend => {
+                        const option = document.createElement('option');
+                        option.value = backend.name;
+                        option.textContent = backend.name + ' (' + backend.modelName + ')';
+                        backendSelect.appendChild(option);
+                    });
+                }
+            } catch (error) {
+                console.error('Error loading backends list:', error);
+            }
+        }
+
+        loadBackendsList();
+
         // Handle form submission
         form.addEventListener('submit', async (e) => {
             e.preventDefault();
 
             const userInput = document.getElementById('userInput').value;
+            const corpname = document.getElementById('corpname').value.trim();
+            const backend = document.getElementById('backend').value;
             const systemPrompt = systemPromptTextarea.value;
 
             if (!userInput) {
@@ -570,7 +599,7 @@ func (api *apiServer) handleNLTestPage(ctx *gin.Context) {
             resultBox.classList.remove('show');
 
             try {
-                const url = urlPrefix + '/nl-to-cql';
+                const url = urlPrefix + '/nl-to-cql/stream';
                 const response = await fetch(url, {
                     method: 'POST',
                     headers: {
@@ -578,21 +607,83 @@ func (api *apiServer) handleNLTestPage(ctx *gin.Context) {
                     },
                     body: JSON.stringify({
                         userInput: userInput,
-                        systemPrompt: systemPrompt
+                        systemPrompt: systemPrompt,
+                        corpname: corpname,
+                        backend: backend
                     })
                 });
-                const data = await response.json();
 
-                // Display results
                 resultBox.classList.add('show');
                 resultBox.classList.remove('error', 'success');
-
-                if (response.ok) {
-                    resultBox.classList.add('success');
-                    resultContent.textContent = data.response;
-                } else {
+                if (!response.ok) {
                     resultBox.classList.add('error');
-                    resultContent.textContent = JSON.stringify(data, null, 2);
+                    resultContent.textContent = JSON.stringify(await response.json(), null, 2);
+                    return;
+                }
+
+                let progress = '';
+                const showEvent = (event, data) => {
+                    switch (event) {
+                        case 'partial':
+                            progress += data.content;
+                            break;
+                        case 'tool_call':
+                            progress += '\n> ' + data.tool + '(' + data.arguments + ')\n';
+                            break;
+                        case 'tool_result':
+                            progress += '< ' + data.result + '\n';
+                            break;
+                        case 'revision':
+                            progress += '\n[checked: ' + data.revision.query + ']\n';
+                            break;
+                        case 'final':
+                            resultBox.classList.add('success');
+                            let text = data.response + '\n\n(backend: ' + data.backend + ')';
+                            if (data.isSlow !== null && data.isSlow !== undefined) {
+                                text += '\n\nPredicted: ' + (data.isSlow ? 'SLOW' : 'fast');
+                            }
+                            if (data.revisions && data.revisions.length > 1) {
+                                text += '\n\nRevisions:\n' + data.revisions.map((r, i) =>
+                                    (i + 1) + '. ' + r.query + (r.syntaxError ? ' (invalid)' : r.issues ? ' (unknown: ' + r.issues.map(v => v.name).join(', ') + ')' : r.estimate && r.estimate.isSlow ? ' (slow)' : '')
+                                ).join('\n');
+                            }
+                            resultContent.textContent = text;
+                            return;
+                        case 'error':
+                            resultBox.classList.add('error');
+                            resultContent.textContent = JSON.stringify(data, null, 2);
+                            return;
+                    }
+                    resultContent.textContent = progress;
+                };
+
+                const reader = response.body.getReader();
+                const decoder = new TextDecoder();
+                let buffer = '';
+                while (true) {
+                    const { done, value } = await reader.read();
+                    if (done) {
+                        break;
+                    }
+                    buffer += decoder.decode(value, { stream: true });
+                    let sep;
+                    while ((sep = buffer.indexOf('\n\n')) >= 0) {
+                        const chunk = buffer.slice(0, sep);
+                        buffer = buffer.slice(sep + 2);
+                        let event = 'message';
+                        const dataLines = [];
+                        chunk.split('\n').forEach(line => {
+                            if (line.startsWith('event:')) {
+                                event = line.slice(6).trim();
+
+                            } else if (line.startsWith('data:')) {
+                                dataLines.push(line.slice(5));
+                            }
+                        });
+                        if (dataLines.length > 0) {
+                            showEvent(event, JSON.parse(dataLines.join('\n')));
+                        }
+                    }
                 }
             } catch (error) {
                 resultBox.classList.add('show', 'error');
@@ -663,7 +754,7 @@ func (api *apiServer) handleNLTestPage(ctx *gin.Context) {
             saveStatus.classList.remove('show');
 
             try {
-                const url = urlPrefix + '/nl-to-cql/load-prompt?file=' + encodeURIComponent(selectedFile);
+                const url = urlPrefix + '/nl-to-cql/load-prompt?name=' + encodeURIComponent(selectedFile);
                 const response = await fetch(url);
 
                 if (response.ok) {
@@ -711,7 +802,7 @@ func (api *apiServer) handleNLTestPage(ctx *gin.Context) {
                 saveStatus.textContent = '✗ Error: ' + error.message;
             } finally {
                 loadDefaultBtn.disabled = false;
-                loadDefaultBtn.innerHTML = 'Load Default (sysprompt.txt)';
+                loadDefaultBtn.innerHTML = 'Load Default';
             }
         });
     </script>
@@ -0,0 +1,185 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	maxShadowDisagreements = 100
+)
+
+type shadowDisagreement struct {
+	Time         time.Time `json:"time"`
+	Query        string    `json:"query"`
+	Corpus       string    `json:"corpus,omitempty"`
+	CorpusSize   int       `json:"corpusSize"`
+	LiveIsSlow   bool      `json:"liveIsSlow"`
+	ShadowIsSlow bool      `json:"shadowIsSlow"`
+	LiveVotes    voteList  `json:"liveVotes"`
+	ShadowVotes  voteList  `json:"shadowVotes"`
+}
+
+type shadowModelSummary struct {
+	ModelPath     string  `json:"modelPath"`
+	ModelType     string  `json:"modelType"`
+	NumAgreements int     `json:"numAgreements"`
+	AgreementRate float64 `json:"agreementRate"`
+}
+
+type shadowSummary struct {
+	NumEvaluated  int                  `json:"numEvaluated"`
+	NumAgreements int                  `json:"numAgreements"`
+	AgreementRate float64              `json:"agreementRate"`
+	Models        []shadowModelSummary `json:"models"`
+	Disagreements []shadowDisagreement `json:"disagreements"`
+}
+
+// shadowStats collects agreement between the live ensemble and shadow
+// models (i.e. models evaluated on each request but not affecting
+// the result). Only recent disagreements are kept. A nil instance
+// represents no shadow models.
+type shadowStats struct {
+	mu                 sync.Mutex
+	models             []ensembleModel
+	numEvaluated       int
+	numAgreements      int
+	modelNumAgreements []int
+	disagreements      []shadowDisagreement
+	nextDisagreement   int
+}
+
+// add registers a shadow evaluation. Votes not matching the models
+// of the stats (i.e. votes of models replaced by a reload) are ignored.
+func (ss *shadowStats) add(item shadowDisagreement) {
+	if ss == nil {
+		return
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if len(ss.models) == 0 || len(ss.models) != len(item.ShadowVotes) {
+		return
+	}
+	ss.numEvaluated++
+	for i, v := range item.ShadowVotes {
+		if (v.Result > 0) == item.LiveIsSlow {
+			ss.modelNumAgreements[i]++
+		}
+	}
+	if item.LiveIsSlow == item.ShadowIsSlow {
+		ss.numAgreements++
+		return
+	}
+	if len(ss.disagreements) < maxShadowDisagreements {
+		ss.disagreements = append(ss.disagreements, item)
+
+	} else {
+		ss.disagreements[ss.nextDisagreement] = item
+	}
+	ss.nextDisagreement = (ss.nextDisagreement + 1) % maxShadowDisagreements
+}
+
+func (ss *shadowStats) summary() shadowSummary {
+	if ss == nil {
+		return shadowSummary{
+			Models:        []shadowModelSummary{},
+			Disagreements: []shadowDisagreement{},
+		}
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ans := shadowSummary{
+		NumEvaluated:  ss.numEvaluated,
+		NumAgreements: ss.numAgreements,
+		Models:        make([]shadowModelSummary, len(ss.models)),
+		Disagreements: make([]shadowDisagreement, 0, len(ss.disagreements)),
+	}
+	if ss.numEvaluated > 0 {
+		ans.AgreementRate = float64(ss.numAgreements) / float64(ss.numEvaluated)
+	}
+	for i, md := range ss.models {
+		ans.Models[i] = shadowModelSummary{
+			ModelPath:     md.srcPath,
+			ModelType:     md.modelType,
+			NumAgreements: ss.modelNumAgreements[i],
+		}
+		if ss.numEvaluated > 0 {
+			ans.Models[i].AgreementRate = float64(ss.modelNumAgreements[i]) / float64(ss.numEvaluated)
+		}
+	}
+	// newest first
+	for i := range len(ss.disagreements) {
+		idx := (ss.nextDisagreement - 1 - i + 2*len(ss.disagreements)) % len(ss.disagreements)
+		ans.Disagreements = append(ans.Disagreements, ss.disagreements[idx])
+	}
+	return ans
+}
+
+func newShadowStats(models []ensembleModel) *shadowStats {
+	return &shadowStats{
+		models:             models,
+		modelNumAgreements: make([]int, len(models)),
+		disagreements:      make([]shadowDisagreement, 0, maxShadowDisagreements),
+	}
+}
+
+// -----
+
+// compareShadowModels compares the decision of shadow models with
+// the live ensemble's one and logs votes of both
+func (api *apiServer) compareShadowModels(
+	stats *shadowStats,
+	q string,
+	corpname string,
+	corpusSize int,
+	livePredictions voteList,
+	shadowPredictions voteList,
+) {
+	item := shadowDisagreement{
+		Time:         time.Now(),
+		Query:        q,
+		Corpus:       corpname,
+		CorpusSize:   corpusSize,
+		LiveIsSlow:   livePredictions.isSlowQuery(),
+		ShadowIsSlow: shadowPredictions.isSlowQuery(),
+		LiveVotes:    livePredictions,
+		ShadowVotes:  shadowPredictions,
+	}
+	stats.add(item)
+	liveFor, liveAgainst := livePredictions.forAndAgainst()
+	shadowFor, shadowAgainst := shadowPredictions.forAndAgainst()
+	log.Info().
+		Str("query", q).
+		Str("corpus", corpname).
+		Int("liveVotesFor", liveFor).
+		Int("liveVotesAgainst", liveAgainst).
+		Bool("liveIsSlow", item.LiveIsSlow).
+		Int("shadowVotesFor", shadowFor).
+		Int("shadowVotesAgainst", shadowAgainst).
+		Bool("shadowIsSlow", item.ShadowIsSlow).
+		Msg("shadow models evaluation")
+}
+
+func (api *apiServer) handleShadowSummary(ctx *gin.Context) {
+	uniresp.WriteJSONResponse(ctx.Writer, api.models().stats.summary())
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiserver
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShadowStatsAgreement(t *testing.T) {
+	ss := newShadowStats([]ensembleModel{{srcPath: "a.rf.json"}, {srcPath: "b.rf.json"}})
+	ss.add(shadowDisagreement{
+		LiveIsSlow:   true,
+		ShadowIsSlow: true,
+		ShadowVotes:  voteList{{Result: 1}, {Result: 1}},
+	})
+	ss.add(shadowDisagreement{
+		Query:        "[word=\"x\"]",
+		LiveIsSlow:   false,
+		ShadowIsSlow: true,
+		ShadowVotes:  voteList{{Result: 1}, {Result: 0}},
+	})
+	sm := ss.summary()
+	assert.Equal(t, 2, sm.NumEvaluated)
+	assert.Equal(t, 1, sm.NumAgreements)
+	assert.InDelta(t, 0.5, sm.AgreementRate, 1e-9)
+	assert.Equal(t, 1, sm.Models[0].NumAgreements)
+	assert.Equal(t, 2, sm.Models[1].NumAgreements)
+	assert.Len(t, sm.Disagreements, 1)
+	assert.Equal(t, "[word=\"x\"]", sm.Disagreements[0].Query)
+}
+
+func TestShadowStatsKeepsRecentDisagreements(t *testing.T) {
+	ss := newShadowStats([]ensembleModel{{srcPath: "a.rf.json"}})
+	for i := range maxShadowDisagreements + 5 {
+		ss.add(shadowDisagreement{
+			Query:        fmt.Sprintf("q%d", i),
+			ShadowIsSlow: true,
+			ShadowVotes:  voteList{{Result: 1}},
+		})
+	}
+	sm := ss.summary()
+	assert.Len(t, sm.Disagreements, maxShadowDisagreements)
+	assert.Equal(t, fmt.Sprintf("q%d", maxShadowDisagreements+4), sm.Disagreements[0].Query)
+	assert.Equal(t, "q5", sm.Disagreements[maxShadowDisagreements-1].Query)
+}
+
+func TestShadowStatsIgnoresVotesOfOtherModels(t *testing.T) {
+	ss := newShadowStats([]ensembleModel{{srcPath: "a.rf.json"}})
+	// votes evaluated by a snapshot with more shadow models
+	ss.add(shadowDisagreement{
+		ShadowIsSlow: true,
+		ShadowVotes:  voteList{{Result: 1}, {Result: 1}},
+	})
+	sm := ss.summary()
+	assert.Equal(t, 0, sm.NumEvaluated)
+	assert.Equal(t, 0, sm.Models[0].NumAgreements)
+}
+
+func TestShadowSummaryWithoutShadowModels(t *testing.T) {
+	var ss *shadowStats
+	ss.add(shadowDisagreement{ShadowVotes: voteList{{Result: 1}}})
+	assert.Equal(t, 0, ss.summary().NumEvaluated)
+
+	sm := newShadowStats(nil).summary()
+	assert.Equal(t, 0, sm.NumEvaluated)
+	assert.Empty(t, sm.Models)
+	assert.NotNil(t, sm.Disagreements)
+}
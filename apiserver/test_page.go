@@ -33,10 +33,11 @@ type corpusSelProp struct {
 }
 
 func (api *apiServer) handleTestPage(ctx *gin.Context) {
-	// Build corpus options from configuration
+	// Build corpus options from known corpora
 	var corpusOptions strings.Builder
-	corpora := make([]corpusSelProp, 0, len(api.conf.CorporaProps))
-	for c, v := range api.conf.CorporaProps {
+	corpProps := api.corpProps.All()
+	corpora := make([]corpusSelProp, 0, len(corpProps))
+	for c, v := range corpProps {
 		if v.Size > 100000000 {
 			corpora = append(corpora, corpusSelProp{Name: c, Size: int64(v.Size)})
 		}
@@ -62,14 +63,15 @@ func (api *apiServer) handleTestPage(ctx *gin.Context) {
 
 	slowQueryVoteThreshold := 0.0
 	var modelFiles strings.Builder
-	for i, mod := range api.rfEnsemble {
+	live := api.models().live
+	for i, mod := range live {
 		slowQueryVoteThreshold += mod.threshold
 		if i > 0 {
 			modelFiles.WriteString(", ")
 		}
 		modelFiles.WriteString(filepath.Base(mod.srcPath))
 	}
-	slowQueryVoteThreshold /= float64(len(api.rfEnsemble))
+	slowQueryVoteThreshold /= float64(len(live))
 
 	html := fmt.Sprintf(`<!DOCTYPE html>
 <html lang="en">
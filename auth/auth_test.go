@@ -0,0 +1,114 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestTokenRoundTrip(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	token, err := IssueToken(testSecret, Claims{Subject: "kontext", Scopes: []string{ScopeEvaluate}, ExpiresAt: now.Unix() + 60})
+	assert.NoError(t, err)
+	claims, err := VerifyToken(testSecret, token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "kontext", claims.Subject)
+	assert.Equal(t, []string{ScopeEvaluate}, claims.Scopes)
+
+	_, err = VerifyToken(testSecret, token, now.Add(time.Minute))
+	assert.ErrorContains(t, err, "expired")
+	_, err = VerifyToken("another-secret-another-secret-xx", token, now)
+	assert.ErrorContains(t, err, "signature")
+	_, err = IssueToken(testSecret, Claims{Subject: "x", Scopes: []string{"root"}})
+	assert.Error(t, err)
+}
+
+func TestLimiter(t *testing.T) {
+	lim := NewLimiter(RateLimitConf{RequestsPerSec: 1, Burst: 2})
+	now := time.Now()
+	ok, _ := lim.Allow("a", now)
+	assert.True(t, ok)
+	ok, _ = lim.Allow("a", now)
+	assert.True(t, ok)
+	ok, wait := lim.Allow("a", now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+	ok, _ = lim.Allow("b", now)
+	assert.True(t, ok)
+	ok, _ = lim.Allow("a", now.Add(time.Second))
+	assert.True(t, ok)
+}
+
+func TestConfValidate(t *testing.T) {
+	assert.NoError(t, (&Conf{Keys: []APIKeyConf{{Name: "a", Key: "k", Scopes: []string{ScopeAdmin}}}}).Validate())
+	assert.Error(t, (&Conf{Keys: []APIKeyConf{{Name: "a", Key: "k", Scopes: []string{"foo"}}}}).Validate())
+	assert.Error(t, (&Conf{Keys: []APIKeyConf{{Name: "a", Key: "k"}, {Name: "a", Key: "l"}}}).Validate())
+	assert.Error(t, (&Conf{HMACSecret: "short"}).Validate())
+	assert.Error(t, (&Conf{KeyRateLimits: map[string]RateLimitConf{ScopeTranslate: {RequestsPerSec: 1}}}).Validate())
+}
+
+func newTestEngine(g *Guard) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/eval", g.Require(ScopeEvaluate), func(ctx *gin.Context) { ctx.String(http.StatusOK, "ok") })
+	engine.POST("/admin", g.Require(ScopeAdmin), func(ctx *gin.Context) { ctx.String(http.StatusOK, "ok") })
+	return engine
+}
+
+func doRequest(engine *gin.Engine, method, path, key string) int {
+	req := httptest.NewRequest(method, path, nil)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestGuard(t *testing.T) {
+	g := NewGuard(&Conf{
+		Keys:            []APIKeyConf{{Name: "kontext", Key: "secret-key", Scopes: []string{ScopeEvaluate}}},
+		HMACSecret:      testSecret,
+		AnonymousScopes: []string{},
+		KeyRateLimits:   map[string]RateLimitConf{ScopeEvaluate: {RequestsPerSec: 0.001, Burst: 2}},
+	})
+	engine := newTestEngine(g)
+	assert.Equal(t, http.StatusUnauthorized, doRequest(engine, "GET", "/eval", ""))
+	assert.Equal(t, http.StatusUnauthorized, doRequest(engine, "GET", "/eval", "wrong-key"))
+	assert.Equal(t, http.StatusOK, doRequest(engine, "GET", "/eval", "secret-key"))
+	assert.Equal(t, http.StatusForbidden, doRequest(engine, "POST", "/admin", "secret-key"))
+
+	token, err := IssueToken(testSecret, Claims{Subject: "admin", Scopes: []string{ScopeAdmin}})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, doRequest(engine, "POST", "/admin", token))
+
+	assert.Equal(t, http.StatusOK, doRequest(engine, "GET", "/eval", "secret-key"))
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(engine, "GET", "/eval", "secret-key"))
+}
+
+func TestNilGuardAllowsAll(t *testing.T) {
+	engine := newTestEngine(nil)
+	assert.Equal(t, http.StatusOK, doRequest(engine, "POST", "/admin", ""))
+}
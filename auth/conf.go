@@ -0,0 +1,133 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	// ScopeEvaluate allows for query evaluation and feedback
+	ScopeEvaluate = "evaluate"
+
+	// ScopeTranslate allows for natural language to CQL translation
+	ScopeTranslate = "translate"
+
+	// ScopeAdmin allows for changing server data (e.g. prompts)
+	// and for inspecting internal state
+	ScopeAdmin = "admin"
+
+	minHMACSecretLength = 32
+)
+
+var allScopes = []string{ScopeEvaluate, ScopeTranslate, ScopeAdmin}
+
+func validateScopes(scopes []string) error {
+	for _, s := range scopes {
+		if !slices.Contains(allScopes, s) {
+			return fmt.Errorf("unknown scope %s", s)
+		}
+	}
+	return nil
+}
+
+// RateLimitConf configures a token bucket
+type RateLimitConf struct {
+
+	// RequestsPerSec is the rate the bucket is refilled with
+	RequestsPerSec float64 `json:"requestsPerSec"`
+
+	// Burst is the bucket capacity
+	Burst int `json:"burst"`
+}
+
+func (rl RateLimitConf) Validate() error {
+	if rl.RequestsPerSec <= 0 {
+		return fmt.Errorf("invalid requestsPerSec %.2f", rl.RequestsPerSec)
+	}
+	if rl.Burst < 1 {
+		return fmt.Errorf("invalid burst %d", rl.Burst)
+	}
+	return nil
+}
+
+type APIKeyConf struct {
+
+	// Name identifies the client (e.g. in logs)
+	Name   string   `json:"name"`
+	Key    string   `json:"key"`
+	Scopes []string `json:"scopes"`
+}
+
+type Conf struct {
+
+	// Keys are static API keys
+	Keys []APIKeyConf `json:"keys"`
+
+	// HMACSecret enables signed tokens (see IssueToken).
+	// If empty, only static keys are accepted.
+	HMACSecret string `json:"hmacSecret"`
+
+	// AnonymousScopes are granted to requests without any credentials.
+	// If empty, such requests are rejected for all the protected endpoints.
+	AnonymousScopes []string `json:"anonymousScopes"`
+
+	// KeyRateLimits are per-scope limits applied to each client
+	// (API key or token subject) separately
+	KeyRateLimits map[string]RateLimitConf `json:"keyRateLimits"`
+
+	// IPRateLimits are per-scope limits applied to each client IP
+	// address separately (regardless of credentials)
+	IPRateLimits map[string]RateLimitConf `json:"ipRateLimits"`
+}
+
+func (conf *Conf) Validate() error {
+	names := make(map[string]bool)
+	for i, k := range conf.Keys {
+		if k.Name == "" {
+			return fmt.Errorf("missing name of the API key %d", i)
+		}
+		if names[k.Name] {
+			return fmt.Errorf("duplicate API key name %s", k.Name)
+		}
+		names[k.Name] = true
+		if k.Key == "" {
+			return fmt.Errorf("empty API key %s", k.Name)
+		}
+		if err := validateScopes(k.Scopes); err != nil {
+			return fmt.Errorf("invalid API key %s: %w", k.Name, err)
+		}
+	}
+	if conf.HMACSecret != "" && len(conf.HMACSecret) < minHMACSecretLength {
+		return fmt.Errorf("hmacSecret must have at least %d characters", minHMACSecretLength)
+	}
+	if err := validateScopes(conf.AnonymousScopes); err != nil {
+		return fmt.Errorf("invalid anonymousScopes: %w", err)
+	}
+	for _, limits := range []map[string]RateLimitConf{conf.KeyRateLimits, conf.IPRateLimits} {
+		for scope, rl := range limits {
+			if err := validateScopes([]string{scope}); err != nil {
+				return fmt.Errorf("invalid rate limit: %w", err)
+			}
+			if err := rl.Validate(); err != nil {
+				return fmt.Errorf("invalid rate limit for scope %s: %w", scope, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ClientCtxKey is a gin context key containing name of an authenticated client
+	ClientCtxKey = "authClient"
+
+	anonymousClient = "anonymous"
+	apiKeyHeader    = "X-API-Key"
+)
+
+type principal struct {
+	name   string
+	scopes []string
+}
+
+// Guard authenticates requests, checks their scopes and applies rate limits.
+// All the methods can be called on a nil instance (= disabled auth).
+type Guard struct {
+	conf         *Conf
+	keys         map[[sha256.Size]byte]principal
+	keyLimiters  map[string]*Limiter
+	ipLimiters   map[string]*Limiter
+	timeProvider func() time.Time
+}
+
+func credentials(ctx *gin.Context) string {
+	if v := ctx.GetHeader(apiKeyHeader); v != "" {
+		return v
+	}
+	if v, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(v)
+	}
+	return ""
+}
+
+func (g *Guard) authenticate(cred string) (principal, error) {
+	if cred == "" {
+		return principal{name: anonymousClient, scopes: g.conf.AnonymousScopes}, nil
+	}
+	if p, ok := g.keys[sha256.Sum256([]byte(cred))]; ok {
+		return p, nil
+	}
+	if g.conf.HMACSecret != "" && strings.Contains(cred, ".") {
+		claims, err := VerifyToken(g.conf.HMACSecret, cred, g.timeProvider())
+		if err != nil {
+			return principal{}, err
+		}
+		return principal{name: claims.Subject, scopes: claims.Scopes}, nil
+	}
+	return principal{}, fmt.Errorf("invalid credentials")
+}
+
+func tooManyRequests(ctx *gin.Context, wait time.Duration) {
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("rate limit exceeded"), http.StatusTooManyRequests)
+	ctx.Abort()
+}
+
+// Require creates a middleware allowing only requests with the `scope`
+func (g *Guard) Require(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if g == nil {
+			ctx.Next()
+			return
+		}
+		now := g.timeProvider()
+		if lim, ok := g.ipLimiters[scope]; ok {
+			if allowed, wait := lim.Allow(ctx.ClientIP(), now); !allowed {
+				tooManyRequests(ctx, wait)
+				return
+			}
+		}
+		p, err := g.authenticate(credentials(ctx))
+		if err != nil {
+			log.Warn().Err(err).Str("ip", ctx.ClientIP()).Msg("authentication failed")
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusUnauthorized)
+			ctx.Abort()
+			return
+		}
+		if !slices.Contains(p.scopes, scope) {
+			status := http.StatusForbidden
+			if p.name == anonymousClient {
+				status = http.StatusUnauthorized
+			}
+			uniresp.RespondWithErrorJSON(ctx, fmt.Errorf("access denied (scope %s required)", scope), status)
+			ctx.Abort()
+			return
+		}
+		if lim, ok := g.keyLimiters[scope]; ok {
+			limKey := p.name
+			if p.name == anonymousClient {
+				limKey = anonymousClient + ":" + ctx.ClientIP()
+			}
+			if allowed, wait := lim.Allow(limKey, now); !allowed {
+				tooManyRequests(ctx, wait)
+				return
+			}
+		}
+		ctx.Set(ClientCtxKey, p.name)
+		ctx.Next()
+	}
+}
+
+// NewGuard creates a guard based on a validated configuration.
+// For nil conf, nil is returned (which means auth is disabled).
+func NewGuard(conf *Conf) *Guard {
+	if conf == nil {
+		return nil
+	}
+	g := &Guard{
+		conf:         conf,
+		keys:         make(map[[sha256.Size]byte]principal),
+		keyLimiters:  make(map[string]*Limiter),
+		ipLimiters:   make(map[string]*Limiter),
+		timeProvider: time.Now,
+	}
+	for _, k := range conf.Keys {
+		g.keys[sha256.Sum256([]byte(k.Key))] = principal{name: k.Name, scopes: k.Scopes}
+	}
+	for scope, rl := range conf.KeyRateLimits {
+		g.keyLimiters[scope] = NewLimiter(rl)
+	}
+	for scope, rl := range conf.IPRateLimits {
+		g.ipLimiters[scope] = NewLimiter(rl)
+	}
+	return g
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claims is a payload of a signed token
+type Claims struct {
+	Subject string   `json:"sub"`
+	Scopes  []string `json:"scopes"`
+
+	// ExpiresAt is a UNIX timestamp
+	ExpiresAt int64 `json:"exp"`
+}
+
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueToken creates a token in the form `payload.signature` where
+// payload is base64 encoded JSON claims and signature is HMAC-SHA256
+// of the encoded payload.
+func IssueToken(secret string, claims Claims) (string, error) {
+	if err := validateScopes(claims.Scopes); err != nil {
+		return "", fmt.Errorf("failed to issue token: %w", err)
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to issue token: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + sign(secret, payload), nil
+}
+
+// VerifyToken checks token signature and expiration
+func VerifyToken(secret, token string, now time.Time) (Claims, error) {
+	var claims Claims
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, fmt.Errorf("malformed token")
+	}
+	if !hmac.Equal([]byte(sig), []byte(sign(secret, payload))) {
+		return claims, fmt.Errorf("invalid token signature")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return claims, fmt.Errorf("malformed token: %w", err)
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return claims, fmt.Errorf("malformed token: %w", err)
+	}
+	if claims.ExpiresAt > 0 && now.Unix() >= claims.ExpiresAt {
+		return claims, fmt.Errorf("token expired")
+	}
+	return claims, nil
+}
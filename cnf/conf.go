@@ -24,6 +24,8 @@ import (
 
 	"github.com/czcorpus/cnc-gokit/logging"
 	"github.com/czcorpus/cqlizer/ai"
+	"github.com/czcorpus/cqlizer/auth"
+	"github.com/czcorpus/cqlizer/corpprops"
 	"github.com/czcorpus/cqlizer/eval/feats"
 	"github.com/czcorpus/cqlizer/monitoring"
 	"github.com/rs/zerolog/log"
@@ -42,6 +44,22 @@ type RFEnsembleConf struct {
 	VoteThreshold float64 `json:"voteThreshold"`
 	ModelType     string  `json:"modelType"`
 	Disabled      bool    `json:"disabled"`
+
+	// Shadow models are evaluated on every request but they do not take part
+	// in the decision. Their votes are logged and compared with the live ensemble.
+	Shadow bool `json:"shadow"`
+}
+
+// EvalCacheConf configures caching of query evaluations
+type EvalCacheConf struct {
+
+	// MaxItems is the maximum number of cached evaluations.
+	// Zero value disables the cache.
+	MaxItems int `json:"maxItems"`
+
+	// TTLSecs specifies how long an evaluation is cached
+	// (zero means no expiration)
+	TTLSecs int `json:"ttlSecs"`
 }
 
 type Conf struct {
@@ -59,8 +77,33 @@ type Conf struct {
 	CorporaProps             map[string]feats.CorpusProps `json:"corporaProps"`
 	AI                       ai.Conf                      `json:"ai"`
 
+	// CorporaPropsSources enables discovery of corpora properties from
+	// registry files and/or MQuery (nil = only CorporaProps are used).
+	// With sources enabled, CorporaProps entries only override
+	// the discovered values.
+	CorporaPropsSources *corpprops.Conf `json:"corporaPropsSources"`
+
+	// TrustedProxies are IPs/CIDRs allowed to provide a client IP via
+	// X-Forwarded-For (empty = none, i.e. the remote address is always used)
+	TrustedProxies []string `json:"trustedProxies"`
+
 	Monitoring *monitoring.Conf `json:"monitoring"`
 
+	// MetricsEnabled exposes the /metrics endpoint in the Prometheus format.
+	// It is independent of the TimescaleDB based Monitoring.
+	MetricsEnabled bool `json:"metricsEnabled"`
+
+	// FeedbackStorePath is a file where actual processing times of evaluated
+	// queries (as reported by clients) are appended. If empty, the feedback
+	// endpoint is disabled.
+	FeedbackStorePath string `json:"feedbackStorePath"`
+
+	// Auth enables API keys/tokens and rate limiting (nil = no auth)
+	Auth *auth.Conf `json:"auth"`
+
+	// EvalCache is an optional cache of query evaluations (nil = disabled)
+	EvalCache *EvalCacheConf `json:"evalCache"`
+
 	// SyntheticTimeCorrection - for stats records generated via benchmarking,
 	// it may be needed to increase the times as MQuery will probably perform a bit better
 	// and if performed during low traffic hours, this difference can be even bigger.
@@ -107,6 +150,32 @@ func ValidateAndDefaults(conf *Conf) {
 		log.Fatal().Err(err).Msg("invalid time zone")
 	}
 
+	if conf.Auth != nil {
+		if err := conf.Auth.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("invalid auth configuration")
+		}
+	}
+
+	if err := conf.AI.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid ai configuration")
+	}
+	if len(conf.AI.Backends) == 0 {
+		log.Warn().Msg("no LLM backend configured, NL to CQL translation will not be available")
+	}
+
+	if conf.CorporaPropsSources != nil {
+		if err := conf.CorporaPropsSources.Validate(); err != nil {
+			log.Fatal().Err(err).Msg("invalid corporaPropsSources configuration")
+		}
+		if conf.CorporaPropsSources.UseRegistries && conf.AI.CorporaRegistryDir == "" {
+			log.Fatal().Msg("corporaPropsSources.useRegistries requires ai.corporaRegistryDir")
+		}
+	}
+
+	if conf.EvalCache != nil && (conf.EvalCache.MaxItems < 0 || conf.EvalCache.TTLSecs < 0) {
+		log.Fatal().Msg("invalid evalCache configuration (negative values)")
+	}
+
 	if conf.SyntheticTimeCorrection == 0 {
 		log.Warn().Msg("SyntheticRecordsTimeCorrection is not set - we must set it to 1")
 		conf.SyntheticTimeCorrection = 1
@@ -0,0 +1,53 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package corpprops
+
+import "fmt"
+
+const (
+	dfltRefreshIntervalSecs = 3600
+)
+
+// Conf configures automatic discovery of corpora properties
+type Conf struct {
+
+	// UseRegistries makes the provider read corpora languages from
+	// ai.corporaRegistryDir. Standard Manatee registries contain no corpus
+	// size so they only complement the sizes obtained from MQuery (or from
+	// corporaProps) - a corpus with a registry file only is not available.
+	// A non-standard SIZE entry is used if present.
+	UseRegistries bool `json:"useRegistries"`
+
+	// MQueryURL is an MQuery server providing a list of installed
+	// corpora and their sizes (if empty, MQuery is not used)
+	MQueryURL string `json:"mqueryUrl"`
+
+	// RefreshIntervalSecs specifies how often the properties are reloaded
+	RefreshIntervalSecs int `json:"refreshIntervalSecs"`
+}
+
+func (conf *Conf) Validate() error {
+	if !conf.UseRegistries && conf.MQueryURL == "" {
+		return fmt.Errorf("no source of corpora properties enabled")
+	}
+	if conf.RefreshIntervalSecs < 0 {
+		return fmt.Errorf("invalid refreshIntervalSecs %d", conf.RefreshIntervalSecs)
+	}
+	if conf.RefreshIntervalSecs == 0 {
+		conf.RefreshIntervalSecs = dfltRefreshIntervalSecs
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package corpprops
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxRefreshDuration bounds a single refresh of all the sources
+	maxRefreshDuration = 2 * time.Minute
+)
+
+// Provider provides properties (size, language, alternative corpus)
+// of corpora. The properties are obtained from sources (registry files,
+// MQuery) and merged with configured ones which act as overrides.
+// The provider is safe for concurrent use.
+type Provider struct {
+	sources   []Source
+	overrides map[string]feats.CorpusProps
+	interval  time.Duration
+
+	// fetched contains the last successful result of each source
+	// (so a temporarily failing source does not remove its corpora)
+	fetched []map[string]feats.CorpusProps
+	props   map[string]feats.CorpusProps
+	mu      sync.RWMutex
+}
+
+// NewProvider creates a provider with sources enabled by the conf.
+// With conf == nil, only the overrides are provided. The registries
+// can be nil in case registry files are not used.
+func NewProvider(conf *Conf, overrides map[string]feats.CorpusProps, registries RegistryLister) *Provider {
+	ans := &Provider{
+		overrides: overrides,
+	}
+	if conf != nil {
+		if conf.UseRegistries && registries != nil {
+			ans.sources = append(ans.sources, &registrySource{registries: registries})
+		}
+		if conf.MQueryURL != "" {
+			ans.sources = append(
+				ans.sources,
+				&mquerySource{url: conf.MQueryURL, client: &http.Client{Timeout: mqueryRequestTimeout}},
+			)
+		}
+		ans.interval = time.Duration(conf.RefreshIntervalSecs) * time.Second
+	}
+	ans.fetched = make([]map[string]feats.CorpusProps, len(ans.sources))
+	ans.props = ans.merge()
+	return ans
+}
+
+// merge combines fetched properties and overrides. Sources are applied
+// in their order with non-empty values replacing the previous ones.
+// Non-empty values of overrides are applied last. Corpora with unknown
+// size are omitted as queries cannot be evaluated for them.
+func (p *Provider) merge() map[string]feats.CorpusProps {
+	ans := make(map[string]feats.CorpusProps)
+	apply := func(src map[string]feats.CorpusProps) {
+		for corpname, v := range src {
+			curr := ans[corpname]
+			if v.Size > 0 {
+				curr.Size = v.Size
+			}
+			if v.Lang != "" {
+				curr.Lang = v.Lang
+			}
+			if v.AltCorpus != "" {
+				curr.AltCorpus = v.AltCorpus
+			}
+			ans[corpname] = curr
+		}
+	}
+	for _, f := range p.fetched {
+		apply(f)
+	}
+	apply(p.overrides)
+	for corpname, v := range ans {
+		if v.Size <= 0 {
+			delete(ans, corpname)
+		}
+	}
+	return ans
+}
+
+// Refresh reloads properties from all the sources. In case a source
+// fails (or does not finish within maxRefreshDuration), its previously
+// fetched properties are kept.
+func (p *Provider) Refresh(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, maxRefreshDuration)
+	defer cancel()
+	for i, src := range p.sources {
+		props, err := src.Fetch(ctx)
+		if err != nil {
+			log.Error().Err(err).Str("source", src.Name()).Msg("failed to fetch corpora properties")
+			continue
+		}
+		p.mu.Lock()
+		p.fetched[i] = props
+		p.mu.Unlock()
+		log.Debug().Str("source", src.Name()).Int("numCorpora", len(props)).Msg("fetched corpora properties")
+	}
+	p.mu.Lock()
+	p.props = p.merge()
+	numCorpora := len(p.props)
+	p.mu.Unlock()
+	log.Info().Int("numCorpora", numCorpora).Msg("refreshed corpora properties")
+}
+
+// Run loads the properties and then refreshes them periodically until
+// the ctx is cancelled. Until the first refresh finishes, only the overrides
+// are provided. Without any source, it returns immediately.
+func (p *Provider) Run(ctx context.Context) {
+	if len(p.sources) == 0 {
+		return
+	}
+	p.Refresh(ctx)
+	if p.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Refresh(ctx)
+		}
+	}
+}
+
+// Get returns properties of a corpus
+func (p *Provider) Get(corpname string) (feats.CorpusProps, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	v, ok := p.props[corpname]
+	return v, ok
+}
+
+// All returns a copy of properties of all known corpora
+func (p *Provider) All() map[string]feats.CorpusProps {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return maps.Clone(p.props)
+}
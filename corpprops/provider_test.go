@@ -0,0 +1,223 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package corpprops
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/cqlizer/ai"
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRegistries struct {
+	corpora []ai.CorpusInfo
+	err     error
+}
+
+func (fr *fakeRegistries) ListCorpora() ([]ai.CorpusInfo, error) {
+	return fr.corpora, fr.err
+}
+
+func newFakeMQuery(sizes map[string]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/corplist" {
+			fmt.Fprint(w, `{"corpora": [`)
+			first := true
+			for c := range sizes {
+				if !first {
+					fmt.Fprint(w, ",")
+				}
+				fmt.Fprintf(w, `{"id": %q}`, c)
+				first = false
+			}
+			fmt.Fprint(w, `]}`)
+			return
+		}
+		for c, size := range sizes {
+			if r.URL.Path == "/info/"+c && size < 0 {
+				http.Error(w, "corpus not available", http.StatusInternalServerError)
+				return
+			} else if r.URL.Path == "/info/"+c {
+				fmt.Fprintf(w, `{"corpus": {"corpname": %q, "size": %d}, "locale": "en"}`, c, size)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func TestLanguageCode(t *testing.T) {
+	assert.Equal(t, "cs", languageCode("Czech"))
+	assert.Equal(t, "en", languageCode(" english "))
+	assert.Equal(t, "de", languageCode("DE"))
+	assert.Equal(t, "", languageCode("Klingon"))
+}
+
+func TestProviderOnlyOverrides(t *testing.T) {
+	p := NewProvider(nil, map[string]feats.CorpusProps{"syn": {Size: 100, Lang: "cs"}}, nil)
+	p.Refresh(context.Background())
+	v, ok := p.Get("syn")
+	assert.True(t, ok)
+	assert.Equal(t, feats.CorpusProps{Size: 100, Lang: "cs"}, v)
+	_, ok = p.Get("other")
+	assert.False(t, ok)
+}
+
+func TestProviderMergesSources(t *testing.T) {
+	mq := newFakeMQuery(map[string]int{"syn": 1000, "intercorp": 2000})
+	defer mq.Close()
+	regs := &fakeRegistries{corpora: []ai.CorpusInfo{
+		{ID: "syn", Lang: "Czech"},
+		{ID: "intercorp", Lang: "English", Size: 10},
+		{ID: "nosize", Lang: "Czech"},
+	}}
+	overrides := map[string]feats.CorpusProps{
+		"syn": {AltCorpus: "syn_small"},
+	}
+	p := NewProvider(&Conf{UseRegistries: true, MQueryURL: mq.URL}, overrides, regs)
+	p.Refresh(context.Background())
+
+	assert.Equal(t, map[string]feats.CorpusProps{
+		"syn":       {Size: 1000, Lang: "cs", AltCorpus: "syn_small"},
+		"intercorp": {Size: 2000, Lang: "en"},
+	}, p.All())
+}
+
+func TestMQuerySourceSkipsFailingCorpus(t *testing.T) {
+	mq := newFakeMQuery(map[string]int{"syn": 1000, "broken": -1, "intercorp": 2000})
+	defer mq.Close()
+	src := &mquerySource{url: mq.URL, client: mq.Client()}
+	props, err := src.Fetch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]feats.CorpusProps{
+		"syn":       {Size: 1000},
+		"intercorp": {Size: 2000},
+	}, props)
+}
+
+func TestMQuerySourceLimitsConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	mq := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/corplist" {
+			fmt.Fprint(w, `{"corpora": [`)
+			for i := range 30 {
+				if i > 0 {
+					fmt.Fprint(w, ",")
+				}
+				fmt.Fprintf(w, `{"id": "c%d"}`, i)
+			}
+			fmt.Fprint(w, `]}`)
+			return
+		}
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, `{"corpus": {"size": 100}}`)
+	}))
+	defer mq.Close()
+	src := &mquerySource{url: mq.URL, client: mq.Client()}
+	t0 := time.Now()
+	props, err := src.Fetch(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, props, 30)
+	assert.Greater(t, maxInFlight.Load(), int32(1))
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(mqueryMaxConcurrentInfo))
+	assert.Less(t, time.Since(t0), 30*10*time.Millisecond)
+}
+
+func TestMQuerySourceCancelled(t *testing.T) {
+	mq := newFakeMQuery(map[string]int{"syn": 1000})
+	defer mq.Close()
+	src := &mquerySource{url: mq.URL, client: mq.Client()}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := src.Fetch(ctx)
+	assert.Error(t, err)
+}
+
+func TestProviderRunServesOverridesUntilLoaded(t *testing.T) {
+	block := make(chan struct{})
+	mq := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+		if r.URL.Path == "/corplist" {
+			fmt.Fprint(w, `{"corpora": [{"id": "intercorp"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"corpus": {"size": 2000}}`)
+	}))
+	defer mq.Close()
+	overrides := map[string]feats.CorpusProps{"syn": {Size: 100, Lang: "cs"}}
+	p := NewProvider(&Conf{MQueryURL: mq.URL, RefreshIntervalSecs: 3600}, overrides, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	_, ok := p.Get("syn")
+	assert.True(t, ok)
+	_, ok = p.Get("intercorp")
+	assert.False(t, ok)
+
+	close(block)
+	assert.Eventually(t, func() bool {
+		_, ok := p.Get("intercorp")
+		return ok
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestProviderOverridesWin(t *testing.T) {
+	regs := &fakeRegistries{corpora: []ai.CorpusInfo{{ID: "syn", Lang: "Czech", Size: 10}}}
+	overrides := map[string]feats.CorpusProps{"syn": {Size: 500, Lang: "en"}}
+	p := NewProvider(&Conf{UseRegistries: true}, overrides, regs)
+	p.Refresh(context.Background())
+	v, ok := p.Get("syn")
+	assert.True(t, ok)
+	assert.Equal(t, feats.CorpusProps{Size: 500, Lang: "en"}, v)
+}
+
+func TestProviderKeepsDataOfFailedSource(t *testing.T) {
+	regs := &fakeRegistries{corpora: []ai.CorpusInfo{{ID: "syn", Lang: "Czech", Size: 10}}}
+	p := NewProvider(&Conf{UseRegistries: true}, nil, regs)
+	p.Refresh(context.Background())
+	regs.err = fmt.Errorf("registry directory not available")
+	regs.corpora = nil
+	p.Refresh(context.Background())
+	v, ok := p.Get("syn")
+	assert.True(t, ok)
+	assert.Equal(t, 10, v.Size)
+}
+
+func TestConfValidate(t *testing.T) {
+	conf := Conf{}
+	assert.Error(t, conf.Validate())
+	conf = Conf{MQueryURL: "http://localhost:8989", RefreshIntervalSecs: -1}
+	assert.Error(t, conf.Validate())
+	conf = Conf{UseRegistries: true}
+	assert.NoError(t, conf.Validate())
+	assert.Equal(t, dfltRefreshIntervalSecs, conf.RefreshIntervalSecs)
+}
@@ -0,0 +1,187 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package corpprops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/cqlizer/ai"
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	mqueryRequestTimeout = 30 * time.Second
+
+	// mqueryMaxConcurrentInfo limits the number of concurrent
+	// /info/:corpusId requests
+	mqueryMaxConcurrentInfo = 8
+)
+
+// languageCodes maps registry LANGUAGE values to codes
+// used by feats.CorpusProps
+var languageCodes = map[string]string{
+	"czech":     "cs",
+	"english":   "en",
+	"german":    "de",
+	"slovak":    "sk",
+	"polish":    "pl",
+	"french":    "fr",
+	"spanish":   "es",
+	"italian":   "it",
+	"russian":   "ru",
+	"ukrainian": "uk",
+}
+
+// languageCode converts a registry LANGUAGE value (e.g. "Czech")
+// to a language code. Values which already look like a code are
+// kept. An unknown language produces an empty string.
+func languageCode(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if len(lang) == 2 {
+		return lang
+	}
+	return languageCodes[lang]
+}
+
+// Source provides properties of available corpora
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) (map[string]feats.CorpusProps, error)
+}
+
+// RegistryLister lists corpora with a registry file
+// (typically ai.CorpInfoProvider)
+type RegistryLister interface {
+	ListCorpora() ([]ai.CorpusInfo, error)
+}
+
+// ---------------------------------
+
+type registrySource struct {
+	registries RegistryLister
+}
+
+func (src *registrySource) Name() string {
+	return "registry"
+}
+
+func (src *registrySource) Fetch(ctx context.Context) (map[string]feats.CorpusProps, error) {
+	corpora, err := src.registries.ListCorpora()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list corpora registries: %w", err)
+	}
+	ans := make(map[string]feats.CorpusProps, len(corpora))
+	for _, c := range corpora {
+		ans[c.ID] = feats.CorpusProps{Size: c.Size, Lang: languageCode(c.Lang)}
+	}
+	return ans, nil
+}
+
+// ---------------------------------
+
+type mqueryCorpus struct {
+	ID string `json:"id"`
+}
+
+type mqueryCorplistResp struct {
+	Corpora []mqueryCorpus `json:"corpora"`
+}
+
+type mqueryInfoResp struct {
+	Corpus struct {
+		Size int `json:"size"`
+	} `json:"corpus"`
+}
+
+// mquerySource obtains installed corpora from MQuery's /corplist
+// and their sizes from /info/:corpusId (requested concurrently). Corpora
+// with failing /info are skipped so a single broken corpus does not hide
+// the others.
+type mquerySource struct {
+	url    string
+	client *http.Client
+}
+
+func (src *mquerySource) Name() string {
+	return "mquery"
+}
+
+func (src *mquerySource) getJSON(ctx context.Context, path string, out any) error {
+	urlObj, err := url.Parse(src.url)
+	if err != nil {
+		return fmt.Errorf("invalid MQuery URL: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlObj.JoinPath(path).String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create MQuery request: %w", err)
+	}
+	resp, err := src.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to perform MQuery request %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to perform MQuery request %s - status %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode MQuery response %s: %w", path, err)
+	}
+	return nil
+}
+
+func (src *mquerySource) Fetch(ctx context.Context) (map[string]feats.CorpusProps, error) {
+	var corplist mqueryCorplistResp
+	if err := src.getJSON(ctx, "/corplist", &corplist); err != nil {
+		return nil, err
+	}
+	ans := make(map[string]feats.CorpusProps, len(corplist.Corpora))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, mqueryMaxConcurrentInfo)
+	for _, c := range corplist.Corpora {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(corpusID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			var info mqueryInfoResp
+			if err := src.getJSON(ctx, "/info/"+url.PathEscape(corpusID), &info); err != nil {
+				if ctx.Err() == nil {
+					log.Warn().Err(err).Str("corpusId", corpusID).Msg("failed to get corpus info from MQuery, skipping")
+				}
+				return
+			}
+			mu.Lock()
+			ans[corpusID] = feats.CorpusProps{Size: info.Corpus.Size}
+			mu.Unlock()
+		}(c.ID)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch corpora info from MQuery: %w", err)
+	}
+	return ans, nil
+}
@@ -16,6 +16,10 @@
 
 //go:generate pigeon -o ./cql/grammar.go ./cql/grammar.peg
 
+// The RF and NN learning libraries use the global math/rand generator
+// which can be seeded (for reproducible training) only with this setting.
+//go:debug randseednop=0
+
 package main
 
 import (
@@ -23,16 +27,21 @@ import (
 	_ "embed"
 	"flag"
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/czcorpus/cnc-gokit/logging"
-	"github.com/czcorpus/cqlizer/ai"
+	"github.com/czcorpus/cqlizer/ai/nleval"
 	"github.com/czcorpus/cqlizer/apiserver"
 	"github.com/czcorpus/cqlizer/cnf"
+	"github.com/czcorpus/cqlizer/eval"
+	"github.com/czcorpus/cqlizer/eval/tune"
+	"github.com/rs/zerolog/log"
 )
 
 const (
@@ -43,9 +52,16 @@ const (
 	actionLearn            = "learn"
 	actionFeaturize        = "featurize"
 	actionEvaluate         = "evaluate"
+	actionModelInfo        = "model-info"
+	actionTune             = "tune"
+	actionRetrain          = "retrain"
 	actionBenchmarkMissing = "benchmark-missing"
 	actionRemoveZero       = "remove-zero"
 	actionAPIServer        = "server"
+	actionMigrate          = "migrate-monitoring"
+	actionIssueToken       = "issue-token"
+	actionActivatePrompt   = "activate-prompt"
+	actionEvalNL           = "eval-nl"
 
 	exitErrorGeneralFailure = iota
 	exitErrorImportFailed
@@ -64,6 +80,9 @@ var (
 //go:embed scripts/rfchart.py
 var rfChartScript string
 
+//go:embed scripts/learnxgb.py
+var learnXGBScript string
+
 // ---------------------------------------------
 
 func topLevelUsage() {
@@ -76,7 +95,14 @@ func topLevelUsage() {
 	fmt.Fprintf(os.Stderr, "\t%s\t\ttransform query log into features\n", actionFeaturize)
 	fmt.Fprintf(os.Stderr, "\t%s\t\tremove zero processing time items from a log\n", actionRemoveZero)
 	fmt.Fprintf(os.Stderr, "\t%s\t\t\tlearn model based on provided features\n", actionLearn)
-	fmt.Fprintf(os.Stderr, "\t%s\t\t\tevaluate model (precision, recall, f-beta) using provided data\n", actionLearn)
+	fmt.Fprintf(os.Stderr, "\t%s\t\t\tevaluate model (precision, recall, f-beta) using provided data\n", actionEvaluate)
+	fmt.Fprintf(os.Stderr, "\t%s\t\t\tsearch for best model hyperparameters using cross-validation\n", actionTune)
+	fmt.Fprintf(os.Stderr, "\t%s\t\tshow model info and its training manifest\n", actionModelInfo)
+	fmt.Fprintf(os.Stderr, "\t%s\t\tretrain model using live feedback, promote it if it performs better\n", actionRetrain)
+	fmt.Fprintf(os.Stderr, "\t%s\tcreate or update TimescaleDB monitoring schema\n", actionMigrate)
+	fmt.Fprintf(os.Stderr, "\t%s\t\tissue a signed API token (requires auth.hmacSecret)\n", actionIssueToken)
+	fmt.Fprintf(os.Stderr, "\t%s\t\tset the system prompt version used for NL -> CQL translation\n", actionActivatePrompt)
+	fmt.Fprintf(os.Stderr, "\t%s\t\t\tevaluate NL -> CQL translation quality using a gold dataset\n", actionEvalNL)
 	fmt.Fprintf(os.Stderr, "\t%s\tbenchmark queries with zero processing time (using MQuery)\n", actionBenchmarkMissing)
 	fmt.Fprintf(os.Stderr, "\t%s\t\t\tREPL for CQL evaluation\n", actionREPL)
 	fmt.Fprintf(os.Stderr, "\t%s\t\tmcp-server MCP (experimental/unfinished) \n", actionMCPServer)
@@ -97,6 +123,17 @@ func cleanVersionInfo(v string) string {
 	return strings.TrimLeft(strings.Trim(v, "'"), "v")
 }
 
+// ensureSeed returns the provided seed or, in case it is zero,
+// a new random seed. The seed is always logged so any run
+// can be reproduced.
+func ensureSeed(seed uint64) uint64 {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	log.Info().Uint64("seed", seed).Msg("using random seed")
+	return seed
+}
+
 func runActionMCPServer() {
 
 }
@@ -145,6 +182,24 @@ func main() {
 	klogImportModel := cmdKlogImport.String("model", "rf", "Specifies model which will be used (xg, rf, nn)")
 	voteThreshold := cmdKlogImport.Float64("vote-threshold", 0, "RF Vote threshold for marking CQL as problematic. This affects only evaluation. If none, then range from 0.7 to 0.99 is examined")
 	klogImportMisclassOut := cmdKlogImport.String("misclassed-query-log", "", "Specify a path to store misclassified queries. If none, no logging is performed.")
+	klogImportThreshold := cmdKlogImport.String(
+		"threshold",
+		"knee",
+		"Slow query definition: knee, fixed:SECS, percentile:P, corpus-size:MAXSIZE=SECS,...,*=SECS, bins:B1,B2,B3 (bins are supported only by RF, other models use the bins as slow/fast boundary)",
+	)
+
+	klogImportBalance := cmdKlogImport.String(
+		"balance",
+		eval.BalanceResample,
+		"How to balance fast and slow queries: resample (with replacement), undersample, smote, class-weights (xg only), none",
+	)
+	klogImportNegPosRatio := cmdKlogImport.Float64("neg-pos-ratio", 2, "Required ratio of negative (fast) to positive (slow) examples")
+	klogImportSeed := cmdKlogImport.Uint64("seed", 0, "Random seed for reproducible runs. If 0, a random seed is generated (and logged)")
+	klogImportSingleThreaded := cmdKlogImport.Bool(
+		"single-threaded",
+		false,
+		"Train RF in a single thread. This is slower but it makes seeded RF training fully reproducible",
+	)
 
 	cmdKlogImport.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s learn [options] config.json features_file.msgpack\n", os.Args[0])
@@ -161,12 +216,79 @@ func main() {
 		cmdEvaluate.PrintDefaults()
 	}
 
+	cmdTune := flag.NewFlagSet(actionTune, flag.ExitOnError)
+	tuneModel := cmdTune.String("model", "rf", "Specifies model which will be tuned (xg, rf, nn)")
+	tuneSearch := cmdTune.String("search", tune.SearchGrid, "Search method (grid, random)")
+	tuneTrials := cmdTune.Int("trials", 10, "Number of evaluated configurations for the random search")
+	tuneFolds := cmdTune.Int("folds", 5, "Number of cross-validation folds")
+	tuneSpace := cmdTune.String(
+		"space",
+		"",
+		"A JSON file with hyperparameter candidates (e.g. {\"numTrees\": [50, 100]}). If omitted, a built-in search space is used",
+	)
+	tuneThreshold := cmdTune.String("threshold", "knee", "Slow query definition (see the learn action)")
+	tuneBalance := cmdTune.String("balance", eval.BalanceResample, "How to balance fast and slow queries (see the learn action)")
+	tuneNegPosRatio := cmdTune.Float64("neg-pos-ratio", 2, "Required ratio of negative (fast) to positive (slow) examples")
+	tuneSeed := cmdTune.Uint64("seed", 0, "Random seed for reproducible runs. If 0, a random seed is generated (and logged)")
+	tuneSingleThreaded := cmdTune.Bool("single-threaded", false, "Train RF in a single thread (see the learn action)")
+	cmdTune.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s tune [options] config.json features_file.msgpack\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		cmdTune.PrintDefaults()
+	}
+
+	cmdRetrain := flag.NewFlagSet(actionRetrain, flag.ExitOnError)
+	retrainModel := cmdRetrain.String("model", "", "Specifies model type (rf, nn). If omitted, it is inferred from the file name")
+	retrainHoldout := cmdRetrain.Float64("holdout", 0.3, "Portion of feedback data used for comparing the current and the new model")
+	retrainMinImprovement := cmdRetrain.Float64("min-improvement", 0, "Minimal F-beta improvement required to promote the new model")
+	retrainBalance := cmdRetrain.String("balance", eval.BalanceResample, "How to balance fast and slow queries (see the learn action)")
+	retrainNegPosRatio := cmdRetrain.Float64("neg-pos-ratio", 2, "Required ratio of negative (fast) to positive (slow) examples")
+	retrainSeed := cmdRetrain.Uint64("seed", 0, "Random seed for reproducible runs. If 0, a random seed is generated (and logged)")
+	retrainSingleThreaded := cmdRetrain.Bool("single-threaded", false, "Train RF in a single thread (see the learn action)")
+	cmdRetrain.Usage = func() {
+		fmt.Fprintf(
+			os.Stderr,
+			"Usage: %s retrain [options] config.json features_file.msgpack feedback.jsonl current_model_file\n",
+			os.Args[0],
+		)
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		cmdRetrain.PrintDefaults()
+	}
+
+	cmdModelInfo := flag.NewFlagSet(actionModelInfo, flag.ExitOnError)
+	cmdModelInfoModel := cmdModelInfo.String("model", "", "Specifies model type (xg, rf, nn). If omitted, it is inferred from the file name")
+	cmdModelInfo.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s model-info [options] model_file\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		cmdModelInfo.PrintDefaults()
+	}
+
 	cmdFeaturize := flag.NewFlagSet(actionFeaturize, flag.ExitOnError)
 	featurizeDebug := cmdFeaturize.Bool(
 		"debug",
 		false,
 		"if set then features will be written to stdout in human readable form and no feats file will be created",
 	)
+	featurizeAggregation := cmdFeaturize.String(
+		"aggregation",
+		eval.AggregationMedian,
+		"how to merge repeated measurements of a query (median, trimmed-mean, p90)",
+	)
+	featurizeTrimRatio := cmdFeaturize.Float64(
+		"trim-ratio",
+		0.1,
+		"portion of values removed from each end when using the trimmed-mean aggregation",
+	)
+	featurizeOutliers := cmdFeaturize.String(
+		"outlier-rejection",
+		eval.OutlierRejectionNone,
+		"how to reject outlying repeated measurements (none, zscore, mad)",
+	)
+	featurizeOutlierThreshold := cmdFeaturize.Float64(
+		"outlier-threshold",
+		3.5,
+		"max. (modified) z-score of a measurement to be kept",
+	)
 	cmdFeaturize.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s featurize [options] config.json logfile.txt\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\nOptions:\n")
@@ -195,6 +317,50 @@ func main() {
 		cmdAPIServer.PrintDefaults()
 	}
 
+	cmdMigrate := flag.NewFlagSet(actionMigrate, flag.ExitOnError)
+	migratePrint := cmdMigrate.Bool("print", false, "Only print the SQL statements (config file is not required)")
+	cmdMigrate.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [options] config.json\n", os.Args[0], actionMigrate)
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		cmdMigrate.PrintDefaults()
+	}
+
+	cmdIssueToken := flag.NewFlagSet(actionIssueToken, flag.ExitOnError)
+	issueTokenName := cmdIssueToken.String("name", "", "Name of the client the token is issued for")
+	issueTokenScopes := cmdIssueToken.String("scopes", "evaluate", "Comma-separated scopes (evaluate, translate, admin)")
+	issueTokenTTL := cmdIssueToken.Duration("ttl", 30*24*time.Hour, "Token validity (0 = no expiration)")
+	cmdIssueToken.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [options] config.json\n", os.Args[0], actionIssueToken)
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		cmdIssueToken.PrintDefaults()
+	}
+
+	cmdActivatePrompt := flag.NewFlagSet(actionActivatePrompt, flag.ExitOnError)
+	activatePromptVersion := cmdActivatePrompt.Int("version", 0, "Prompt version to activate (0 = latest)")
+	activatePromptReset := cmdActivatePrompt.Bool("reset", false, "Switch back to the default system prompt (ai.systemPromptFile)")
+	cmdActivatePrompt.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [options] config.json [prompt name]\n", os.Args[0], actionActivatePrompt)
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		cmdActivatePrompt.PrintDefaults()
+	}
+
+	cmdEvalNL := flag.NewFlagSet(actionEvalNL, flag.ExitOnError)
+	evalNLPrompts := cmdEvalNL.String(
+		"prompts",
+		nleval.PromptActive,
+		"Comma-separated prompts to compare (default, active, name or name@vN)",
+	)
+	evalNLBackend := cmdEvalNL.String("backend", "", "LLM backend to use (other backends serve as fallbacks)")
+	evalNLReport := cmdEvalNL.String("report", "", "A path to store the full JSON report (including individual cases)")
+	evalNLNoCost := cmdEvalNL.Bool("no-cost", false, "Do not estimate cost of the generated queries")
+	cmdEvalNL.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s [options] config.json dataset.jsonl\n", os.Args[0], actionEvalNL)
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		cmdEvalNL.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nThe dataset contains one JSON object per line:\n")
+		fmt.Fprintf(os.Stderr, "{\"id\": \"...\", \"input\": \"...\", \"corpname\": \"...\", \"expected\": \"...\"}\n")
+	}
+
 	action := actionHelp
 	if len(os.Args) > 1 {
 		action = os.Args[1]
@@ -218,6 +384,20 @@ func main() {
 			cmdMCP.PrintDefaults()
 		case actionREPL:
 			cmdREPL.PrintDefaults()
+		case actionModelInfo:
+			cmdModelInfo.PrintDefaults()
+		case actionTune:
+			cmdTune.PrintDefaults()
+		case actionRetrain:
+			cmdRetrain.PrintDefaults()
+		case actionMigrate:
+			cmdMigrate.PrintDefaults()
+		case actionIssueToken:
+			cmdIssueToken.PrintDefaults()
+		case actionActivatePrompt:
+			cmdActivatePrompt.PrintDefaults()
+		case actionEvalNL:
+			cmdEvalNL.Usage()
 		}
 	case actionVersion:
 		cmdVersion.Parse(os.Args[2:])
@@ -244,7 +424,15 @@ func main() {
 			*klogImportModel,
 			*numTrees,
 			*voteThreshold,
+			*klogImportThreshold,
+			eval.BalanceConf{
+				Strategy:    *klogImportBalance,
+				NegPosRatio: *klogImportNegPosRatio,
+				Seed:        ensureSeed(*klogImportSeed),
+			},
+			*klogImportSingleThreaded,
 			*klogImportMisclassOut,
+			version,
 		)
 	case actionEvaluate:
 		cmdEvaluate.Parse(os.Args[2:])
@@ -256,6 +444,60 @@ func main() {
 			cmdEvaluate.Arg(2),
 			*cmdEvaluateMisclassOut,
 		)
+	case actionTune:
+		cmdTune.Parse(os.Args[2:])
+		conf := setup(cmdTune.Arg(0))
+		seed := ensureSeed(*tuneSeed)
+		runActionTune(
+			conf,
+			cmdTune.Arg(1),
+			*tuneModel,
+			*tuneSpace,
+			*tuneThreshold,
+			eval.BalanceConf{
+				Strategy:    *tuneBalance,
+				NegPosRatio: *tuneNegPosRatio,
+				Seed:        seed,
+			},
+			tune.Conf{
+				Search:    *tuneSearch,
+				NumTrials: *tuneTrials,
+				NumFolds:  *tuneFolds,
+				Seed:      seed,
+			},
+			*tuneSingleThreaded,
+			version,
+		)
+	case actionRetrain:
+		cmdRetrain.Parse(os.Args[2:])
+		if cmdRetrain.NArg() < 4 {
+			cmdRetrain.Usage()
+			os.Exit(1)
+		}
+		conf := setup(cmdRetrain.Arg(0))
+		runActionRetrain(
+			conf,
+			cmdRetrain.Arg(1),
+			cmdRetrain.Arg(2),
+			*retrainModel,
+			cmdRetrain.Arg(3),
+			*retrainHoldout,
+			*retrainMinImprovement,
+			eval.BalanceConf{
+				Strategy:    *retrainBalance,
+				NegPosRatio: *retrainNegPosRatio,
+				Seed:        ensureSeed(*retrainSeed),
+			},
+			*retrainSingleThreaded,
+			version,
+		)
+	case actionModelInfo:
+		cmdModelInfo.Parse(os.Args[2:])
+		if cmdModelInfo.NArg() < 1 {
+			cmdModelInfo.Usage()
+			os.Exit(1)
+		}
+		runActionModelInfo(*cmdModelInfoModel, cmdModelInfo.Arg(0))
 	case actionFeaturize:
 		cmdFeaturize.Parse(os.Args[2:])
 		conf := setup(cmdFeaturize.Arg(0))
@@ -266,6 +508,12 @@ func main() {
 			conf,
 			cmdFeaturize.Arg(1),
 			cmdFeaturize.Arg(2),
+			eval.DedupConf{
+				Aggregation:      *featurizeAggregation,
+				TrimRatio:        featurizeTrimRatio,
+				OutlierRejection: *featurizeOutliers,
+				OutlierThreshold: *featurizeOutlierThreshold,
+			},
 			*featurizeDebug,
 		)
 	case actionBenchmarkMissing:
@@ -296,26 +544,65 @@ func main() {
 			cmdRemoveZero.Arg(1),
 		)
 
+	case actionMigrate:
+		cmdMigrate.Parse(os.Args[2:])
+		if *migratePrint {
+			runActionMigrateMonitoring(nil, true)
+			return
+		}
+		if cmdMigrate.NArg() < 1 {
+			cmdMigrate.Usage()
+			os.Exit(1)
+		}
+		runActionMigrateMonitoring(setup(cmdMigrate.Arg(0)), false)
+	case actionIssueToken:
+		cmdIssueToken.Parse(os.Args[2:])
+		if cmdIssueToken.NArg() < 1 {
+			cmdIssueToken.Usage()
+			os.Exit(1)
+		}
+		runActionIssueToken(setup(cmdIssueToken.Arg(0)), *issueTokenName, *issueTokenScopes, *issueTokenTTL)
+	case actionActivatePrompt:
+		cmdActivatePrompt.Parse(os.Args[2:])
+		if cmdActivatePrompt.NArg() < 1 {
+			cmdActivatePrompt.Usage()
+			os.Exit(1)
+		}
+		runActionActivatePrompt(
+			setup(cmdActivatePrompt.Arg(0)),
+			cmdActivatePrompt.Arg(1),
+			*activatePromptVersion,
+			*activatePromptReset,
+		)
+	case actionEvalNL:
+		cmdEvalNL.Parse(os.Args[2:])
+		if cmdEvalNL.NArg() < 2 {
+			cmdEvalNL.Usage()
+			os.Exit(1)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		runActionEvalNL(
+			ctx,
+			setup(cmdEvalNL.Arg(0)),
+			cmdEvalNL.Arg(1),
+			*evalNLPrompts,
+			*evalNLBackend,
+			*evalNLReport,
+			*evalNLNoCost,
+		)
 	case actionAPIServer:
 		cmdAPIServer.Parse(os.Args[2:])
 		conf := setup(cmdAPIServer.Arg(0))
 		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 		defer stop()
 
-		sysprompt, err := os.ReadFile(conf.AI.SystemPromptFile)
+		cqlTranslat, corpusInfo, err := initCQLTranslator(conf)
 		if err != nil {
-			fmt.Printf("failed to load system prompt: %s\n", err)
+			fmt.Println(err)
 			os.Exit(1)
 		}
-		corpusInfo := ai.NewCorpInfoProvider(conf.AI.CorporaRegistryDir)
-		cqlTranslat := ai.NewCQLTRanslator(
-			conf.AI.APIURL,
-			string(sysprompt),
-			conf.AI.CustomSystemPromptsDir,
-			conf.AI.ModelName,
-			corpusInfo,
-		)
-		apiserver.Run(ctx, conf, cqlTranslat, version)
+		apiserver.Run(ctx, conf, cqlTranslat, corpusInfo, version)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown action, please use 'help' to get more information")
 	}
@@ -0,0 +1,274 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/czcorpus/cqlizer/eval/feats"
+)
+
+const (
+	// BalanceResample draws negative examples randomly with replacement
+	// (the original CQLizer behavior)
+	BalanceResample = "resample"
+
+	// BalanceUndersample draws negative examples randomly without replacement
+	BalanceUndersample = "undersample"
+
+	// BalanceSMOTE keeps all negative examples and adds synthetic positive
+	// examples interpolated between existing positive examples and their
+	// nearest positive neighbors in the feature space
+	BalanceSMOTE = "smote"
+
+	// BalanceClassWeights keeps all the data and increases weights
+	// of positive examples instead. This is supported only by models
+	// with native support for sample weights.
+	BalanceClassWeights = "class-weights"
+
+	// BalanceNone keeps the data as they are
+	BalanceNone = "none"
+
+	dfltNegPosRatio   = 2.0
+	dfltSMOTENeighbor = 5
+)
+
+// classWeightedLearner is implemented by models which can use
+// per-sample weights directly (i.e. without emulating them
+// by repeating samples) and thus can be trained on class-weighted data
+type classWeightedLearner interface {
+
+	// SetClassWeighted tells the model that class imbalance
+	// is already solved via sample weights
+	SetClassWeighted(v bool)
+}
+
+// BalanceConf configures how learning data with a typically
+// small portion of slow queries are balanced.
+type BalanceConf struct {
+	Strategy string
+
+	// NegPosRatio is the required ratio between negative (fast)
+	// and positive (slow) examples
+	NegPosRatio float64
+
+	// SMOTENeighbors is the number of nearest neighbors considered
+	// when generating synthetic examples
+	SMOTENeighbors int
+
+	// Seed initializes the random generator used for sampling.
+	// The same seed and data always produce the same sample.
+	Seed uint64
+}
+
+func (conf BalanceConf) WithDefaults() BalanceConf {
+	if conf.Strategy == "" {
+		conf.Strategy = BalanceResample
+	}
+	if conf.NegPosRatio == 0 {
+		conf.NegPosRatio = dfltNegPosRatio
+	}
+	if conf.SMOTENeighbors == 0 {
+		conf.SMOTENeighbors = dfltSMOTENeighbor
+	}
+	return conf
+}
+
+func (conf BalanceConf) Validate() error {
+	switch conf.Strategy {
+	case BalanceResample, BalanceUndersample, BalanceSMOTE, BalanceClassWeights, BalanceNone:
+	default:
+		return fmt.Errorf("unknown balancing strategy: %s", conf.Strategy)
+	}
+	if conf.NegPosRatio <= 0 {
+		return fmt.Errorf("invalid negative/positive ratio %.2f", conf.NegPosRatio)
+	}
+	if conf.SMOTENeighbors < 1 {
+		return fmt.Errorf("invalid number of SMOTE neighbors %d", conf.SMOTENeighbors)
+	}
+	return nil
+}
+
+func (conf BalanceConf) numNegative(numPositive int) int {
+	return int(math.Round(float64(numPositive) * conf.NegPosRatio))
+}
+
+func (conf BalanceConf) resample(rnd *rand.Rand, positive, negative []feats.QueryEvaluation) []feats.QueryEvaluation {
+	ans := make([]feats.QueryEvaluation, 0, len(positive)+conf.numNegative(len(positive)))
+	if len(negative) > 0 {
+		for range conf.numNegative(len(positive)) {
+			ans = append(ans, negative[rnd.IntN(len(negative))])
+		}
+	}
+	return append(ans, positive...)
+}
+
+func (conf BalanceConf) undersample(rnd *rand.Rand, positive, negative []feats.QueryEvaluation) []feats.QueryEvaluation {
+	numNeg := min(conf.numNegative(len(positive)), len(negative))
+	ans := make([]feats.QueryEvaluation, 0, len(positive)+numNeg)
+	for _, idx := range rnd.Perm(len(negative))[:numNeg] {
+		ans = append(ans, negative[idx])
+	}
+	return append(ans, positive...)
+}
+
+func (conf BalanceConf) classWeights(positive, negative []feats.QueryEvaluation) []feats.QueryEvaluation {
+	ans := make([]feats.QueryEvaluation, 0, len(positive)+len(negative))
+	ans = append(ans, negative...)
+	if len(positive) == 0 {
+		return ans
+	}
+	// weight such that sum(neg weights) / sum(pos weights) == NegPosRatio
+	var sumNeg, sumPos float64
+	for _, v := range negative {
+		sumNeg += v.SampleWeight()
+	}
+	for _, v := range positive {
+		sumPos += v.SampleWeight()
+	}
+	coeff := math.Max(1, sumNeg/(sumPos*conf.NegPosRatio))
+	for _, v := range positive {
+		v.Weight = v.SampleWeight() * coeff
+		ans = append(ans, v)
+	}
+	return ans
+}
+
+// normalizedFeatures returns min-max normalized feature vectors
+// so no feature dominates distance calculation
+func normalizedFeatures(data []feats.QueryEvaluation) [][]float64 {
+	vectors := make([][]float64, len(data))
+	mins := make([]float64, feats.NumFeatures)
+	maxs := make([]float64, feats.NumFeatures)
+	for i := range feats.NumFeatures {
+		mins[i] = math.Inf(1)
+		maxs[i] = math.Inf(-1)
+	}
+	for i, v := range data {
+		vectors[i] = feats.ExtractFeatures(v)
+		for j, x := range vectors[i] {
+			mins[j] = math.Min(mins[j], x)
+			maxs[j] = math.Max(maxs[j], x)
+		}
+	}
+	for _, vec := range vectors {
+		for j := range vec {
+			if maxs[j] > mins[j] {
+				vec[j] = (vec[j] - mins[j]) / (maxs[j] - mins[j])
+
+			} else {
+				vec[j] = 0
+			}
+		}
+	}
+	return vectors
+}
+
+func sqDistance(v1, v2 []float64) float64 {
+	var ans float64
+	for i := range v1 {
+		d := v1[i] - v2[i]
+		ans += d * d
+	}
+	return ans
+}
+
+// nearestNeighbors returns indices of k nearest neighbors of each vector
+func nearestNeighbors(vectors [][]float64, k int) [][]int {
+	type candidate struct {
+		idx  int
+		dist float64
+	}
+	ans := make([][]int, len(vectors))
+	candidates := make([]candidate, 0, len(vectors))
+	for i, v1 := range vectors {
+		candidates = candidates[:0]
+		for j, v2 := range vectors {
+			if i != j {
+				candidates = append(candidates, candidate{idx: j, dist: sqDistance(v1, v2)})
+			}
+		}
+		slices.SortStableFunc(candidates, func(c1, c2 candidate) int {
+			if c1.dist < c2.dist {
+				return -1
+
+			} else if c1.dist > c2.dist {
+				return 1
+			}
+			return 0
+		})
+		numNeigh := min(k, len(candidates))
+		ans[i] = make([]int, numNeigh)
+		for j := range numNeigh {
+			ans[i][j] = candidates[j].idx
+		}
+	}
+	return ans
+}
+
+func (conf BalanceConf) smote(rnd *rand.Rand, positive, negative []feats.QueryEvaluation) []feats.QueryEvaluation {
+	numRequired := int(math.Round(float64(len(negative)) / conf.NegPosRatio))
+	ans := make([]feats.QueryEvaluation, 0, len(negative)+max(len(positive), numRequired))
+	ans = append(ans, negative...)
+	ans = append(ans, positive...)
+	if len(positive) < 2 || numRequired <= len(positive) {
+		return ans
+	}
+	neighbors := nearestNeighbors(normalizedFeatures(positive), conf.SMOTENeighbors)
+	for range numRequired - len(positive) {
+		srcIdx := rnd.IntN(len(positive))
+		neighIdx := neighbors[srcIdx][rnd.IntN(len(neighbors[srcIdx]))]
+		ans = append(ans, positive[srcIdx].Interpolate(positive[neighIdx], rnd.Float64()))
+	}
+	return ans
+}
+
+// Balance creates a balanced sample of learning data according
+// to the configured strategy. The `isPositive` function decides
+// which examples represent the (minority) slow queries.
+func (conf BalanceConf) Balance(
+	data []feats.QueryEvaluation,
+	isPositive func(feats.QueryEvaluation) bool,
+) (sample []feats.QueryEvaluation, numPositive, numNegative int) {
+	positive := make([]feats.QueryEvaluation, 0, len(data)/2)
+	negative := make([]feats.QueryEvaluation, 0, len(data))
+	for _, v := range data {
+		if isPositive(v) {
+			positive = append(positive, v)
+
+		} else {
+			negative = append(negative, v)
+		}
+	}
+	rnd := rand.New(rand.NewPCG(conf.Seed, conf.Seed))
+	switch conf.Strategy {
+	case BalanceResample:
+		sample = conf.resample(rnd, positive, negative)
+	case BalanceSMOTE:
+		sample = conf.smote(rnd, positive, negative)
+	case BalanceClassWeights:
+		sample = conf.classWeights(positive, negative)
+	case BalanceNone:
+		sample = slices.Clone(data)
+	default:
+		sample = conf.undersample(rnd, positive, negative)
+	}
+	return sample, len(positive), len(negative)
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eval
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/stretchr/testify/assert"
+)
+
+func createBalanceTestData(numNeg, numPos int) []feats.QueryEvaluation {
+	ans := make([]feats.QueryEvaluation, 0, numNeg+numPos)
+	for i := range numNeg {
+		ans = append(ans, feats.QueryEvaluation{OrigQuery: fmt.Sprintf("n%d", i), ProcTime: 0.1})
+	}
+	for i := range numPos {
+		ans = append(
+			ans,
+			feats.QueryEvaluation{
+				OrigQuery:  fmt.Sprintf("p%d", i),
+				ProcTime:   10 + float64(i),
+				CorpusSize: float64(i),
+				Positions:  []feats.Position{{NumAlternatives: 1 + i%3}},
+			},
+		)
+	}
+	return ans
+}
+
+func isSlowTestQuery(v feats.QueryEvaluation) bool {
+	return v.ProcTime >= 10
+}
+
+func TestUndersampleWithoutReplacement(t *testing.T) {
+	conf := BalanceConf{Strategy: BalanceUndersample, Seed: 42}.WithDefaults()
+	sample, numPos, numNeg := conf.Balance(createBalanceTestData(100, 10), isSlowTestQuery)
+	assert.Equal(t, 10, numPos)
+	assert.Equal(t, 100, numNeg)
+	assert.Len(t, sample, 30)
+	uniq := make(map[string]bool)
+	for _, v := range sample {
+		assert.False(t, uniq[v.OrigQuery])
+		uniq[v.OrigQuery] = true
+	}
+}
+
+func TestBalanceIsDeterministic(t *testing.T) {
+	data := createBalanceTestData(100, 10)
+	for _, strategy := range []string{BalanceResample, BalanceUndersample, BalanceSMOTE} {
+		conf := BalanceConf{Strategy: strategy, Seed: 1234}.WithDefaults()
+		s1, _, _ := conf.Balance(data, isSlowTestQuery)
+		s2, _, _ := conf.Balance(data, isSlowTestQuery)
+		assert.Equal(t, s1, s2, strategy)
+	}
+}
+
+func TestSMOTEAddsSyntheticPositives(t *testing.T) {
+	conf := BalanceConf{Strategy: BalanceSMOTE, Seed: 1}.WithDefaults()
+	sample, _, _ := conf.Balance(createBalanceTestData(100, 10), isSlowTestQuery)
+	var numPos int
+	for _, v := range sample {
+		if isSlowTestQuery(v) {
+			numPos++
+		}
+	}
+	assert.Equal(t, 50, numPos)
+	assert.Len(t, sample, 150)
+}
+
+func TestClassWeights(t *testing.T) {
+	conf := BalanceConf{Strategy: BalanceClassWeights}.WithDefaults()
+	sample, _, _ := conf.Balance(createBalanceTestData(100, 10), isSlowTestQuery)
+	assert.Len(t, sample, 110)
+	var sumPos, sumNeg float64
+	for _, v := range sample {
+		if isSlowTestQuery(v) {
+			sumPos += v.SampleWeight()
+
+		} else {
+			sumNeg += v.SampleWeight()
+		}
+	}
+	assert.InDelta(t, 2.0, sumNeg/sumPos, 0.0001)
+}
+
+func TestBalanceConfDefaultStrategy(t *testing.T) {
+	assert.Equal(t, BalanceResample, BalanceConf{}.WithDefaults().Strategy)
+}
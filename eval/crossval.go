@@ -0,0 +1,213 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/czcorpus/cqlizer/eval/manifest"
+	"github.com/czcorpus/cqlizer/eval/threshold"
+)
+
+const (
+	minVoteThreshold  = 0.5
+	maxVoteThreshold  = 1.0
+	voteThresholdStep = 0.01
+)
+
+// CVResult contains results of a k-fold cross-validation. All the values
+// are related to the vote threshold with the best mean F-beta over folds.
+type CVResult struct {
+	VoteThreshold float64
+	MeanPrecision float64
+	MeanRecall    float64
+	MeanFBeta     float64
+	StdDevFBeta   float64
+	FoldFBeta     []float64
+}
+
+// stratifiedFolds splits data into `numFolds` folds so that each fold
+// contains roughly the same portion of slow queries
+func stratifiedFolds(
+	data []feats.QueryEvaluation,
+	numFolds int,
+	isPositive func(feats.QueryEvaluation) bool,
+	seed uint64,
+) [][]feats.QueryEvaluation {
+	rnd := rand.New(rand.NewPCG(seed, seed))
+	folds := make([][]feats.QueryEvaluation, numFolds)
+	var positive, negative []int
+	for i, v := range data {
+		if isPositive(v) {
+			positive = append(positive, i)
+
+		} else {
+			negative = append(negative, i)
+		}
+	}
+	var numAssigned int
+	for _, group := range [][]int{positive, negative} {
+		rnd.Shuffle(len(group), func(i, j int) { group[i], group[j] = group[j], group[i] })
+		for _, idx := range group {
+			folds[numAssigned%numFolds] = append(folds[numAssigned%numFolds], data[idx])
+			numAssigned++
+		}
+	}
+	return folds
+}
+
+// SplitHoldout splits data into training and held-out parts so that both
+// parts contain roughly the same portion of slow queries.
+func SplitHoldout(
+	data []feats.QueryEvaluation,
+	holdoutRatio float64,
+	isPositive func(feats.QueryEvaluation) bool,
+	seed uint64,
+) (train, holdout []feats.QueryEvaluation) {
+	rnd := rand.New(rand.NewPCG(seed, seed))
+	var positive, negative []feats.QueryEvaluation
+	for _, v := range data {
+		if isPositive(v) {
+			positive = append(positive, v)
+
+		} else {
+			negative = append(negative, v)
+		}
+	}
+	for _, group := range [][]feats.QueryEvaluation{positive, negative} {
+		rnd.Shuffle(len(group), func(i, j int) { group[i], group[j] = group[j], group[i] })
+		numHoldout := int(math.Round(float64(len(group)) * holdoutRatio))
+		holdout = append(holdout, group[:numHoldout]...)
+		train = append(train, group[numHoldout:]...)
+	}
+	return
+}
+
+// EvaluateModel calculates precision, recall and F-beta of a model
+// on provided data for the whole range of vote thresholds. The original
+// class threshold of the model is restored afterwards.
+func EvaluateModel(mlModel MLModel, data []feats.QueryEvaluation, thr threshold.Definition) []manifest.Metrics {
+	predictor := &Predictor{
+		mlModel:     mlModel,
+		Evaluations: data,
+		threshold:   thr,
+	}
+	origClassThreshold := mlModel.GetClassThreshold()
+	numVotes := int(math.Round((maxVoteThreshold - minVoteThreshold) / voteThresholdStep))
+	ans := make([]manifest.Metrics, numVotes)
+	for k := range numVotes {
+		v := minVoteThreshold + float64(k)*voteThresholdStep
+		mlModel.SetClassThreshold(v)
+		precall := predictor.PrecisionAndRecall(nil)
+		ans[k] = manifest.Metrics{
+			VoteThreshold: v,
+			Precision:     zeroIfNaN(precall.Precision),
+			Recall:        zeroIfNaN(precall.Recall),
+			FBeta:         precall.FBeta,
+		}
+	}
+	mlModel.SetClassThreshold(origClassThreshold)
+	return ans
+}
+
+// CrossValidate evaluates a model configuration using stratified k-fold
+// cross-validation on the loaded (and deduplicated) data. The `newModel`
+// function must create a fresh untrained model. Only the training part
+// of each split is balanced, the held-out fold keeps the original
+// distribution of slow and fast queries.
+// The threshold must be resolved before calling this (see ResolveThreshold).
+func (model *Predictor) CrossValidate(
+	ctx context.Context,
+	newModel func() (MLModel, error),
+	numFolds int,
+	balanceConf BalanceConf,
+) (CVResult, error) {
+	var ans CVResult
+	if numFolds < 2 {
+		return ans, fmt.Errorf("invalid number of folds %d", numFolds)
+	}
+	if !model.threshold.IsResolved() {
+		return ans, fmt.Errorf("cannot cross-validate - unresolved slow queries threshold")
+	}
+	if balanceConf.Strategy == BalanceClassWeights {
+		return ans, fmt.Errorf("class weights balancing is not supported in cross-validation")
+	}
+	folds := stratifiedFolds(model.Evaluations, numFolds, model.threshold.IsSlow, balanceConf.Seed)
+	numVotes := int(math.Round((maxVoteThreshold - minVoteThreshold) / voteThresholdStep))
+	results := make([][]PrecAndRecall, numVotes)
+	for i := range folds {
+		if err := ctx.Err(); err != nil {
+			return ans, err
+		}
+		var trainData []feats.QueryEvaluation
+		for j, fold := range folds {
+			if j != i {
+				trainData = append(trainData, fold...)
+			}
+		}
+		trainData, _, _ = balanceConf.Balance(trainData, model.threshold.IsSlow)
+		mlModel, err := newModel()
+		if err != nil {
+			return ans, fmt.Errorf("failed to create model for fold %d: %w", i, err)
+		}
+		if err := mlModel.Train(ctx, trainData, model.threshold, ""); err != nil {
+			return ans, fmt.Errorf("failed to train model for fold %d: %w", i, err)
+		}
+		foldPredictor := &Predictor{
+			mlModel:     mlModel,
+			Evaluations: folds[i],
+			threshold:   model.threshold,
+		}
+		for k := range numVotes {
+			mlModel.SetClassThreshold(minVoteThreshold + float64(k)*voteThresholdStep)
+			results[k] = append(results[k], foldPredictor.PrecisionAndRecall(nil))
+		}
+	}
+	ans.MeanFBeta = -1
+	for k, items := range results {
+		var sumP, sumR, sumF float64
+		for _, item := range items {
+			sumP += zeroIfNaN(item.Precision)
+			sumR += zeroIfNaN(item.Recall)
+			sumF += item.FBeta
+		}
+		meanF := sumF / float64(len(items))
+		if meanF > ans.MeanFBeta {
+			ans.VoteThreshold = minVoteThreshold + float64(k)*voteThresholdStep
+			ans.MeanPrecision = sumP / float64(len(items))
+			ans.MeanRecall = sumR / float64(len(items))
+			ans.MeanFBeta = meanF
+			ans.FoldFBeta = make([]float64, len(items))
+			for i, item := range items {
+				ans.FoldFBeta[i] = item.FBeta
+			}
+		}
+	}
+	_, ans.StdDevFBeta = meanAndStdDev(ans.FoldFBeta)
+	return ans, nil
+}
+
+func zeroIfNaN(v float64) float64 {
+	if math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
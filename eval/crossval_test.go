@@ -0,0 +1,95 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/czcorpus/cqlizer/eval/rf"
+	"github.com/czcorpus/cqlizer/eval/threshold"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStratifiedFolds(t *testing.T) {
+	data := createBalanceTestData(100, 10)
+	folds := stratifiedFolds(data, 5, isSlowTestQuery, 42)
+	assert.Len(t, folds, 5)
+	var total int
+	for _, fold := range folds {
+		var numPos int
+		for _, v := range fold {
+			if isSlowTestQuery(v) {
+				numPos++
+			}
+		}
+		assert.Equal(t, 2, numPos)
+		total += len(fold)
+	}
+	assert.Equal(t, len(data), total)
+}
+
+func TestCrossValidate(t *testing.T) {
+	predictor := &Predictor{
+		Evaluations: createBalanceTestData(100, 20),
+		threshold:   threshold.Definition{Method: threshold.MethodFixed, Time: 10},
+	}
+	res, err := predictor.CrossValidate(
+		context.Background(),
+		func() (MLModel, error) {
+			return rf.NewModel(10, 0.5, 0), nil
+		},
+		4,
+		BalanceConf{Strategy: BalanceUndersample, Seed: 1}.WithDefaults(),
+	)
+	assert.NoError(t, err)
+	assert.Len(t, res.FoldFBeta, 4)
+	assert.GreaterOrEqual(t, res.VoteThreshold, minVoteThreshold)
+	assert.Less(t, res.VoteThreshold, maxVoteThreshold)
+}
+
+func TestCrossValidateCancelled(t *testing.T) {
+	predictor := &Predictor{
+		Evaluations: createBalanceTestData(100, 20),
+		threshold:   threshold.Definition{Method: threshold.MethodFixed, Time: 10},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := predictor.CrossValidate(
+		ctx,
+		func() (MLModel, error) {
+			return rf.NewModel(10, 0.5, 0), nil
+		},
+		4,
+		BalanceConf{Strategy: BalanceUndersample, Seed: 1}.WithDefaults(),
+	)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSplitHoldout(t *testing.T) {
+	data := createBalanceTestData(100, 10)
+	train, holdout := SplitHoldout(data, 0.3, isSlowTestQuery, 42)
+	assert.Len(t, holdout, 33)
+	assert.Len(t, train, 77)
+	var numPos int
+	for _, v := range holdout {
+		if isSlowTestQuery(v) {
+			numPos++
+		}
+	}
+	assert.Equal(t, 3, numPos)
+}
@@ -0,0 +1,269 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eval
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+const (
+	AggregationMedian      = "median"
+	AggregationTrimmedMean = "trimmed-mean"
+	AggregationP90         = "p90"
+
+	OutlierRejectionNone   = "none"
+	OutlierRejectionZScore = "zscore"
+	OutlierRejectionMAD    = "mad"
+
+	dfltTrimRatio        = 0.1
+	dfltOutlierThreshold = 3.5
+
+	// madConsistencyConst makes the MAD comparable with the standard
+	// deviation of normally distributed data
+	madConsistencyConst = 0.6745
+
+	// minOutlierSampleSize is the minimum number of repeated measurements
+	// needed before we try to reject any of them as outliers
+	minOutlierSampleSize = 3
+
+	// minZScoreSampleSize is the minimum number of measurements for
+	// the "zscore" method. With fewer values, the leave-one-out standard
+	// deviation is based on 1-3 values only and ordinary noise would
+	// be rejected, so MAD is used instead.
+	minZScoreSampleSize = 5
+
+	// zeroSpreadRelTolerance is a relative difference from identical
+	// values still not considered an outlier (i.e. a float rounding error)
+	zeroSpreadRelTolerance = 1e-6
+)
+
+// DedupConf specifies how repeated measurements of the same query
+// (same query, same corpus/subcorpus size) are merged into a single
+// learning record.
+type DedupConf struct {
+
+	// Aggregation is one of "median", "trimmed-mean", "p90"
+	Aggregation string
+
+	// TrimRatio is the portion of values removed from each end
+	// of the sorted measurements when using "trimmed-mean"
+	// (nil means the default ratio, 0 means no trimming)
+	TrimRatio *float64
+
+	// OutlierRejection is one of "none", "zscore", "mad". The "zscore"
+	// method uses a leave-one-out z-score, i.e. each measurement is compared
+	// with the mean and the standard deviation of the other ones. Otherwise,
+	// a single spike inflates the deviation so much it can never exceed
+	// the threshold for small samples. For less than minZScoreSampleSize
+	// measurements, "zscore" falls back to "mad".
+	OutlierRejection string
+
+	// OutlierThreshold is the maximum (modified) z-score a measurement
+	// may have to be kept
+	OutlierThreshold float64
+}
+
+func (conf DedupConf) WithDefaults() DedupConf {
+	if conf.Aggregation == "" {
+		conf.Aggregation = AggregationMedian
+	}
+	if conf.TrimRatio == nil {
+		trimRatio := dfltTrimRatio
+		conf.TrimRatio = &trimRatio
+	}
+	if conf.OutlierRejection == "" {
+		conf.OutlierRejection = OutlierRejectionNone
+	}
+	if conf.OutlierThreshold == 0 {
+		conf.OutlierThreshold = dfltOutlierThreshold
+	}
+	return conf
+}
+
+func (conf DedupConf) Validate() error {
+	switch conf.Aggregation {
+	case AggregationMedian, AggregationTrimmedMean, AggregationP90:
+	default:
+		return fmt.Errorf("unknown aggregation method: %s", conf.Aggregation)
+	}
+	if conf.TrimRatio == nil {
+		return fmt.Errorf("missing trim ratio")
+	}
+	if *conf.TrimRatio < 0 || *conf.TrimRatio >= 0.5 {
+		return fmt.Errorf("invalid trim ratio %.2f (must be in [0, 0.5))", *conf.TrimRatio)
+	}
+	switch conf.OutlierRejection {
+	case OutlierRejectionNone, OutlierRejectionZScore, OutlierRejectionMAD:
+	default:
+		return fmt.Errorf("unknown outlier rejection method: %s", conf.OutlierRejection)
+	}
+	if conf.OutlierThreshold <= 0 {
+		return fmt.Errorf("invalid outlier threshold %.2f", conf.OutlierThreshold)
+	}
+	return nil
+}
+
+// ------------------------------
+
+// sortedMedian expects sorted values
+func sortedMedian(values []float64) float64 {
+	n := len(values)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// sortedPercentile calculates percentile (0..1) of sorted values
+// using linear interpolation between closest ranks
+func sortedPercentile(values []float64, p float64) float64 {
+	n := len(values)
+	if n == 0 {
+		return 0
+	}
+	if n == 1 {
+		return values[0]
+	}
+	rank := p * float64(n-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return values[lo] + (values[hi]-values[lo])*(rank-float64(lo))
+}
+
+// sortedTrimmedMean expects sorted values
+func sortedTrimmedMean(values []float64, trimRatio float64) float64 {
+	n := len(values)
+	if n == 0 {
+		return 0
+	}
+	cut := int(math.Floor(float64(n) * trimRatio))
+	trimmed := values[cut : n-cut]
+	var sum float64
+	for _, v := range trimmed {
+		sum += v
+	}
+	return sum / float64(len(trimmed))
+}
+
+func meanAndStdDev(values []float64) (mean, stdDev float64) {
+	var sum, sum2 float64
+	for _, v := range values {
+		sum += v
+		sum2 += v * v
+	}
+	n := float64(len(values))
+	mean = sum / n
+	variance := sum2/n - mean*mean
+	if variance > 0 {
+		stdDev = math.Sqrt(variance)
+	}
+	return
+}
+
+// meanAndStdDevWithout calculates the mean and the sample standard
+// deviation of values excluding the one at the index skip
+func meanAndStdDevWithout(values []float64, skip int) (mean, stdDev float64) {
+	var sum float64
+	for i, v := range values {
+		if i != skip {
+			sum += v
+		}
+	}
+	n := float64(len(values) - 1)
+	mean = sum / n
+	var sum2 float64
+	for i, v := range values {
+		if i != skip {
+			sum2 += (v - mean) * (v - mean)
+		}
+	}
+	if n > 1 {
+		stdDev = math.Sqrt(sum2 / (n - 1))
+	}
+	return
+}
+
+// rejectOutliers removes measurements too distant from the rest.
+// The returned slice is sorted. Typical use case is removing
+// first-run (cold cache) spikes.
+func (conf DedupConf) rejectOutliers(sortedValues []float64) []float64 {
+	if len(sortedValues) < minOutlierSampleSize {
+		return sortedValues
+	}
+	method := conf.OutlierRejection
+	if method == OutlierRejectionZScore && len(sortedValues) < minZScoreSampleSize {
+		method = OutlierRejectionMAD
+	}
+	var isOutlier func(i int, v float64) bool
+	switch method {
+	case OutlierRejectionZScore:
+		isOutlier = func(i int, v float64) bool {
+			mean, stdDev := meanAndStdDevWithout(sortedValues, i)
+			if stdDev == 0 {
+				// all the other values are the same
+				return math.Abs(v-mean) > zeroSpreadRelTolerance*math.Abs(mean)
+			}
+			return math.Abs(v-mean)/stdDev > conf.OutlierThreshold
+		}
+	case OutlierRejectionMAD:
+		median := sortedMedian(sortedValues)
+		deviations := make([]float64, len(sortedValues))
+		for i, v := range sortedValues {
+			deviations[i] = math.Abs(v - median)
+		}
+		slices.Sort(deviations)
+		mad := sortedMedian(deviations)
+		if mad == 0 {
+			return sortedValues
+		}
+		isOutlier = func(i int, v float64) bool {
+			return madConsistencyConst*math.Abs(v-median)/mad > conf.OutlierThreshold
+		}
+	default:
+		return sortedValues
+	}
+	ans := make([]float64, 0, len(sortedValues))
+	for i, v := range sortedValues {
+		if !isOutlier(i, v) {
+			ans = append(ans, v)
+		}
+	}
+	return ans
+}
+
+// Aggregate merges repeated processing times of a single query
+// into one value. It returns the value along with the number of
+// measurements actually used (i.e. after outlier rejection).
+func (conf DedupConf) Aggregate(procTimes []float64) (value float64, numUsed int) {
+	values := slices.Clone(procTimes)
+	slices.Sort(values)
+	values = conf.rejectOutliers(values)
+	switch conf.Aggregation {
+	case AggregationTrimmedMean:
+		value = sortedTrimmedMean(values, *conf.TrimRatio)
+	case AggregationP90:
+		value = sortedPercentile(values, 0.9)
+	default:
+		value = sortedMedian(values)
+	}
+	return value, len(values)
+}
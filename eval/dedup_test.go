@@ -0,0 +1,146 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eval
+
+import (
+	"testing"
+
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMedianEvenLength(t *testing.T) {
+	conf := DedupConf{Aggregation: AggregationMedian}.WithDefaults()
+	v, n := conf.Aggregate([]float64{4, 1, 3, 2})
+	assert.InDelta(t, 2.5, v, 0.0001)
+	assert.Equal(t, 4, n)
+}
+
+func TestMedianOddLength(t *testing.T) {
+	conf := DedupConf{Aggregation: AggregationMedian}.WithDefaults()
+	v, _ := conf.Aggregate([]float64{5, 1, 3})
+	assert.InDelta(t, 3.0, v, 0.0001)
+}
+
+func TestTrimmedMean(t *testing.T) {
+	trimRatio := 0.2
+	conf := DedupConf{Aggregation: AggregationTrimmedMean, TrimRatio: &trimRatio}.WithDefaults()
+	v, _ := conf.Aggregate([]float64{100, 1, 2, 3, 0})
+	assert.InDelta(t, 2.0, v, 0.0001)
+}
+
+func TestUntrimmedMean(t *testing.T) {
+	trimRatio := 0.0
+	conf := DedupConf{Aggregation: AggregationTrimmedMean, TrimRatio: &trimRatio}.WithDefaults()
+	assert.Equal(t, 0.0, *conf.TrimRatio)
+	v, _ := conf.Aggregate([]float64{100, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	assert.InDelta(t, 14.5, v, 0.0001)
+
+	conf = DedupConf{Aggregation: AggregationTrimmedMean}.WithDefaults()
+	assert.Equal(t, dfltTrimRatio, *conf.TrimRatio)
+}
+
+func TestP90(t *testing.T) {
+	conf := DedupConf{Aggregation: AggregationP90}.WithDefaults()
+	v, _ := conf.Aggregate([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11})
+	assert.InDelta(t, 10.0, v, 0.0001)
+}
+
+func TestMADRejectsColdCacheSpike(t *testing.T) {
+	conf := DedupConf{
+		Aggregation:      AggregationMedian,
+		OutlierRejection: OutlierRejectionMAD,
+	}.WithDefaults()
+	v, n := conf.Aggregate([]float64{1.1, 0.9, 1.0, 1.2, 45.0})
+	assert.Equal(t, 4, n)
+	assert.InDelta(t, 1.05, v, 0.0001)
+}
+
+func TestZScoreRejectsColdCacheSpike(t *testing.T) {
+	conf := DedupConf{
+		Aggregation:      AggregationMedian,
+		OutlierRejection: OutlierRejectionZScore,
+	}.WithDefaults()
+	for _, values := range [][]float64{
+		{1.0, 1.1, 45.0},
+		{1.1, 0.9, 45.0, 1.0},
+		{1.1, 0.9, 1.0, 1.2, 45.0},
+	} {
+		v, n := conf.Aggregate(values)
+		assert.Equal(t, len(values)-1, n, "values: %v", values)
+		assert.Less(t, v, 1.2, "values: %v", values)
+	}
+	// no spike, nothing rejected
+	_, n := conf.Aggregate([]float64{1.0, 1.5, 2.0, 2.5})
+	assert.Equal(t, 4, n)
+}
+
+func TestZScoreSmallSampleKeepsNoise(t *testing.T) {
+	conf := DedupConf{
+		Aggregation:      AggregationTrimmedMean,
+		OutlierRejection: OutlierRejectionZScore,
+	}.WithDefaults()
+	// leave-one-out z-score of 1.3 would be about 3.54 here
+	v, n := conf.Aggregate([]float64{1.0, 1.1, 1.3})
+	assert.Equal(t, 3, n)
+	assert.InDelta(t, 1.1333, v, 0.0001)
+	_, n = conf.Aggregate([]float64{1.0, 1.1, 1.3, 1.2})
+	assert.Equal(t, 4, n)
+}
+
+func TestZScoreToleratesRoundingErrors(t *testing.T) {
+	conf := DedupConf{
+		Aggregation:      AggregationMedian,
+		OutlierRejection: OutlierRejectionZScore,
+	}.WithDefaults()
+	_, n := conf.Aggregate([]float64{0.3, 0.3, 0.3, 0.3, 0.1 + 0.2})
+	assert.Equal(t, 5, n)
+	_, n = conf.Aggregate([]float64{0.3, 0.3, 0.3, 0.3, 0.5})
+	assert.Equal(t, 4, n)
+}
+
+func TestOutlierRejectionKeepsSmallSamples(t *testing.T) {
+	conf := DedupConf{
+		Aggregation:      AggregationMedian,
+		OutlierRejection: OutlierRejectionZScore,
+		OutlierThreshold: 0.5,
+	}.WithDefaults()
+	_, n := conf.Aggregate([]float64{1.0, 45.0})
+	assert.Equal(t, 2, n)
+}
+
+func TestDedupConfValidate(t *testing.T) {
+	assert.NoError(t, DedupConf{}.WithDefaults().Validate())
+	assert.Error(t, DedupConf{Aggregation: "mean"}.WithDefaults().Validate())
+	assert.Error(t, DedupConf{OutlierRejection: "foo"}.WithDefaults().Validate())
+}
+
+func TestDeduplicateSetsWeight(t *testing.T) {
+	p := &Predictor{
+		Evaluations: []feats.QueryEvaluation{
+			{OrigQuery: "[word=\"a\"]", CorpusSize: 10, ProcTime: 1},
+			{OrigQuery: "[word=\"a\"]", CorpusSize: 10, ProcTime: 3},
+			{OrigQuery: "[word=\"b\"]", CorpusSize: 10, ProcTime: 2},
+		},
+		LearningDataStats: LearningDataStats{NumProcessed: 3},
+	}
+	p.Deduplicate(DedupConf{}.WithDefaults())
+	assert.Len(t, p.Evaluations, 2)
+	assert.InDelta(t, 2.0, p.Evaluations[0].ProcTime, 0.0001)
+	assert.Equal(t, 2.0, p.Evaluations[0].Weight)
+	assert.Equal(t, 1.0, p.Evaluations[1].Weight)
+}
@@ -0,0 +1,83 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feats
+
+import (
+	"math"
+)
+
+func lerp(a, b, gap float64) float64 {
+	return a + (b-a)*gap
+}
+
+func lerpInt(a, b int, gap float64) int {
+	return int(math.Round(lerp(float64(a), float64(b), gap)))
+}
+
+func interpolatePositions(p1, p2 Position, gap float64) Position {
+	return Position{
+		Index: p1.Index,
+		Regexp: Regexp{
+			StartsWithWildCard: lerpInt(p1.Regexp.StartsWithWildCard, p2.Regexp.StartsWithWildCard, gap),
+			NumConcreteChars:   lerp(p1.Regexp.NumConcreteChars, p2.Regexp.NumConcreteChars, gap),
+			AvgCharProb:        lerp(p1.Regexp.AvgCharProb, p2.Regexp.AvgCharProb, gap),
+			WildcardScore:      lerp(p1.Regexp.WildcardScore, p2.Regexp.WildcardScore, gap),
+			HasRange:           lerpInt(p1.Regexp.HasRange, p2.Regexp.HasRange, gap),
+			CharClasses:        lerp(p1.Regexp.CharClasses, p2.Regexp.CharClasses, gap),
+		},
+		HasSmallCardAttr: lerpInt(p1.HasSmallCardAttr, p2.HasSmallCardAttr, gap),
+		NumAlternatives:  lerpInt(p1.NumAlternatives, p2.NumAlternatives, gap),
+		PosRepetition:    lerp(p1.PosRepetition, p2.PosRepetition, gap),
+		HasNegation:      lerpInt(p1.HasNegation, p2.HasNegation, gap),
+	}
+}
+
+// Interpolate creates a synthetic evaluation lying between `eval` and `other`
+// in the feature space (gap = 0 means `eval`, gap = 1 means `other`). This is
+// used for SMOTE-like oversampling. Missing positions are treated as zero
+// vectors, just like in ExtractFeatures. Flag-like (integer) features are rounded
+// so the result still represents a meaningful query shape.
+func (eval QueryEvaluation) Interpolate(other QueryEvaluation, gap float64) QueryEvaluation {
+	numPos := min(max(len(eval.Positions), len(other.Positions)), MaxPositions)
+	positions := make([]Position, numPos)
+	for i := range numPos {
+		var p1, p2 Position
+		if i < len(eval.Positions) {
+			p1 = eval.Positions[i]
+		}
+		if i < len(other.Positions) {
+			p2 = other.Positions[i]
+		}
+		positions[i] = interpolatePositions(p1, p2, gap)
+		positions[i].Index = i
+	}
+	return QueryEvaluation{
+		ProcTime:           lerp(eval.ProcTime, other.ProcTime, gap),
+		OrigQuery:          "#synthetic: " + eval.OrigQuery,
+		Positions:          positions,
+		NumGlobConditions:  lerpInt(eval.NumGlobConditions, other.NumGlobConditions, gap),
+		ContainsMeet:       lerpInt(eval.ContainsMeet, other.ContainsMeet, gap),
+		ContainsUnion:      lerpInt(eval.ContainsUnion, other.ContainsUnion, gap),
+		ContainsWithin:     lerpInt(eval.ContainsWithin, other.ContainsWithin, gap),
+		AdhocSubcorpus:     lerp(eval.AdhocSubcorpus, other.AdhocSubcorpus, gap),
+		ContainsContaining: lerpInt(eval.ContainsContaining, other.ContainsContaining, gap),
+		CorpusSize:         lerp(eval.CorpusSize, other.CorpusSize, gap),
+		NamedSubcorpusSize: lerp(eval.NamedSubcorpusSize, other.NamedSubcorpusSize, gap),
+		AlignedPart:        lerpInt(eval.AlignedPart, other.AlignedPart, gap),
+		Weight:             lerp(eval.SampleWeight(), other.SampleWeight(), gap),
+	}
+}
@@ -278,6 +278,19 @@ type QueryEvaluation struct {
 	CorpusSize         float64    `msgpack:"corpusSize"` // Size of the corpus being searched (e.g., number of tokens)
 	NamedSubcorpusSize float64    `msgpack:"namedSubcorpusSize"`
 	AlignedPart        int        `msgpack:"alignedPart"`
+
+	// Weight reflects how many repeated measurements of the query
+	// the record represents (see eval.Predictor.Deduplicate).
+	// Zero value (e.g. older feature files) is treated as 1.
+	Weight float64 `msgpack:"weight,omitempty"`
+}
+
+// SampleWeight returns the learning weight of the record
+func (eval QueryEvaluation) SampleWeight() float64 {
+	if eval.Weight <= 0 {
+		return 1
+	}
+	return eval.Weight
 }
 
 func (eval QueryEvaluation) UniqKey() string {
@@ -309,6 +322,7 @@ func (eval QueryEvaluation) Show() string {
 	ans.WriteString(fmt.Sprintf("CorpusSize: %0.2f\n", eval.CorpusSize))
 	ans.WriteString(fmt.Sprintf("NamedSubcorpusSize: %0.2f\n", eval.NamedSubcorpusSize))
 	ans.WriteString(fmt.Sprintf("AlignedPart: %d\n", eval.AlignedPart))
+	ans.WriteString(fmt.Sprintf("Weight: %.2f\n", eval.SampleWeight()))
 
 	return ans.String()
 }
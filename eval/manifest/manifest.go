@@ -0,0 +1,118 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/czcorpus/cqlizer/eval/threshold"
+)
+
+// Metrics describes model quality for a single class (vote) threshold
+type Metrics struct {
+	VoteThreshold float64 `json:"voteThreshold" msgpack:"voteThreshold"`
+	Precision     float64 `json:"precision" msgpack:"precision"`
+	Recall        float64 `json:"recall" msgpack:"recall"`
+	FBeta         float64 `json:"fBeta" msgpack:"fBeta"`
+}
+
+// Manifest describes how a model was trained so any training run
+// can be reviewed and reproduced. It is stored along with the model.
+type Manifest struct {
+	ModelType string `json:"modelType" msgpack:"modelType"`
+
+	// TrainedAt is a RFC3339 formatted time of training
+	TrainedAt string `json:"trainedAt" msgpack:"trainedAt"`
+
+	FeaturesFile   string `json:"featuresFile" msgpack:"featuresFile"`
+	FeaturesSHA256 string `json:"featuresSha256" msgpack:"featuresSha256"`
+
+	// FeedbackFile and FeedbackSHA256 identify live feedback data
+	// merged with the features in case of a retrained model
+	FeedbackFile   string `json:"feedbackFile,omitempty" msgpack:"feedbackFile,omitempty"`
+	FeedbackSHA256 string `json:"feedbackSha256,omitempty" msgpack:"feedbackSha256,omitempty"`
+
+	// ParentModel is the model a retrained model has been compared with
+	ParentModel string `json:"parentModel,omitempty" msgpack:"parentModel,omitempty"`
+
+	Seed        uint64               `json:"seed" msgpack:"seed"`
+	Hyperparams map[string]any       `json:"hyperparams,omitempty" msgpack:"hyperparams,omitempty"`
+	Threshold   threshold.Definition `json:"threshold" msgpack:"threshold"`
+	Balancing   string               `json:"balancing" msgpack:"balancing"`
+
+	// DataStats is a summary of the source data (see eval.LearningDataStats)
+	DataStats    string `json:"dataStats" msgpack:"dataStats"`
+	TrainingSize int    `json:"trainingSize" msgpack:"trainingSize"`
+	TestSize     int    `json:"testSize,omitempty" msgpack:"testSize,omitempty"`
+
+	// Version, BuildDate and GitCommit identify the CQLizer build
+	// the model was trained with
+	Version   string `json:"version" msgpack:"version"`
+	BuildDate string `json:"buildDate" msgpack:"buildDate"`
+	GitCommit string `json:"gitCommit" msgpack:"gitCommit"`
+
+	// Metrics contains evaluation results for a range of vote thresholds.
+	// For inference-only models (trained by an external script), this is
+	// empty and the script may provide PRAUC instead.
+	Metrics     []Metrics `json:"metrics,omitempty" msgpack:"metrics,omitempty"`
+	BestMetrics *Metrics  `json:"bestMetrics,omitempty" msgpack:"bestMetrics,omitempty"`
+	PRAUC       float64   `json:"prAuc,omitempty" msgpack:"prAuc,omitempty"`
+}
+
+// IsZero tests whether the manifest is empty. This is the case
+// of models created before manifests were introduced.
+func (m Manifest) IsZero() bool {
+	return m.TrainedAt == "" && m.FeaturesSHA256 == ""
+}
+
+// AddMetrics adds evaluation results for a vote threshold
+// and updates the best result (by F-beta) accordingly
+func (m *Manifest) AddMetrics(item Metrics) {
+	m.Metrics = append(m.Metrics, item)
+	if m.BestMetrics == nil || item.FBeta > m.BestMetrics.FBeta {
+		best := item
+		m.BestMetrics = &best
+	}
+}
+
+// JSON returns an indented JSON representation of the manifest
+func (m Manifest) JSON() (string, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize model manifest: %w", err)
+	}
+	return string(data), nil
+}
+
+// FileSHA256 calculates a hex encoded SHA-256 hash of a file
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate file hash: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to calculate file hash: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddMetricsKeepsBest(t *testing.T) {
+	var mf Manifest
+	mf.AddMetrics(Metrics{VoteThreshold: 0.5, FBeta: 0.6})
+	mf.AddMetrics(Metrics{VoteThreshold: 0.6, FBeta: 0.8})
+	mf.AddMetrics(Metrics{VoteThreshold: 0.7, FBeta: 0.7})
+	assert.Len(t, mf.Metrics, 3)
+	assert.Equal(t, 0.6, mf.BestMetrics.VoteThreshold)
+}
+
+func TestFileSHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feats.msgpack")
+	assert.NoError(t, os.WriteFile(path, []byte("abc"), 0644))
+	hash, err := FileSHA256(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", hash)
+}
+
+func TestIsZero(t *testing.T) {
+	assert.True(t, Manifest{}.IsZero())
+	assert.False(t, Manifest{FeaturesSHA256: "abc"}.IsZero())
+}
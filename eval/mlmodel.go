@@ -2,6 +2,7 @@ package eval
 
 import (
 	"errors"
+	"regexp"
 
 	"github.com/czcorpus/cqlizer/eval/nn"
 	"github.com/czcorpus/cqlizer/eval/rf"
@@ -9,7 +10,22 @@ import (
 	"github.com/czcorpus/cqlizer/eval/ym"
 )
 
-var ErrNoSuchModel = errors.New("no such model")
+var (
+	ErrNoSuchModel = errors.New("no such model")
+
+	modelTypeRegexp = regexp.MustCompile(`\.(rf|nn|xg)\.[^/]+$`)
+)
+
+// InferModelType guesses model type from a model file name
+// (see MLModel.CreateModelFileName). If unknown, an empty string
+// is returned.
+func InferModelType(modelPath string) string {
+	srch := modelTypeRegexp.FindStringSubmatch(modelPath)
+	if len(srch) > 1 {
+		return srch[1]
+	}
+	return ""
+}
 
 func GetMLModel(modelType, modelPath string) (MLModel, error) {
 
@@ -21,19 +21,28 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"math/rand/v2"
+	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/czcorpus/cqlizer/cnf"
 	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/czcorpus/cqlizer/eval/manifest"
 	"github.com/czcorpus/cqlizer/eval/predict"
+	"github.com/czcorpus/cqlizer/eval/threshold"
 	"github.com/czcorpus/cqlizer/eval/zero"
 	"github.com/rs/zerolog/log"
 	"github.com/schollz/progressbar/v3"
 )
 
+const (
+	// maxProcTime is a processing time (in seconds) all the longer
+	// times are clamped to
+	maxProcTime = 450
+)
+
 type PrecAndRecall struct {
 	Precision float64
 	Recall    float64
@@ -44,39 +53,6 @@ func (pr PrecAndRecall) CSV(x float64) string {
 	return fmt.Sprintf("%.2f;%.2f;%.2f;%.2f", x, pr.Precision, pr.Recall, pr.FBeta)
 }
 
-func findKneeDistance(items []feats.QueryEvaluation) (threshold float64, kneeIdx int) {
-
-	n := len(items)
-	if n < 2 {
-		return items[n-1].ProcTime, 100.0
-	}
-
-	// Line from first to last point
-	x1, y1 := 0.0, items[0].ProcTime
-	x2, y2 := float64(n-1), items[n-1].ProcTime
-
-	// Line equation coefficients: ax + by + c = 0
-	a := y2 - y1
-	b := x1 - x2
-	c := x2*y1 - x1*y2
-
-	normFactor := math.Sqrt(a*a + b*b)
-
-	maxDist := 0.0
-	kneeIdx = 0
-
-	for i := 0; i < n; i++ {
-		// Perpendicular distance from point to line
-		dist := math.Abs(a*float64(i)+b*items[i].ProcTime+c) / normFactor
-		if dist > maxDist {
-			maxDist = dist
-			kneeIdx = i
-		}
-	}
-	threshold = items[kneeIdx].ProcTime
-	return threshold, kneeIdx
-}
-
 // ------------------------------------
 
 type QueryStatsRecord struct {
@@ -112,13 +88,17 @@ func (rec QueryStatsRecord) UniqKey() string {
 // ----------------------------
 
 type LearningDataStats struct {
-	NumProcessed       int     `msgpack:"numProcessed"`
-	NumFailed          int     `msgpack:"numFailed"`
-	DeduplicationRatio float64 `msgpack:"deduplicationRatio"`
+	NumProcessed        int     `msgpack:"numProcessed"`
+	NumFailed           int     `msgpack:"numFailed"`
+	DeduplicationRatio  float64 `msgpack:"deduplicationRatio"`
+	NumRejectedOutliers int     `msgpack:"numRejectedOutliers"`
 }
 
 func (stats LearningDataStats) AsComment() string {
-	return fmt.Sprintf("source data - total items: %d, failed imports: %d, deduplicated ratio: %.2f", stats.NumProcessed, stats.NumFailed, stats.DeduplicationRatio)
+	return fmt.Sprintf(
+		"source data - total items: %d, failed imports: %d, deduplicated ratio: %.2f, rejected outliers: %d",
+		stats.NumProcessed, stats.NumFailed, stats.DeduplicationRatio, stats.NumRejectedOutliers,
+	)
 }
 
 // ----------------------------
@@ -130,12 +110,28 @@ type MLModel interface {
 	// Train trains the model based on input data. In case the model
 	// supports only inference (e.g. our XGBoost), this should just prepare
 	// data to a format required by actual program performing the learning.
-	Train(ctx context.Context, data []feats.QueryEvaluation, slowQueriesTime float64, comment string) error
+	Train(ctx context.Context, data []feats.QueryEvaluation, thr threshold.Definition, comment string) error
 
 	Predict(feats.QueryEvaluation) predict.Prediction
 	SetClassThreshold(v float64)
 	GetClassThreshold() float64
-	GetSlowQueriesThresholdTime() float64
+
+	// GetThreshold returns the definition of slow queries the model
+	// has been trained with.
+	GetThreshold() threshold.Definition
+
+	// GetHyperparams returns model settings which affect training
+	// (to be stored in the training manifest)
+	GetHyperparams() map[string]any
+
+	// SetManifest attaches a training manifest to the model.
+	// The manifest is then saved along with the model.
+	SetManifest(manifest.Manifest)
+
+	// GetManifest returns the training manifest. For models trained
+	// before manifests were introduced, an empty manifest is returned.
+	GetManifest() manifest.Manifest
+
 	SaveToFile(string) error
 	GetInfo() string
 
@@ -163,18 +159,10 @@ type Predictor struct {
 
 	LearningDataStats LearningDataStats
 
-	// slowQueryPercentile specifies which percentile of queries (by time)
-	// is considered as "slow times".
-	// This value is the one user enters.
-	slowQueryPercentile float64
-
-	// midpointIdx is derived from SlowQueryPercentile and represents a sorted data index
-	// from which SlowQueryPercentile starts.
-	midpointIdx int
-
-	// binMidpoint is the threshold time where SlowQueryPercentile starts. The value
-	// is derived from SlowQueryPercentile
-	binMidpoint float64
+	// threshold defines which queries are considered slow. For learning,
+	// it is resolved from user specification (see ResolveThreshold), for
+	// evaluation, it is taken from the evaluated model (see UseModelThreshold).
+	threshold threshold.Definition
 
 	corpora map[string]feats.CorpusProps
 
@@ -192,11 +180,14 @@ func NewPredictor(
 		corpora:                 conf.CorporaProps,
 		mlModel:                 mlModel,
 		syntheticTimeCorrection: conf.SyntheticTimeCorrection,
-		binMidpoint:             mlModel.GetSlowQueriesThresholdTime(),
+		threshold:               mlModel.GetThreshold(),
 	}
 }
 
-func (model *Predictor) FindAndSetDataMidpoint() {
+// sortAndClampProcTimes sorts evaluations by processing time and limits
+// extremely long processing times to maxProcTime so they do not distort
+// threshold calculation.
+func (model *Predictor) sortAndClampProcTimes() {
 	slices.SortFunc(model.Evaluations, func(v1, v2 feats.QueryEvaluation) int {
 		if v1.ProcTime < v2.ProcTime {
 			return -1
@@ -207,55 +198,83 @@ func (model *Predictor) FindAndSetDataMidpoint() {
 		return 0
 	})
 	for i := 0; i < len(model.Evaluations); i++ {
-		if model.Evaluations[i].ProcTime > 450 {
-			model.Evaluations[i].ProcTime = 450
-			fmt.Println("HUGE WQUERY ------------ ", model.Evaluations[i].Positions)
+		if model.Evaluations[i].ProcTime > maxProcTime {
+			log.Debug().
+				Str("query", model.Evaluations[i].OrigQuery).
+				Float64("procTime", model.Evaluations[i].ProcTime).
+				Msg("clamping processing time of a huge query")
+			model.Evaluations[i].ProcTime = maxProcTime
 		}
 	}
-	model.binMidpoint, model.midpointIdx = findKneeDistance(model.Evaluations)
 }
 
-func (model *Predictor) BalanceSample() []feats.QueryEvaluation {
-	slices.SortFunc(model.Evaluations, func(v1, v2 feats.QueryEvaluation) int {
-		if v1.ProcTime < v2.ProcTime {
-			return -1
-
-		} else if v1.ProcTime > v2.ProcTime {
-			return 1
-		}
-		return 0
-	})
-	for i := 0; i < len(model.Evaluations); i++ {
-		if model.Evaluations[i].ProcTime > 450 {
-			model.Evaluations[i].ProcTime = 450
-			fmt.Println("HUGE WQUERY ------------ ", model.Evaluations[i].Positions)
-		}
+// ResolveThreshold resolves the user-specified slow query threshold
+// definition against the loaded learning data.
+func (model *Predictor) ResolveThreshold(def threshold.Definition) error {
+	if len(model.Evaluations) == 0 {
+		return fmt.Errorf("cannot resolve slow query threshold - no data loaded")
+	}
+	model.sortAndClampProcTimes()
+	var err error
+	model.threshold, err = def.Resolve(model.Evaluations)
+	if err != nil {
+		return err
 	}
-	//model.MidpointIdx, model.BinMidpoint = model.computeThreshold()
-	log.Info().Msg("creating a balanced sample for learning")
-	model.binMidpoint, model.midpointIdx = findKneeDistance(model.Evaluations)
-	model.slowQueryPercentile = float64(model.midpointIdx) / float64(len(model.Evaluations))
 	log.Info().
-		Float64("thresholdTime", model.binMidpoint).
-		Int("thresholdIdx", model.midpointIdx).
-		Float64("slowQueryPercentile", model.slowQueryPercentile).
+		Str("threshold", model.threshold.String()).
 		Int("totalQueries", len(model.Evaluations)).
-		Int("positiveExamples", len(model.Evaluations)-model.midpointIdx).
 		Float64("maxProcTime", model.Evaluations[len(model.Evaluations)-1].ProcTime).
 		Float64("minProcTime", model.Evaluations[0].ProcTime).
 		Msg("calculated threshold for slow queries")
+	return nil
+}
 
-	numPositive := len(model.Evaluations) - model.midpointIdx
-	balEval := make([]feats.QueryEvaluation, numPositive*3)
-	for i := 0; i < numPositive*2; i++ {
-		balEval[i] = model.Evaluations[rand.IntN(model.midpointIdx)]
+// UseModelThreshold prepares loaded data for evaluation of the model
+// the predictor has been created with. The slow query threshold definition
+// stored with the model is used so the evaluation applies the same boundary
+// as the training did. For older models without a stored definition,
+// the knee method applied on the loaded data is used as a fallback.
+func (model *Predictor) UseModelThreshold() error {
+	model.sortAndClampProcTimes()
+	if model.threshold.IsResolved() {
+		log.Info().
+			Str("threshold", model.threshold.String()).
+			Msg("using slow query threshold stored with the model")
+		return nil
 	}
-	for i := range numPositive {
-		balEval[i+numPositive*2] = model.Evaluations[model.midpointIdx+i]
+	log.Warn().Msg("model does not contain slow query threshold, falling back to the knee method")
+	return model.ResolveThreshold(threshold.Definition{Method: threshold.MethodKnee})
+}
+
+// Threshold returns currently used slow query threshold definition
+func (model *Predictor) Threshold() threshold.Definition {
+	return model.threshold
+}
+
+// BalanceSample replaces learning data with a sample balanced
+// according to `conf`. The original data are returned.
+// The threshold must be resolved before calling this (see ResolveThreshold).
+func (model *Predictor) BalanceSample(conf BalanceConf) ([]feats.QueryEvaluation, error) {
+	if conf.Strategy == BalanceClassWeights {
+		cwModel, ok := model.mlModel.(classWeightedLearner)
+		if !ok {
+			return nil, fmt.Errorf("model %T does not support class weights", model.mlModel)
+		}
+		cwModel.SetClassWeighted(true)
 	}
+	log.Info().
+		Str("strategy", conf.Strategy).
+		Uint64("seed", conf.Seed).
+		Msg("creating a balanced sample for learning")
+	sample, numPos, numNeg := conf.Balance(model.Evaluations, model.threshold.IsSlow)
+	log.Info().
+		Int("positiveExamples", numPos).
+		Int("negativeExamples", numNeg).
+		Int("sampleSize", len(sample)).
+		Msg("created balanced sample")
 	oldEvals := model.Evaluations
-	model.Evaluations = balEval
-	return oldEvals
+	model.Evaluations = sample
+	return oldEvals, nil
 }
 
 func (model *Predictor) ProcessEntry(entry QueryStatsRecord) error {
@@ -314,11 +333,15 @@ func (model *Predictor) PrecisionAndRecall(misclassQueries misclassifiedQueryRep
 	numRetrieved := 0
 
 	for i := 0; i < len(model.Evaluations); i++ {
-		trulySlow := model.Evaluations[i].ProcTime >= model.binMidpoint
+		trulySlow := model.threshold.IsSlow(model.Evaluations[i])
 		prediction := model.mlModel.Predict(model.Evaluations[i])
 		if trulySlow != (prediction.PredictedClass == 1) && misclassQueries != nil {
 			misclassQueries.AddMisclassifiedQuery(
-				model.Evaluations[i], prediction.SlowQueryVote(), model.mlModel.GetClassThreshold(), model.mlModel.GetSlowQueriesThresholdTime())
+				model.Evaluations[i],
+				prediction.SlowQueryVote(),
+				model.mlModel.GetClassThreshold(),
+				model.threshold.SlowTimeFor(model.Evaluations[i].CorpusSize),
+			)
 		}
 		if trulySlow {
 			numRelevant++
@@ -350,91 +373,54 @@ func (model *Predictor) PrecisionAndRecall(misclassQueries misclassifiedQueryRep
 
 }
 
-func (model *Predictor) showSampleEvaluations(rfModel MLModel, maxSamples int, votingThreshold float64) {
-
-	if len(model.Evaluations) < maxSamples {
-		maxSamples = len(model.Evaluations)
-	}
-
-	// Test predictions on training data (for diagnostic purposes)
-	fmt.Printf("\nSample predictions on training data (voting threshold: %.2f):\n", votingThreshold)
-
-	fmt.Println("negative examples test: ")
-	for i := 0; i < maxSamples; i++ {
-		randomIdx := rand.IntN(model.midpointIdx)
-		predicted := float64(rfModel.Predict(model.Evaluations[randomIdx]).PredictedClass) / 100.0
-		actual := model.Evaluations[randomIdx].ProcTime < model.binMidpoint
-		fmt.Printf(
-			"       %d, match: %t, vote NO: %.2f (time: %.2f)\n",
-			randomIdx, actual == (predicted < votingThreshold), 1-predicted, model.Evaluations[randomIdx].ProcTime,
-		)
-	}
-
-	fmt.Println("POSITIVE examples test: ")
-	for i := 0; i < maxSamples; i++ {
-		randomIdx := rand.IntN(len(model.Evaluations)-model.midpointIdx) + model.midpointIdx
-		predicted := float64(rfModel.Predict(model.Evaluations[randomIdx]).PredictedClass) / 100.0
-		actual := model.Evaluations[randomIdx].ProcTime >= model.binMidpoint
-		fmt.Printf(
-			"       %d, match: %t, vote YES: %.2f (time: %.2f)\n",
-			randomIdx, actual == (predicted >= votingThreshold), predicted, model.Evaluations[randomIdx].ProcTime,
-		)
-	}
-}
-
-func (model *Predictor) Deduplicate() {
+// Deduplicate merges records of the same query (and corpus size) into
+// a single record with processing time aggregated according to `conf`.
+// Each resulting record is weighted by the number of measurements
+// used to calculate its processing time.
+func (model *Predictor) Deduplicate(conf DedupConf) {
 	uniq := make(map[string][]feats.QueryEvaluation)
+	keys := make([]string, 0, len(model.Evaluations))
 	for _, v := range model.Evaluations {
 		_, ok := uniq[v.UniqKey()]
 		if !ok {
 			uniq[v.UniqKey()] = make([]feats.QueryEvaluation, 0, 10)
+			keys = append(keys, v.UniqKey())
 		}
 		uniq[v.UniqKey()] = append(uniq[v.UniqKey()], v)
 	}
-	for _, evals := range uniq {
-		slices.SortFunc(evals, func(v1, v2 feats.QueryEvaluation) int {
-			if v1.ProcTime < v2.ProcTime {
-				return -1
-			}
-			return 1
-		})
-		sum := 0.0
-		sum2 := 0.0
-		n := 0.0
-		for _, v := range evals {
-			sum += v.ProcTime
-			sum2 += v.ProcTime * v.ProcTime
-			n += 1
-		}
-		mean := sum / n
-		//variance := (sum2 / n) - (mean * mean)
-		//stdDev := math.Sqrt(variance)
-		var median float64
-		if len(evals) <= 2 {
-			median = mean
-
-		} else {
-			middle := int(math.Ceil(float64(len(evals)) / 2.0))
-			median = evals[middle].ProcTime
+	var numRejected int
+	model.Evaluations = make([]feats.QueryEvaluation, len(keys))
+	for i, k := range keys {
+		evals := uniq[k]
+		procTimes := make([]float64, len(evals))
+		for j, v := range evals {
+			procTimes[j] = v.ProcTime
 		}
-		evals[0].ProcTime = median
-	}
-	model.Evaluations = make([]feats.QueryEvaluation, len(uniq))
-	i := 0
-	for _, u := range uniq {
-		model.Evaluations[i] = u[0]
-		i++
+		aggrTime, numUsed := conf.Aggregate(procTimes)
+		numRejected += len(evals) - numUsed
+		model.Evaluations[i] = evals[0]
+		model.Evaluations[i].ProcTime = aggrTime
+		model.Evaluations[i].Weight = float64(numUsed)
 	}
 	model.LearningDataStats.DeduplicationRatio = float64(len(uniq)) / float64(model.LearningDataStats.NumProcessed)
-	log.Info().Int("newSize", len(model.Evaluations)).Msg("deduplicated queries")
+	model.LearningDataStats.NumRejectedOutliers = numRejected
+	log.Info().
+		Int("newSize", len(model.Evaluations)).
+		Int("rejectedOutliers", numRejected).
+		Str("aggregation", conf.Aggregation).
+		Msg("deduplicated queries")
 }
 
-// CreateAndTestModel trains a ML model and saves it to a file
-// specified by the `outputPath`. It also takes a python script
+// CreateAndTestModel trains a ML model, evaluates it and saves it
+// (along with a training manifest) to a file derived from the `featsFile`.
+// The provided manifest `mf` is expected to contain training run
+// information unknown to the predictor (seed, features file hash,
+// build info). The rest is filled in here.
 func (model *Predictor) CreateAndTestModel(
 	ctx context.Context,
 	testData []feats.QueryEvaluation,
 	featsFile string,
+	mf manifest.Manifest,
 	reporter *Reporter,
 ) error {
 	if len(model.Evaluations) == 0 {
@@ -447,19 +433,22 @@ func (model *Predictor) CreateAndTestModel(
 
 	outputPath := model.mlModel.CreateModelFileName(featsFile)
 
-	if err := model.mlModel.Train(ctx, model.Evaluations, model.binMidpoint, model.LearningDataStats.AsComment()); err != nil {
+	if err := model.mlModel.Train(ctx, model.Evaluations, model.threshold, model.LearningDataStats.AsComment()); err != nil {
 		return fmt.Errorf("RF training failed: %w", err)
 	}
-
-	if err := model.mlModel.SaveToFile(outputPath); err != nil {
-		return fmt.Errorf("error saving model: %w", err)
-
-	} else {
-		log.Debug().Str("path", outputPath).Msg("saved model file")
+	if !model.mlModel.GetThreshold().Equal(model.threshold) {
+		return fmt.Errorf("trained model does not contain the slow query threshold used for training")
 	}
+	mf.TrainedAt = time.Now().Format(time.RFC3339)
+	mf.FeaturesFile = filepath.Base(featsFile)
+	mf.Threshold = model.threshold
+	mf.Hyperparams = model.mlModel.GetHyperparams()
+	mf.DataStats = model.LearningDataStats.AsComment()
+	mf.TrainingSize = len(model.Evaluations)
 
 	if model.mlModel.IsInferenceOnly() {
-		return nil
+		model.mlModel.SetManifest(mf)
+		return model.saveModel(outputPath)
 	}
 	// ----- testing
 	slices.SortFunc(
@@ -474,6 +463,7 @@ func (model *Predictor) CreateAndTestModel(
 			return 0
 		})
 	model.Evaluations = testData
+	mf.TestSize = len(testData)
 
 	log.Info().
 		Int("evalDataSize", len(model.Evaluations)).
@@ -482,20 +472,38 @@ func (model *Predictor) CreateAndTestModel(
 	bar := progressbar.Default(int64(math.Ceil((1-0.5)/0.01)), "testing the model")
 	var csv strings.Builder
 	csv.WriteString("vote;precision;recall;f-beta\n")
-	for v := 0.5; v < 1; v += 0.01 {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-		}
+	origClassThreshold := model.mlModel.GetClassThreshold()
+	for v := 0.5; v < 1 && ctx.Err() == nil; v += 0.01 {
 		model.mlModel.SetClassThreshold(v)
 		precall := model.PrecisionAndRecall(reporter)
 		csv.WriteString(precall.CSV(v) + "\n")
+		mf.AddMetrics(manifest.Metrics{
+			VoteThreshold: v,
+			Precision:     precall.Precision,
+			Recall:        precall.Recall,
+			FBeta:         precall.FBeta,
+		})
 		bar.Add(1)
 	}
+	model.mlModel.SetClassThreshold(origClassThreshold)
+	model.mlModel.SetManifest(mf)
+	if err := model.saveModel(outputPath); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
 	if err := reporter.PlotRFAccuracy(csv.String(), model.mlModel.GetInfo(), outputPath); err != nil {
 		return fmt.Errorf("failed to generate accuracy chart: %w", err)
 	}
 	reporter.SaveMisclassifiedQueries()
 	return nil
 }
+
+func (model *Predictor) saveModel(outputPath string) error {
+	if err := model.mlModel.SaveToFile(outputPath); err != nil {
+		return fmt.Errorf("error saving model: %w", err)
+	}
+	log.Debug().Str("path", outputPath).Msg("saved model file")
+	return nil
+}
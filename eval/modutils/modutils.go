@@ -18,9 +18,16 @@ package modutils
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
 	"regexp"
 )
 
+// MaxSampleReplication limits how many times a single weighted
+// sample can be repeated in training data for learners without
+// native support for sample weights.
+const MaxSampleReplication = 10
+
 var feat2modelRegexp = regexp.MustCompile(`(.+\.v\d+\.\d+).*`)
 
 func FormatRoughSize(value int64) string {
@@ -45,3 +52,24 @@ func FormatRoughSize(value int64) string {
 func ExtractModelNameBaseFromFeatFile(filename string) string {
 	return feat2modelRegexp.ReplaceAllString(filename, "$1")
 }
+
+// ReplicationFactor converts a sample weight into a number of copies
+// of the sample for learners which do not support weights natively.
+// The weight is log-scaled so frequently repeated queries are emphasized
+// without dominating the training data.
+func ReplicationFactor(weight float64) int {
+	if weight <= 1 {
+		return 1
+	}
+	return min(1+int(math.Round(math.Log2(weight))), MaxSampleReplication)
+}
+
+// SeedGlobalRand seeds the global (math/rand) random generator.
+// This is needed for 3rd party learners (randomForest, go-deep)
+// which do not accept their own random source. Please note that
+// since Go 1.24, this works only with the `randseednop=0` GODEBUG
+// setting (see the main package).
+func SeedGlobalRand(seed uint64) {
+	//lint:ignore SA1019 the learners use the global generator
+	rand.Seed(int64(seed))
+}
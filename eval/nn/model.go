@@ -23,11 +23,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/czcorpus/cqlizer/eval/manifest"
 	"github.com/czcorpus/cqlizer/eval/modutils"
 	"github.com/czcorpus/cqlizer/eval/predict"
+	"github.com/czcorpus/cqlizer/eval/threshold"
 	"github.com/patrikeh/go-deep"
 	"github.com/patrikeh/go-deep/training"
 	"github.com/rs/zerolog/log"
@@ -40,28 +43,46 @@ type FeatureStats struct {
 
 var (
 	//networkLayout = []int{20, 14, 7, 1}
-	networkLayout = []int{50, 15, 1}
+	dfltNetworkLayout = []int{50, 15, 1}
 	//networkLayout = []int{30, 10, 1}
-	numEpochs = 800
+	dfltNumEpochs = 800
 	//learningRate  = 0.001
-	learningRate = 0.0005
+	dfltLearningRate = 0.0005
 )
 
 type jsonizedModel struct {
-	NeuralNet                *deep.Dump     `json:"neuralNet"`
-	DataRanges               []FeatureStats `json:"dataRanges"`
-	SlowQueriesThresholdTime float64        `json:"slowQueriesThresholdTime"`
-	ClassThreshold           float64        `json:"classThreshold"`
+	NeuralNet      *deep.Dump           `json:"neuralNet"`
+	DataRanges     []FeatureStats       `json:"dataRanges"`
+	Threshold      threshold.Definition `json:"threshold"`
+	ClassThreshold float64              `json:"classThreshold"`
+	Manifest       manifest.Manifest    `json:"manifest"`
+	Layout         []int                `json:"layout,omitempty"`
+	NumEpochs      int                  `json:"numEpochs,omitempty"`
+	LearningRate   float64              `json:"learningRate,omitempty"`
+
+	// SlowQueriesThresholdTime is kept for reading older model files
+	SlowQueriesThresholdTime float64 `json:"slowQueriesThresholdTime,omitempty"`
 }
 
 // Model is a neural-network based model for evaluating CQL queries.
 // It is rather experimental and does not perform as well as other
 // models here so it is not recommended for production use.
 type Model struct {
-	NeuralNet                *deep.Neural
-	DataRanges               []FeatureStats
-	SlowQueriesThresholdTime float64
-	ClassThreshold           float64
+	NeuralNet      *deep.Neural
+	DataRanges     []FeatureStats
+	Threshold      threshold.Definition
+	ClassThreshold float64
+	Manifest       manifest.Manifest
+
+	// Layout specifies sizes of network layers. The last layer
+	// must have size 1 (binary classification).
+	Layout       []int
+	NumEpochs    int
+	LearningRate float64
+
+	// Seed initializes the random generator used for weights
+	// initialization and data splitting. Zero means no explicit seeding.
+	Seed uint64
 }
 
 func (m *Model) IsInferenceOnly() bool {
@@ -80,24 +101,50 @@ func (m *Model) SetClassThreshold(v float64) {
 	m.ClassThreshold = v
 }
 
-func (m *Model) GetSlowQueriesThresholdTime() float64 {
-	return m.SlowQueriesThresholdTime
+func (m *Model) GetThreshold() threshold.Definition {
+	return m.Threshold
+}
+
+func (m *Model) GetHyperparams() map[string]any {
+	return map[string]any{
+		"layout":       m.Layout,
+		"epochs":       m.NumEpochs,
+		"learningRate": m.LearningRate,
+	}
+}
+
+func (m *Model) SetManifest(mf manifest.Manifest) {
+	m.Manifest = mf
+}
+
+func (m *Model) GetManifest() manifest.Manifest {
+	return m.Manifest
 }
 
 func (m *Model) GetInfo() string {
-	return fmt.Sprintf("NN model, layout: #%v, epochs: %d, slow q. threshold time: %.2fs", networkLayout, numEpochs, m.SlowQueriesThresholdTime)
+	return fmt.Sprintf("NN model, layout: #%v, epochs: %d, slow q. threshold: %s", m.Layout, m.NumEpochs, m.Threshold)
 }
 
-// Train
+// Train trains the network as a binary classifier. In case of a multi-class
+// threshold definition, the classes are collapsed to "fast" and "slow".
 // TODO: comment is not stored
-func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, slowQueriesTime float64, comment string) error {
+func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, thr threshold.Definition, comment string) error {
 	if len(data) == 0 {
 		return fmt.Errorf("no training data provided")
 	}
-	if slowQueriesTime <= 0 {
-		return fmt.Errorf("failed to train RF model - invalid value of SlowQueriesThresholdTime")
+	if !thr.IsResolved() {
+		return fmt.Errorf("failed to train NN model - unresolved slow queries threshold")
+	}
+	m.Threshold = thr
+	if len(m.Layout) == 0 || m.Layout[len(m.Layout)-1] != 1 {
+		return fmt.Errorf("failed to train NN model - invalid network layout %v", m.Layout)
+	}
+	if m.NumEpochs <= 0 || m.LearningRate <= 0 {
+		return fmt.Errorf("failed to train NN model - invalid number of epochs or learning rate")
+	}
+	if m.Seed != 0 {
+		modutils.SeedGlobalRand(m.Seed)
 	}
-	m.SlowQueriesThresholdTime = slowQueriesTime
 	var featData = training.Examples{}
 	//numTotal := len(dataModel.Evaluations)
 	numProblematic := 0
@@ -110,17 +157,21 @@ func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, slowQue
 	for _, eval := range data {
 		features := feats.ExtractFeatures(eval)
 		response := 0.0
-		if eval.ProcTime >= m.SlowQueriesThresholdTime {
+		if m.Threshold.IsSlow(eval) {
 			numProblematic++
 			response = 1.0
 		}
-		featData = append(
-			featData,
-			training.Example{
-				Input:    features,
-				Response: []float64{response},
-			},
-		)
+		// go-deep does not support sample weights so we emulate
+		// them by repeating weighted samples
+		for range modutils.ReplicationFactor(eval.SampleWeight()) {
+			featData = append(
+				featData,
+				training.Example{
+					Input:    slices.Clone(features),
+					Response: []float64{response},
+				},
+			)
+		}
 	}
 	log.Debug().
 		Int("numPositive", numProblematic).
@@ -144,7 +195,7 @@ func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, slowQue
 
 	m.NeuralNet = deep.NewNeural(&deep.Config{
 		Inputs:     50,
-		Layout:     networkLayout,
+		Layout:     m.Layout,
 		Activation: deep.ActivationReLU,
 		Mode:       deep.ModeBinary,
 		Weight:     deep.NewUniform(1.0, 0.0),
@@ -152,10 +203,13 @@ func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, slowQue
 	})
 
 	//optimizer := training.NewSGD(0.05, 0.4, 1e-5, true)
-	optimizer := training.NewAdam(learningRate, 0.9, 0.999, 1e-8)
+	optimizer := training.NewAdam(m.LearningRate, 0.9, 0.999, 1e-8)
 	// params: optimizer, verbosity (print stats at every 50th iteration)
 	trainer := training.NewTrainer(optimizer, 50)
-	trainer.TrainContext(ctx, m.NeuralNet, trn, heldout, numEpochs)
+	trainer.TrainContext(ctx, m.NeuralNet, trn, heldout, m.NumEpochs)
+	if ctx != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
 	return nil
 }
 
@@ -210,10 +264,14 @@ func (m *Model) SaveToFile(filePath string) error {
 	defer file.Close()
 	dmp := m.NeuralNet.Dump()
 	tmpModel := jsonizedModel{
-		NeuralNet:                dmp,
-		DataRanges:               m.DataRanges,
-		SlowQueriesThresholdTime: m.SlowQueriesThresholdTime,
-		ClassThreshold:           m.ClassThreshold,
+		NeuralNet:      dmp,
+		DataRanges:     m.DataRanges,
+		Threshold:      m.Threshold,
+		ClassThreshold: m.ClassThreshold,
+		Manifest:       m.Manifest,
+		Layout:         m.Layout,
+		NumEpochs:      m.NumEpochs,
+		LearningRate:   m.LearningRate,
 	}
 	bytes, err := json.Marshal(tmpModel)
 	if err != nil {
@@ -252,16 +310,32 @@ func LoadFromFile(filePath string) (*Model, error) {
 		return nil, fmt.Errorf("failed to load Neural Network model from file %s: %w", filePath, err)
 	}
 	nn := deep.FromDump(model.NeuralNet)
-	return &Model{
-		NeuralNet:                nn,
-		DataRanges:               model.DataRanges,
-		SlowQueriesThresholdTime: model.SlowQueriesThresholdTime,
-		ClassThreshold:           model.ClassThreshold,
-	}, nil
+	thr := model.Threshold
+	if thr.IsZero() && model.SlowQueriesThresholdTime > 0 {
+		thr = threshold.Legacy(model.SlowQueriesThresholdTime)
+	}
+	ans := &Model{
+		NeuralNet:      nn,
+		DataRanges:     model.DataRanges,
+		Threshold:      thr,
+		ClassThreshold: model.ClassThreshold,
+		Manifest:       model.Manifest,
+		Layout:         model.Layout,
+		NumEpochs:      model.NumEpochs,
+		LearningRate:   model.LearningRate,
+	}
+	if len(ans.Layout) == 0 {
+		ans.Layout = model.NeuralNet.Config.Layout
+	}
+	return ans, nil
 }
 
-func NewModel() *Model {
+func NewModel(seed uint64) *Model {
 	return &Model{
 		ClassThreshold: 0.5,
+		Layout:         slices.Clone(dfltNetworkLayout),
+		NumEpochs:      dfltNumEpochs,
+		LearningRate:   dfltLearningRate,
+		Seed:           seed,
 	}
 }
@@ -17,7 +17,15 @@
 package predict
 
 type Prediction struct {
-	Votes          []float64
+
+	// Votes contains "fast" and "slow" votes
+	Votes []float64
+
+	// ClassVotes contains votes for individual classes in case
+	// the model distinguishes more than two classes (see threshold.MethodBins).
+	// Otherwise, it is empty.
+	ClassVotes []float64
+
 	PredictedClass int
 }
 
@@ -26,33 +26,50 @@ import (
 	"strings"
 
 	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/czcorpus/cqlizer/eval/manifest"
 	"github.com/czcorpus/cqlizer/eval/modutils"
 	"github.com/czcorpus/cqlizer/eval/predict"
+	"github.com/czcorpus/cqlizer/eval/threshold"
 	randomforest "github.com/malaschitz/randomForest"
 	"github.com/rs/zerolog/log"
 )
 
 type jsonizedRFModel struct {
-	Forest                   json.RawMessage `json:"forest"`
-	Comment                  string          `json:"comment"`
-	slowQueriesThresholdTime float64         `json:"slowQueriesThresholdTime"`
+	Forest    json.RawMessage      `json:"forest"`
+	Comment   string               `json:"comment"`
+	Threshold threshold.Definition `json:"threshold"`
+	Manifest  manifest.Manifest    `json:"manifest"`
+
+	// SlowQueriesThresholdTime is kept for reading older model files
+	SlowQueriesThresholdTime float64 `json:"slowQueriesThresholdTime,omitempty"`
 }
 
 // Model wraps a Random Forest classifier for regression via quantile binning
 type Model struct {
-	Forest                   *randomforest.Forest `json:"forest"`
-	NumTrees                 int                  `json:"numTrees"`
-	VotingThreshold          float64              `json:"votingThreshold"`
-	SlowQueriesThresholdTime float64              `json:"slowQueriesThresholdTime"`
-	Comment                  string               `json:"comment"`
+	Forest          *randomforest.Forest `json:"forest"`
+	NumTrees        int                  `json:"numTrees"`
+	VotingThreshold float64              `json:"votingThreshold"`
+	Threshold       threshold.Definition `json:"threshold"`
+	Comment         string               `json:"comment"`
+	Manifest        manifest.Manifest    `json:"manifest"`
+
+	// Seed initializes the random generator used for training.
+	// Zero means no explicit seeding.
+	Seed uint64 `json:"-"`
+
+	// SingleThreaded forces training in a single goroutine. The forest
+	// library shares one random generator among all its workers so only
+	// single-threaded training of a seeded model is fully reproducible.
+	SingleThreaded bool `json:"-"`
 }
 
 // NewModel creates a new Random Forest model with time binning
-func NewModel(numTrees int, votingThreshold float64) *Model {
+func NewModel(numTrees int, votingThreshold float64, seed uint64) *Model {
 	return &Model{
 		Forest:          &randomforest.Forest{},
 		NumTrees:        numTrees,
 		VotingThreshold: votingThreshold,
+		Seed:            seed,
 	}
 }
 
@@ -72,24 +89,42 @@ func (m *Model) SetClassThreshold(v float64) {
 	m.VotingThreshold = v
 }
 
-func (m *Model) GetSlowQueriesThresholdTime() float64 {
-	return m.SlowQueriesThresholdTime
+func (m *Model) GetThreshold() threshold.Definition {
+	return m.Threshold
+}
+
+func (m *Model) GetHyperparams() map[string]any {
+	return map[string]any{
+		"numTrees":        m.NumTrees,
+		"votingThreshold": m.VotingThreshold,
+		"singleThreaded":  m.SingleThreaded,
+	}
+}
+
+func (m *Model) SetManifest(mf manifest.Manifest) {
+	m.Manifest = mf
+}
+
+func (m *Model) GetManifest() manifest.Manifest {
+	return m.Manifest
 }
 
 func (m *Model) GetInfo() string {
-	return fmt.Sprintf("RF model, num. trees: %d, slow q. threshold time: %.2fs", m.NumTrees, m.SlowQueriesThresholdTime)
+	return fmt.Sprintf("RF model, num. trees: %d, slow q. threshold: %s", m.NumTrees, m.Threshold)
 }
 
-// Train trains the random forest on query evaluations and actual times
+// Train trains the random forest on query evaluations and actual times.
+// As the only model here, RF supports multi-class threshold definitions
+// (threshold.MethodBins).
 // note: the `comment` argument will be stored with the model for easier model review
-func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, slowQueriesThresholdTime float64, comment string) error {
+func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, thr threshold.Definition, comment string) error {
 	if len(data) == 0 {
 		return fmt.Errorf("no training data provided")
 	}
-	if slowQueriesThresholdTime <= 0 {
-		return fmt.Errorf("failed to train RF model - invalid value of SlowQueriesThresholdTime")
+	if !thr.IsResolved() {
+		return fmt.Errorf("failed to train RF model - unresolved slow queries threshold")
 	}
-	m.SlowQueriesThresholdTime = slowQueriesThresholdTime
+	m.Threshold = thr
 	if m.NumTrees <= 0 {
 		return fmt.Errorf("failed to train RF model - invalid value of NumTrees")
 	}
@@ -101,23 +136,35 @@ func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, slowQue
 			return ctx.Err()
 		}
 		features := feats.ExtractFeatures(eval)
-		isPositive := 0
-		if eval.ProcTime >= m.SlowQueriesThresholdTime {
+		cls := m.Threshold.Class(eval)
+		if cls >= m.Threshold.SlowClassIdx() {
 			numProblematic++
-			isPositive = 1
 		}
-		xData = append(xData, features)
-		yData = append(yData, isPositive)
+		// the RF implementation does not support sample weights
+		// so we emulate them by repeating weighted samples
+		for range modutils.ReplicationFactor(eval.SampleWeight()) {
+			xData = append(xData, features)
+			yData = append(yData, cls)
+		}
 	}
 	log.Debug().
 		Int("numPositive", numProblematic).
 		Int("dataSize", len(data)).
+		Int("numVectors", len(xData)).
 		Msg("prepared training vectors")
 
 	m.Forest.Data = randomforest.ForestData{
 		X:     xData,
 		Class: yData,
 	}
+	if m.Seed != 0 {
+		modutils.SeedGlobalRand(m.Seed)
+	}
+	if m.SingleThreaded {
+		numWorkers := randomforest.NumWorkers
+		randomforest.NumWorkers = 1
+		defer func() { randomforest.NumWorkers = numWorkers }()
+	}
 	m.Forest.Train(m.NumTrees)
 	m.Comment = comment
 	return nil
@@ -127,14 +174,22 @@ func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, slowQue
 func (m *Model) Predict(eval feats.QueryEvaluation) predict.Prediction {
 	features := feats.ExtractFeatures(eval)
 	votes := m.Forest.Vote(features)
+	var slowVote float64
+	for _, v := range votes[min(m.Threshold.SlowClassIdx(), len(votes)):] {
+		slowVote += v
+	}
 	var ans int
-	if votes[1] > m.VotingThreshold {
+	if slowVote > m.VotingThreshold {
 		ans = 1
 	}
-	return predict.Prediction{
-		Votes:          votes,
+	pred := predict.Prediction{
+		Votes:          []float64{1 - slowVote, slowVote},
 		PredictedClass: ans,
 	}
+	if len(votes) > 2 {
+		pred.ClassVotes = votes
+	}
+	return pred
 }
 
 // SaveToFile saves the RF model to a file
@@ -146,8 +201,9 @@ func (m *Model) SaveToFile(filePath string) error {
 	defer file.Close()
 
 	tmpModel := jsonizedRFModel{
-		Comment:                  m.Comment,
-		slowQueriesThresholdTime: m.SlowQueriesThresholdTime,
+		Comment:   m.Comment,
+		Threshold: m.Threshold,
+		Manifest:  m.Manifest,
 	}
 
 	bytes, err := json.Marshal(&m.Forest)
@@ -198,8 +254,12 @@ func LoadFromFile(filePath string) (*Model, error) {
 	}
 
 	model := &Model{
-		Comment:                  tmpModel.Comment,
-		SlowQueriesThresholdTime: tmpModel.slowQueriesThresholdTime,
+		Comment:   tmpModel.Comment,
+		Threshold: tmpModel.Threshold,
+		Manifest:  tmpModel.Manifest,
+	}
+	if model.Threshold.IsZero() && tmpModel.SlowQueriesThresholdTime > 0 {
+		model.Threshold = threshold.Legacy(tmpModel.SlowQueriesThresholdTime)
 	}
 
 	var forest randomforest.Forest
@@ -0,0 +1,355 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package threshold
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/czcorpus/cqlizer/eval/feats"
+)
+
+const (
+	// MethodKnee derives the threshold time from the knee point
+	// of sorted processing times
+	MethodKnee = "knee"
+
+	// MethodFixed uses a fixed threshold time in seconds
+	MethodFixed = "fixed"
+
+	// MethodPercentile derives the threshold time from a percentile
+	// of processing times
+	MethodPercentile = "percentile"
+
+	// MethodCorpusSize uses different fixed thresholds for different
+	// corpus sizes
+	MethodCorpusSize = "corpus-size"
+
+	// MethodBins splits queries into multiple classes by their processing
+	// time (e.g. fast / medium / slow / pathological)
+	MethodBins = "bins"
+)
+
+var dfltBinLabels = []string{"fast", "medium", "slow", "pathological"}
+
+// SizeBucket defines a slow query threshold time for corpora
+// up to MaxCorpusSize tokens. Zero MaxCorpusSize means "any size".
+type SizeBucket struct {
+	MaxCorpusSize float64 `json:"maxCorpusSize" msgpack:"maxCorpusSize"`
+	Time          float64 `json:"time" msgpack:"time"`
+}
+
+// Definition specifies which queries are considered slow. It is created
+// from user input (see ParseSpec), resolved against learning data (see Resolve)
+// and then stored along with a trained model so evaluation uses exactly the same
+// boundary as training.
+type Definition struct {
+	Method string `json:"method" msgpack:"method"`
+
+	// Time is the resolved threshold time in seconds for the "knee",
+	// "fixed" and "percentile" methods
+	Time float64 `json:"time" msgpack:"time"`
+
+	// Percentile (0..1) is used with the "percentile" method
+	Percentile float64 `json:"percentile,omitempty" msgpack:"percentile,omitempty"`
+
+	// SizeBuckets are sorted by MaxCorpusSize with the unlimited bucket (if any)
+	// being the last one
+	SizeBuckets []SizeBucket `json:"sizeBuckets,omitempty" msgpack:"sizeBuckets,omitempty"`
+
+	// Bins are ascending time boundaries (in seconds) between classes
+	// for the "bins" method. N boundaries define N+1 classes.
+	Bins []float64 `json:"bins,omitempty" msgpack:"bins,omitempty"`
+
+	// SlowClass is the index of the first class considered slow
+	// for the "bins" method.
+	SlowClass int `json:"slowClass,omitempty" msgpack:"slowClass,omitempty"`
+}
+
+// ParseSpec creates a threshold definition from a command line specification:
+//
+//	knee
+//	fixed:SECONDS
+//	percentile:P (0 < P < 1)
+//	corpus-size:MAXSIZE1=SECONDS1,MAXSIZE2=SECONDS2,*=SECONDS3
+//	bins:B1,B2,B3 (ascending boundaries in seconds)
+func ParseSpec(spec string) (Definition, error) {
+	method, args, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	var def Definition
+	def.Method = method
+	switch method {
+	case MethodKnee, "":
+		def.Method = MethodKnee
+	case MethodFixed:
+		v, err := strconv.ParseFloat(args, 64)
+		if err != nil || v <= 0 {
+			return def, fmt.Errorf("invalid fixed threshold time `%s`", args)
+		}
+		def.Time = v
+	case MethodPercentile:
+		v, err := strconv.ParseFloat(args, 64)
+		if err != nil || v <= 0 || v >= 1 {
+			return def, fmt.Errorf("invalid percentile `%s` (expected value between 0 and 1)", args)
+		}
+		def.Percentile = v
+	case MethodCorpusSize:
+		for _, item := range strings.Split(args, ",") {
+			size, tm, ok := strings.Cut(item, "=")
+			if !ok {
+				return def, fmt.Errorf("invalid corpus size bucket `%s`", item)
+			}
+			var bucket SizeBucket
+			var err error
+			if size != "*" {
+				bucket.MaxCorpusSize, err = strconv.ParseFloat(size, 64)
+				if err != nil || bucket.MaxCorpusSize <= 0 {
+					return def, fmt.Errorf("invalid corpus size bucket `%s`", item)
+				}
+			}
+			bucket.Time, err = strconv.ParseFloat(tm, 64)
+			if err != nil || bucket.Time <= 0 {
+				return def, fmt.Errorf("invalid corpus size bucket `%s`", item)
+			}
+			def.SizeBuckets = append(def.SizeBuckets, bucket)
+		}
+		slices.SortFunc(def.SizeBuckets, func(b1, b2 SizeBucket) int {
+			if b1.MaxCorpusSize == 0 {
+				return 1
+			}
+			if b2.MaxCorpusSize == 0 {
+				return -1
+			}
+			return cmp.Compare(b1.MaxCorpusSize, b2.MaxCorpusSize)
+		})
+	case MethodBins:
+		for _, item := range strings.Split(args, ",") {
+			v, err := strconv.ParseFloat(item, 64)
+			if err != nil || v <= 0 {
+				return def, fmt.Errorf("invalid bin boundary `%s`", item)
+			}
+			if len(def.Bins) > 0 && def.Bins[len(def.Bins)-1] >= v {
+				return def, fmt.Errorf("bin boundaries must be ascending")
+			}
+			def.Bins = append(def.Bins, v)
+		}
+		def.SlowClass = max(1, len(def.Bins)-1)
+	default:
+		return def, fmt.Errorf("unknown threshold method `%s`", method)
+	}
+	return def, nil
+}
+
+// IsZero tests whether the definition is empty. This is typically
+// the case of models created before threshold definitions were stored.
+func (def Definition) IsZero() bool {
+	return def.Method == "" && def.Time == 0
+}
+
+// IsResolved tests whether the definition can be used to label queries
+func (def Definition) IsResolved() bool {
+	switch def.Method {
+	case MethodCorpusSize:
+		return len(def.SizeBuckets) > 0
+	case MethodBins:
+		return len(def.Bins) > 0
+	default:
+		return def.Time > 0
+	}
+}
+
+// Resolve calculates threshold time for data-dependent methods (knee, percentile).
+// The data must be sorted by processing time.
+func (def Definition) Resolve(sortedData []feats.QueryEvaluation) (Definition, error) {
+	if len(sortedData) == 0 {
+		return def, fmt.Errorf("cannot resolve slow query threshold - no data")
+	}
+	switch def.Method {
+	case MethodKnee:
+		def.Time, _ = FindKneeDistance(sortedData)
+	case MethodPercentile:
+		idx := int(math.Floor(def.Percentile * float64(len(sortedData)-1)))
+		def.Time = sortedData[idx].ProcTime
+	}
+	if !def.IsResolved() {
+		return def, fmt.Errorf("failed to resolve slow query threshold (method: %s)", def.Method)
+	}
+	return def, nil
+}
+
+// NumClasses returns number of classes a model should distinguish
+func (def Definition) NumClasses() int {
+	if def.Method == MethodBins {
+		return len(def.Bins) + 1
+	}
+	return 2
+}
+
+// SlowClassIdx returns index of the first class representing slow queries
+func (def Definition) SlowClassIdx() int {
+	if def.Method == MethodBins {
+		return def.SlowClass
+	}
+	return 1
+}
+
+// ClassLabel returns a human readable name of a class
+func (def Definition) ClassLabel(cls int) string {
+	if def.Method == MethodBins {
+		if len(def.Bins) == len(dfltBinLabels)-1 {
+			return dfltBinLabels[cls]
+		}
+		return fmt.Sprintf("bin%d", cls)
+	}
+	if cls == 0 {
+		return "fast"
+	}
+	return "slow"
+}
+
+// SlowTimeFor returns the time from which queries are considered slow
+// for a corpus of a specified size. The `logCorpusSize` argument is expected
+// to be log-scaled (as in feats.QueryEvaluation).
+func (def Definition) SlowTimeFor(logCorpusSize float64) float64 {
+	switch def.Method {
+	case MethodCorpusSize:
+		for _, b := range def.SizeBuckets {
+			if b.MaxCorpusSize == 0 || logCorpusSize <= math.Log(b.MaxCorpusSize) {
+				return b.Time
+			}
+		}
+		return math.Inf(1)
+	case MethodBins:
+		return def.Bins[def.SlowClass-1]
+	}
+	return def.Time
+}
+
+// Class returns a class index of an evaluated query. For all the methods
+// except for "bins", 0 means fast and 1 means slow.
+func (def Definition) Class(eval feats.QueryEvaluation) int {
+	if def.Method == MethodBins {
+		for i, b := range def.Bins {
+			if eval.ProcTime < b {
+				return i
+			}
+		}
+		return len(def.Bins)
+	}
+	if eval.ProcTime >= def.SlowTimeFor(eval.CorpusSize) {
+		return 1
+	}
+	return 0
+}
+
+// IsSlow tests whether an evaluated query belongs to the slow queries
+func (def Definition) IsSlow(eval feats.QueryEvaluation) bool {
+	return def.Class(eval) >= def.SlowClassIdx()
+}
+
+// BinaryLabel returns 1 for slow queries and 0 for the rest
+func (def Definition) BinaryLabel(eval feats.QueryEvaluation) int {
+	if def.IsSlow(eval) {
+		return 1
+	}
+	return 0
+}
+
+// Equal tests whether two definitions label queries the same way
+func (def Definition) Equal(other Definition) bool {
+	return def.Method == other.Method &&
+		def.Time == other.Time &&
+		def.SlowClass == other.SlowClass &&
+		slices.Equal(def.SizeBuckets, other.SizeBuckets) &&
+		slices.Equal(def.Bins, other.Bins)
+}
+
+func (def Definition) String() string {
+	switch def.Method {
+	case MethodKnee:
+		return fmt.Sprintf("knee (%.2fs)", def.Time)
+	case MethodFixed:
+		return fmt.Sprintf("fixed (%.2fs)", def.Time)
+	case MethodPercentile:
+		return fmt.Sprintf("percentile %.3f (%.2fs)", def.Percentile, def.Time)
+	case MethodCorpusSize:
+		items := make([]string, len(def.SizeBuckets))
+		for i, b := range def.SizeBuckets {
+			if b.MaxCorpusSize == 0 {
+				items[i] = fmt.Sprintf("*: %.2fs", b.Time)
+
+			} else {
+				items[i] = fmt.Sprintf("<=%.0f: %.2fs", b.MaxCorpusSize, b.Time)
+			}
+		}
+		return fmt.Sprintf("corpus size (%s)", strings.Join(items, ", "))
+	case MethodBins:
+		items := make([]string, len(def.Bins))
+		for i, b := range def.Bins {
+			items[i] = fmt.Sprintf("%.2fs", b)
+		}
+		return fmt.Sprintf("bins (%s, slow from %s)", strings.Join(items, ", "), def.ClassLabel(def.SlowClass))
+	}
+	return fmt.Sprintf("%.2fs", def.Time)
+}
+
+// Legacy creates a definition for models which stored just
+// a single threshold time.
+func Legacy(slowQueriesTime float64) Definition {
+	return Definition{
+		Method: MethodFixed,
+		Time:   slowQueriesTime,
+	}
+}
+
+// FindKneeDistance finds a knee point of processing times of data
+// sorted by processing time.
+func FindKneeDistance(items []feats.QueryEvaluation) (threshold float64, kneeIdx int) {
+
+	n := len(items)
+	if n < 2 {
+		return items[n-1].ProcTime, 100.0
+	}
+
+	// Line from first to last point
+	x1, y1 := 0.0, items[0].ProcTime
+	x2, y2 := float64(n-1), items[n-1].ProcTime
+
+	// Line equation coefficients: ax + by + c = 0
+	a := y2 - y1
+	b := x1 - x2
+	c := x2*y1 - x1*y2
+
+	normFactor := math.Sqrt(a*a + b*b)
+
+	maxDist := 0.0
+	kneeIdx = 0
+
+	for i := 0; i < n; i++ {
+		// Perpendicular distance from point to line
+		dist := math.Abs(a*float64(i)+b*items[i].ProcTime+c) / normFactor
+		if dist > maxDist {
+			maxDist = dist
+			kneeIdx = i
+		}
+	}
+	threshold = items[kneeIdx].ProcTime
+	return threshold, kneeIdx
+}
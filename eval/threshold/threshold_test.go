@@ -0,0 +1,87 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package threshold
+
+import (
+	"math"
+	"testing"
+
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFixed(t *testing.T) {
+	def, err := ParseSpec("fixed:5")
+	assert.NoError(t, err)
+	assert.Equal(t, MethodFixed, def.Method)
+	assert.Equal(t, 5.0, def.Time)
+	assert.True(t, def.IsResolved())
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"fixed:-1", "percentile:1.5", "bins:5,1", "corpus-size:foo", "foo"} {
+		_, err := ParseSpec(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestPercentileResolve(t *testing.T) {
+	def, err := ParseSpec("percentile:0.9")
+	assert.NoError(t, err)
+	data := make([]feats.QueryEvaluation, 11)
+	for i := range data {
+		data[i].ProcTime = float64(i)
+	}
+	def, err = def.Resolve(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 9.0, def.Time)
+}
+
+func TestCorpusSizeBuckets(t *testing.T) {
+	def, err := ParseSpec("corpus-size:*=10,1000000=1,100000000=5")
+	assert.NoError(t, err)
+	assert.Equal(t, 1000000.0, def.SizeBuckets[0].MaxCorpusSize)
+	assert.Equal(t, 0.0, def.SizeBuckets[2].MaxCorpusSize)
+
+	small := feats.QueryEvaluation{CorpusSize: math.Log(500000), ProcTime: 2}
+	medium := feats.QueryEvaluation{CorpusSize: math.Log(50000000), ProcTime: 2}
+	large := feats.QueryEvaluation{CorpusSize: math.Log(6000000000), ProcTime: 9}
+	assert.True(t, def.IsSlow(small))
+	assert.False(t, def.IsSlow(medium))
+	assert.False(t, def.IsSlow(large))
+}
+
+func TestBins(t *testing.T) {
+	def, err := ParseSpec("bins:1,5,30")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, def.NumClasses())
+	assert.Equal(t, 2, def.SlowClassIdx())
+	assert.Equal(t, 0, def.Class(feats.QueryEvaluation{ProcTime: 0.5}))
+	assert.Equal(t, 1, def.Class(feats.QueryEvaluation{ProcTime: 1}))
+	assert.Equal(t, 3, def.Class(feats.QueryEvaluation{ProcTime: 100}))
+	assert.False(t, def.IsSlow(feats.QueryEvaluation{ProcTime: 4}))
+	assert.True(t, def.IsSlow(feats.QueryEvaluation{ProcTime: 6}))
+	assert.Equal(t, "pathological", def.ClassLabel(3))
+}
+
+func TestEqual(t *testing.T) {
+	d1, _ := ParseSpec("bins:1,5,30")
+	d2, _ := ParseSpec("bins:1,5,30")
+	d3, _ := ParseSpec("bins:1,5,31")
+	assert.True(t, d1.Equal(d2))
+	assert.False(t, d1.Equal(d3))
+}
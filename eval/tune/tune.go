@@ -0,0 +1,375 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tune
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/cqlizer/eval"
+	"github.com/czcorpus/cqlizer/eval/nn"
+	"github.com/czcorpus/cqlizer/eval/rf"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	SearchGrid   = "grid"
+	SearchRandom = "random"
+
+	dfltNumFolds  = 5
+	dfltNumTrials = 10
+
+	dfltRFNumTrees = 100
+)
+
+// Params is a single hyperparameter configuration
+type Params map[string]any
+
+func (p Params) String() string {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	items := make([]string, len(keys))
+	for i, k := range keys {
+		items[i] = fmt.Sprintf("%s=%v", k, p[k])
+	}
+	return strings.Join(items, " ")
+}
+
+// Space defines candidate values for each hyperparameter
+type Space map[string][]any
+
+// DefaultSpace returns a built-in search space for a model type.
+// For unsupported model types, nil is returned.
+func DefaultSpace(modelType string) Space {
+	switch modelType {
+	case "rf":
+		return Space{
+			"numTrees": {50, 100, 200, 400},
+		}
+	case "nn":
+		return Space{
+			"layout":       {[]int{50, 15, 1}, []int{30, 10, 1}, []int{20, 14, 7, 1}},
+			"epochs":       {400, 800},
+			"learningRate": {0.0005, 0.001},
+		}
+	}
+	return nil
+}
+
+// LoadSpace loads a search space from a JSON file where each key
+// is a hyperparameter name and each value is a list of candidate values.
+func LoadSpace(path string) (Space, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load search space: %w", err)
+	}
+	var ans Space
+	if err := json.Unmarshal(data, &ans); err != nil {
+		return nil, fmt.Errorf("failed to load search space: %w", err)
+	}
+	for k, v := range ans {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("failed to load search space: no values for %s", k)
+		}
+	}
+	return ans, nil
+}
+
+func (space Space) sortedKeys() []string {
+	keys := make([]string, 0, len(space))
+	for k := range space {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Grid returns all the combinations of hyperparameter values
+func (space Space) Grid() []Params {
+	ans := []Params{{}}
+	for _, key := range space.sortedKeys() {
+		next := make([]Params, 0, len(ans)*len(space[key]))
+		for _, p := range ans {
+			for _, v := range space[key] {
+				np := make(Params, len(p)+1)
+				for k2, v2 := range p {
+					np[k2] = v2
+				}
+				np[key] = v
+				next = append(next, np)
+			}
+		}
+		ans = next
+	}
+	return ans
+}
+
+// Conf configures hyperparameter search
+type Conf struct {
+	Search    string
+	NumTrials int
+	NumFolds  int
+	Seed      uint64
+}
+
+func (conf Conf) WithDefaults() Conf {
+	if conf.Search == "" {
+		conf.Search = SearchGrid
+	}
+	if conf.NumTrials == 0 {
+		conf.NumTrials = dfltNumTrials
+	}
+	if conf.NumFolds == 0 {
+		conf.NumFolds = dfltNumFolds
+	}
+	return conf
+}
+
+func (conf Conf) Validate() error {
+	if conf.Search != SearchGrid && conf.Search != SearchRandom {
+		return fmt.Errorf("unknown search method: %s", conf.Search)
+	}
+	if conf.NumTrials < 1 {
+		return fmt.Errorf("invalid number of trials %d", conf.NumTrials)
+	}
+	if conf.NumFolds < 2 {
+		return fmt.Errorf("invalid number of folds %d", conf.NumFolds)
+	}
+	return nil
+}
+
+// Candidates returns configurations to be evaluated. For the random search,
+// configurations are drawn (without replacement) from the full grid.
+func (conf Conf) Candidates(space Space) []Params {
+	grid := space.Grid()
+	if conf.Search == SearchGrid || conf.NumTrials >= len(grid) {
+		return grid
+	}
+	rnd := rand.New(rand.NewPCG(conf.Seed, conf.Seed))
+	ans := make([]Params, conf.NumTrials)
+	for i, idx := range rnd.Perm(len(grid))[:conf.NumTrials] {
+		ans[i] = grid[idx]
+	}
+	return ans
+}
+
+// ------------------------------
+
+// Trial is an evaluated hyperparameter configuration
+type Trial struct {
+	Params   Params
+	Result   eval.CVResult
+	Duration time.Duration
+	Err      error
+}
+
+// Leaderboard contains trials sorted from the best one
+type Leaderboard []Trial
+
+func (lb Leaderboard) sort() {
+	slices.SortStableFunc(lb, func(t1, t2 Trial) int {
+		if (t1.Err == nil) != (t2.Err == nil) {
+			if t1.Err == nil {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(t2.Result.MeanFBeta, t1.Result.MeanFBeta)
+	})
+}
+
+// Best returns the best successful trial. If there is none, false is returned.
+func (lb Leaderboard) Best() (Trial, bool) {
+	if len(lb) == 0 || lb[0].Err != nil {
+		return Trial{}, false
+	}
+	return lb[0], true
+}
+
+// WriteCSV writes the leaderboard in a CSV format
+func (lb Leaderboard) WriteCSV(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "rank;params;f-beta;f-beta-stddev;precision;recall;vote;duration;error"); err != nil {
+		return err
+	}
+	for i, t := range lb {
+		var errMsg string
+		if t.Err != nil {
+			errMsg = t.Err.Error()
+		}
+		_, err := fmt.Fprintf(
+			w, "%d;%s;%.4f;%.4f;%.4f;%.4f;%.2f;%s;%s\n",
+			i+1, t.Params, t.Result.MeanFBeta, t.Result.StdDevFBeta, t.Result.MeanPrecision,
+			t.Result.MeanRecall, t.Result.VoteThreshold, t.Duration.Round(time.Second), errMsg,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ------------------------------
+
+func toInt(v any) (int, error) {
+	switch tv := v.(type) {
+	case int:
+		return tv, nil
+	case float64:
+		if tv != float64(int(tv)) {
+			return 0, fmt.Errorf("value %v is not an integer", v)
+		}
+		return int(tv), nil
+	}
+	return 0, fmt.Errorf("value %v is not an integer", v)
+}
+
+func toFloat(v any) (float64, error) {
+	switch tv := v.(type) {
+	case int:
+		return float64(tv), nil
+	case float64:
+		return tv, nil
+	}
+	return 0, fmt.Errorf("value %v is not a number", v)
+}
+
+func toIntSlice(v any) ([]int, error) {
+	switch tv := v.(type) {
+	case []int:
+		return slices.Clone(tv), nil
+	case []any:
+		ans := make([]int, len(tv))
+		for i, item := range tv {
+			var err error
+			if ans[i], err = toInt(item); err != nil {
+				return nil, err
+			}
+		}
+		return ans, nil
+	}
+	return nil, fmt.Errorf("value %v is not a list of integers", v)
+}
+
+// NewModel creates an untrained model of a specified type configured
+// with provided hyperparameters. Only models trainable in Go (rf, nn)
+// are supported.
+func NewModel(modelType string, params Params, seed uint64, singleThreaded bool) (eval.MLModel, error) {
+	var err error
+	switch modelType {
+	case "rf":
+		model := rf.NewModel(dfltRFNumTrees, 0.5, seed)
+		model.SingleThreaded = singleThreaded
+		for k, v := range params {
+			switch k {
+			case "numTrees":
+				model.NumTrees, err = toInt(v)
+			default:
+				err = fmt.Errorf("unknown RF hyperparameter %s", k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid RF hyperparameter %s: %w", k, err)
+			}
+		}
+		return model, nil
+	case "nn":
+		model := nn.NewModel(seed)
+		for k, v := range params {
+			switch k {
+			case "layout":
+				model.Layout, err = toIntSlice(v)
+			case "epochs":
+				model.NumEpochs, err = toInt(v)
+			case "learningRate":
+				model.LearningRate, err = toFloat(v)
+			default:
+				err = fmt.Errorf("unknown NN hyperparameter %s", k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid NN hyperparameter %s: %w", k, err)
+			}
+		}
+		return model, nil
+	}
+	return nil, fmt.Errorf("model %s cannot be tuned this way", modelType)
+}
+
+// Run evaluates all the candidate configurations using cross-validation
+// and returns a leaderboard. In case the context is cancelled, the search
+// stops and the leaderboard contains just the already finished trials
+// (along with the context error).
+func Run(
+	ctx context.Context,
+	predictor *eval.Predictor,
+	modelType string,
+	space Space,
+	conf Conf,
+	balanceConf eval.BalanceConf,
+	singleThreaded bool,
+) (Leaderboard, error) {
+	candidates := conf.Candidates(space)
+	ans := make(Leaderboard, 0, len(candidates))
+	for i, params := range candidates {
+		if err := ctx.Err(); err != nil {
+			ans.sort()
+			return ans, err
+		}
+		log.Info().
+			Int("trial", i+1).
+			Int("numTrials", len(candidates)).
+			Str("params", params.String()).
+			Msg("evaluating hyperparameters")
+		t0 := time.Now()
+		res, err := predictor.CrossValidate(
+			ctx,
+			func() (eval.MLModel, error) {
+				return NewModel(modelType, params, balanceConf.Seed, singleThreaded)
+			},
+			conf.NumFolds,
+			balanceConf,
+		)
+		if ctx.Err() != nil {
+			ans.sort()
+			return ans, ctx.Err()
+		}
+		trial := Trial{Params: params, Result: res, Duration: time.Since(t0), Err: err}
+		if err != nil {
+			log.Error().Err(err).Str("params", params.String()).Msg("trial failed")
+
+		} else {
+			log.Info().
+				Str("params", params.String()).
+				Float64("fBeta", res.MeanFBeta).
+				Float64("fBetaStdDev", res.StdDevFBeta).
+				Float64("vote", res.VoteThreshold).
+				Msg("trial finished")
+		}
+		ans = append(ans, trial)
+	}
+	ans.sort()
+	return ans, nil
+}
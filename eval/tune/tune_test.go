@@ -0,0 +1,69 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tune
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/czcorpus/cqlizer/eval/nn"
+	"github.com/czcorpus/cqlizer/eval/rf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGridContainsAllCombinations(t *testing.T) {
+	space := Space{"a": {1, 2, 3}, "b": {"x", "y"}}
+	grid := space.Grid()
+	assert.Len(t, grid, 6)
+	assert.Equal(t, Params{"a": 1, "b": "x"}, grid[0])
+	assert.Equal(t, Params{"a": 3, "b": "y"}, grid[5])
+}
+
+func TestRandomCandidatesAreReproducible(t *testing.T) {
+	space := Space{"a": {1, 2, 3, 4}, "b": {1, 2, 3, 4}}
+	conf := Conf{Search: SearchRandom, NumTrials: 5, Seed: 7}.WithDefaults()
+	c1 := conf.Candidates(space)
+	c2 := conf.Candidates(space)
+	assert.Len(t, c1, 5)
+	assert.Equal(t, c1, c2)
+}
+
+func TestNewModelFromLoadedSpace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "space.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"layout": [[10, 1]], "epochs": [20], "learningRate": [0.01]}`), 0644))
+	space, err := LoadSpace(path)
+	assert.NoError(t, err)
+	model, err := NewModel("nn", space.Grid()[0], 1, false)
+	assert.NoError(t, err)
+	nnModel := model.(*nn.Model)
+	assert.Equal(t, []int{10, 1}, nnModel.Layout)
+	assert.Equal(t, 20, nnModel.NumEpochs)
+	assert.Equal(t, 0.01, nnModel.LearningRate)
+}
+
+func TestNewModelInvalidParams(t *testing.T) {
+	_, err := NewModel("rf", Params{"numTrees": 10.5}, 1, false)
+	assert.Error(t, err)
+	_, err = NewModel("rf", Params{"foo": 1}, 1, false)
+	assert.Error(t, err)
+	_, err = NewModel("xg", Params{}, 1, false)
+	assert.Error(t, err)
+	model, err := NewModel("rf", Params{"numTrees": 30.0}, 1, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, model.(*rf.Model).NumTrees)
+}
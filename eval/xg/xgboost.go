@@ -29,8 +29,10 @@ import (
 
 	"github.com/czcorpus/cnc-gokit/fs"
 	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/czcorpus/cqlizer/eval/manifest"
 	"github.com/czcorpus/cqlizer/eval/modutils"
 	"github.com/czcorpus/cqlizer/eval/predict"
+	"github.com/czcorpus/cqlizer/eval/threshold"
 	"github.com/dmitryikh/leaves"
 	"github.com/rs/zerolog/log"
 	"github.com/vmihailenco/msgpack/v5"
@@ -48,52 +50,71 @@ type metadata struct {
 	ColsampleBytree float64   `json:"colsample_bytree"`
 	RandomState     int       `json:"random_state"`
 	Verbose         int       `json:"verbose"`
+
+	// Threshold is copied by the learning script from the training
+	// data file (see Model.SaveToFile)
+	Threshold threshold.Definition `json:"threshold"`
+
+	// Manifest is copied by the learning script from the training
+	// data file and completed with actual hyperparameters and PR-AUC
+	Manifest manifest.Manifest `json:"manifest"`
 }
 
 type Model struct {
-	ClassThreshold           float64
-	SlowQueriesThresholdTime float64
-	trainXData               [][]float64
-	trainYData               []int
-	xgboost                  *leaves.Ensemble
-	metadata                 metadata
+	ClassThreshold float64
+	Threshold      threshold.Definition
+	Manifest       manifest.Manifest
+	trainXData     [][]float64
+	trainYData     []int
+	trainWeights   []float64
+	classWeighted  bool
+	xgboost        *leaves.Ensemble
+	metadata       metadata
 }
 
 func (m *Model) IsInferenceOnly() bool {
 	return true
 }
 
+// SetClassWeighted marks training data as class-weighted so the learning
+// script does not apply its own positive class weighting.
+func (m *Model) SetClassWeighted(v bool) {
+	m.classWeighted = v
+}
+
 func (m *Model) CreateModelFileName(featsFile string) string {
 	return modutils.ExtractModelNameBaseFromFeatFile(featsFile) + ".feats.xg.msgpack"
 }
 
-func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, slowQueriesTime float64, comment string) error {
+// Train prepares data for binary classification. In case of a multi-class
+// threshold definition, the classes are collapsed to "fast" and "slow".
+func (m *Model) Train(ctx context.Context, data []feats.QueryEvaluation, thr threshold.Definition, comment string) error {
 	if len(data) == 0 {
 		return fmt.Errorf("no training data provided")
 	}
-	if slowQueriesTime <= 0 {
-		return fmt.Errorf("failed to train RF model - invalid value of SlowQueriesThresholdTime")
+	if !thr.IsResolved() {
+		return fmt.Errorf("failed to prepare XG data - unresolved slow queries threshold")
 	}
-	m.SlowQueriesThresholdTime = slowQueriesTime
+	m.Threshold = thr
 
 	var xData [][]float64
 	var yData []int
+	var weights []float64
 	numProblematic := 0
 	for i, eval := range data {
 		if i%100 == 0 && ctx != nil && ctx.Err() != nil {
 			return ctx.Err()
 		}
 		features := feats.ExtractFeatures(eval)
-		isPositive := 0
-		if eval.ProcTime >= m.SlowQueriesThresholdTime {
-			numProblematic++
-			isPositive = 1
-		}
+		isPositive := m.Threshold.BinaryLabel(eval)
+		numProblematic += isPositive
 		xData = append(xData, features)
 		yData = append(yData, isPositive)
+		weights = append(weights, eval.SampleWeight())
 	}
 	m.trainXData = xData
 	m.trainYData = yData
+	m.trainWeights = weights
 	return nil
 }
 
@@ -118,8 +139,36 @@ func (m *Model) GetClassThreshold() float64 {
 	return m.ClassThreshold
 }
 
-func (m *Model) GetSlowQueriesThresholdTime() float64 {
-	return m.SlowQueriesThresholdTime
+func (m *Model) GetThreshold() threshold.Definition {
+	return m.Threshold
+}
+
+// GetHyperparams returns parameters used by the learning script.
+// Before the script is run, this is empty.
+func (m *Model) GetHyperparams() map[string]any {
+	if m.metadata.Objective == "" {
+		return map[string]any{}
+	}
+	return map[string]any{
+		"objective":         m.metadata.Objective,
+		"metric":            m.metadata.Metric,
+		"scale_pos_weight":  m.metadata.ScalePosWeight,
+		"max_depth":         m.metadata.MaxDepth,
+		"learning_rate":     m.metadata.LearningRate,
+		"num_leaves":        m.metadata.NumLeaves,
+		"min_child_samples": m.metadata.MinChildSamples,
+		"subsample":         m.metadata.Subsample,
+		"colsample_bytree":  m.metadata.ColsampleBytree,
+		"random_state":      m.metadata.RandomState,
+	}
+}
+
+func (m *Model) SetManifest(mf manifest.Manifest) {
+	m.Manifest = mf
+}
+
+func (m *Model) GetManifest() manifest.Manifest {
+	return m.Manifest
 }
 
 func (m *Model) SaveToFile(filePath string) error {
@@ -131,6 +180,10 @@ func (m *Model) SaveToFile(filePath string) error {
 	out := make(map[string]any)
 	out["features"] = m.trainXData
 	out["label"] = m.trainYData
+	out["weight"] = m.trainWeights
+	out["threshold"] = m.Threshold
+	out["classWeighted"] = m.classWeighted
+	out["manifest"] = m.Manifest
 
 	outData, err := msgpack.Marshal(out)
 	if err != nil {
@@ -145,12 +198,13 @@ func (m *Model) SaveToFile(filePath string) error {
 
 func (m *Model) GetInfo() string {
 	return fmt.Sprintf(
-		"XGBoost model, metric: %s / %s, NL: %d, SPV: %.2f, LR: %.2f",
+		"XGBoost model, metric: %s / %s, NL: %d, SPV: %.2f, LR: %.2f, slow q. threshold: %s",
 		m.metadata.Metric[0],
 		m.metadata.Metric[1],
 		m.metadata.NumLeaves,
 		m.metadata.ScalePosWeight,
 		m.metadata.LearningRate,
+		m.Threshold,
 	)
 }
 
@@ -206,7 +260,12 @@ func LoadFromFile(filePath string) (*Model, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load XG model: %w", err)
 	}
-	return &Model{xgboost: model, metadata: metadata}, nil
+	return &Model{
+		xgboost:   model,
+		metadata:  metadata,
+		Threshold: metadata.Threshold,
+		Manifest:  metadata.Manifest,
+	}, nil
 }
 
 func NewModel() *Model {
@@ -21,14 +21,16 @@ import (
 	"fmt"
 
 	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/czcorpus/cqlizer/eval/manifest"
 	"github.com/czcorpus/cqlizer/eval/predict"
+	"github.com/czcorpus/cqlizer/eval/threshold"
 )
 
 // Model is a constant classifier model which evaluates any query as slow (ym = yes-man). It is for debugging
 // purposes (for debugging and developing cqlizer's clients).
 type Model struct {
-	SlowQueriesThresholdTime float64
-	ClassThreshold           float64
+	Threshold      threshold.Definition
+	ClassThreshold float64
 }
 
 func (ym *Model) IsInferenceOnly() bool {
@@ -39,7 +41,7 @@ func (ym *Model) CreateModelFileName(featsFile string) string {
 	return "ym-model"
 }
 
-func (ym *Model) Train(ctx context.Context, data []feats.QueryEvaluation, slowQueriesTime float64, comment string) error {
+func (ym *Model) Train(ctx context.Context, data []feats.QueryEvaluation, thr threshold.Definition, comment string) error {
 	return nil
 }
 
@@ -58,8 +60,19 @@ func (ym *Model) GetClassThreshold() float64 {
 	return ym.ClassThreshold
 }
 
-func (ym *Model) GetSlowQueriesThresholdTime() float64 {
-	return ym.SlowQueriesThresholdTime
+func (ym *Model) GetThreshold() threshold.Definition {
+	return ym.Threshold
+}
+
+func (ym *Model) GetHyperparams() map[string]any {
+	return map[string]any{}
+}
+
+func (ym *Model) SetManifest(mf manifest.Manifest) {
+}
+
+func (ym *Model) GetManifest() manifest.Manifest {
+	return manifest.Manifest{}
 }
 
 func (ym *Model) SaveToFile(string) error {
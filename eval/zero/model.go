@@ -21,12 +21,14 @@ import (
 	"fmt"
 
 	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/czcorpus/cqlizer/eval/manifest"
 	"github.com/czcorpus/cqlizer/eval/predict"
+	"github.com/czcorpus/cqlizer/eval/threshold"
 )
 
 type ZeroModel struct {
-	SlowQueriesThresholdTime float64
-	ClassThreshold           float64
+	Threshold      threshold.Definition
+	ClassThreshold float64
 }
 
 func (zm *ZeroModel) IsInferenceOnly() bool {
@@ -37,7 +39,7 @@ func (zm *ZeroModel) CreateModelFileName(featsFile string) string {
 	return "zero-model"
 }
 
-func (zm *ZeroModel) Train(ctx context.Context, data []feats.QueryEvaluation, slowQueriesTime float64, comment string) error {
+func (zm *ZeroModel) Train(ctx context.Context, data []feats.QueryEvaluation, thr threshold.Definition, comment string) error {
 	return fmt.Errorf("cannot train zero model")
 }
 
@@ -53,8 +55,19 @@ func (zm *ZeroModel) GetClassThreshold() float64 {
 	return zm.ClassThreshold
 }
 
-func (zm *ZeroModel) GetSlowQueriesThresholdTime() float64 {
-	return zm.SlowQueriesThresholdTime
+func (zm *ZeroModel) GetThreshold() threshold.Definition {
+	return zm.Threshold
+}
+
+func (zm *ZeroModel) GetHyperparams() map[string]any {
+	return map[string]any{}
+}
+
+func (zm *ZeroModel) SetManifest(mf manifest.Manifest) {
+}
+
+func (zm *ZeroModel) GetManifest() manifest.Manifest {
+	return manifest.Manifest{}
 }
 
 func (zm *ZeroModel) SaveToFile(string) error {
@@ -32,11 +32,17 @@ func runActionFeaturize(
 	ctx context.Context,
 	conf *cnf.Conf,
 	srcPath, dstPath string,
+	dedupConf eval.DedupConf,
 	debug bool,
 ) {
+	dedupConf = dedupConf.WithDefaults()
+	if err := dedupConf.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid deduplication settings")
+		return
+	}
 	model := eval.NewPredictor(nil, conf)
 	dataimport.ReadStatsFile(ctx, srcPath, model)
-	model.Deduplicate()
+	model.Deduplicate(dedupConf)
 
 	if debug {
 		for i, v := range model.Evaluations {
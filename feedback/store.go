@@ -0,0 +1,150 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feedback
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/cqlizer/eval"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	maxRecordSize = 1024 * 1024
+)
+
+// Record is an actual processing time of a query previously
+// evaluated by CQLizer as reported by a client (typically KonText).
+type Record struct {
+	Time          time.Time `json:"time"`
+	Corpus        string    `json:"corpus,omitempty"`
+	CorpusSize    int64     `json:"corpusSize"`
+	SubcorpusSize int64     `json:"subcorpusSize,omitempty"`
+	Query         string    `json:"query"`
+	ProcTime      float64   `json:"procTime"`
+
+	// PredictedSlow is the decision CQLizer made (if known to the client)
+	PredictedSlow *bool `json:"predictedSlow,omitempty"`
+}
+
+func (rec Record) Validate() error {
+	if rec.Query == "" {
+		return fmt.Errorf("missing query")
+	}
+	if rec.ProcTime <= 0 {
+		return fmt.Errorf("invalid processing time %.2f", rec.ProcTime)
+	}
+	if rec.CorpusSize <= 0 {
+		return fmt.Errorf("invalid corpus size %d", rec.CorpusSize)
+	}
+	return nil
+}
+
+// AsStatsRecord converts feedback to a record compatible with
+// query logs so it can be processed the same way as learning data.
+// The query is stored in the KonText "q" format so the CQL is
+// extracted as is (see eval.QueryStatsRecord.GetCQL).
+func (rec Record) AsStatsRecord() eval.QueryStatsRecord {
+	return eval.QueryStatsRecord{
+		Corpus:        rec.Corpus,
+		CorpusSize:    rec.CorpusSize,
+		SubcorpusSize: rec.SubcorpusSize,
+		TimeProc:      rec.ProcTime,
+		Query:         "q" + rec.Query,
+	}
+}
+
+// ------------------------------
+
+// Store is an append-only store of feedback records
+// (one JSON record per line).
+type Store struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+}
+
+func (store *Store) Add(rec Record) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to store feedback: %w", err)
+	}
+	data = append(data, '\n')
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, err := store.file.Write(data); err != nil {
+		return fmt.Errorf("failed to store feedback: %w", err)
+	}
+	return nil
+}
+
+func (store *Store) Path() string {
+	return store.path
+}
+
+func (store *Store) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.file.Close()
+}
+
+// NewStore opens (or creates) a feedback store file for appending
+func NewStore(path string) (*Store, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open feedback store: %w", err)
+	}
+	return &Store{path: path, file: f}, nil
+}
+
+// ReadAll reads all the records from a feedback store file.
+// Malformed records are skipped (with a warning).
+func ReadAll(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feedback store: %w", err)
+	}
+	defer f.Close()
+	ans := make([]Record, 0, 1000)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	var lineNum int
+	for scanner.Scan() {
+		lineNum++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Warn().Err(err).Int("line", lineNum).Msg("skipping malformed feedback record")
+			continue
+		}
+		ans = append(ans, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read feedback store: %w", err)
+	}
+	return ans, nil
+}
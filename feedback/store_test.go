@@ -0,0 +1,69 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feedback
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreAppendsRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.jsonl")
+	store, err := NewStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Add(Record{Query: `[word="a"]`, CorpusSize: 1000, ProcTime: 1.5}))
+	assert.NoError(t, store.Close())
+
+	store, err = NewStore(path)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Add(Record{Query: `[word="b"]`, CorpusSize: 2000, ProcTime: 20}))
+	assert.NoError(t, store.Close())
+
+	records, err := ReadAll(path)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, `[word="a"]`, records[0].Query)
+	assert.Equal(t, 20.0, records[1].ProcTime)
+	assert.False(t, records[0].Time.IsZero())
+}
+
+func TestReadAllSkipsMalformedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.jsonl")
+	data := `{"query": "[word=\"a\"]", "corpusSize": 1000, "procTime": 1.5}
+{broken
+{"query": "[word=\"b\"]", "corpusSize": 1000, "procTime": 2.5}
+`
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+	records, err := ReadAll(path)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+}
+
+func TestRecordValidate(t *testing.T) {
+	assert.Error(t, Record{CorpusSize: 1000, ProcTime: 1}.Validate())
+	assert.Error(t, Record{Query: "[]", CorpusSize: 1000}.Validate())
+	assert.Error(t, Record{Query: "[]", ProcTime: 1}.Validate())
+	assert.NoError(t, Record{Query: "[]", CorpusSize: 1000, ProcTime: 1}.Validate())
+}
+
+func TestAsStatsRecordKeepsCQL(t *testing.T) {
+	rec := Record{Query: `[word="a{1,2}"]`, CorpusSize: 1000, ProcTime: 1}
+	assert.Equal(t, `[word="a{1,2}"]`, rec.AsStatsRecord().GetCQL())
+}
@@ -27,10 +27,13 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/czcorpus/cqlizer/apiserver"
 	"github.com/czcorpus/cqlizer/cnf"
 	"github.com/czcorpus/cqlizer/eval"
+	"github.com/czcorpus/cqlizer/eval/manifest"
 	"github.com/czcorpus/cqlizer/eval/nn"
 	"github.com/czcorpus/cqlizer/eval/rf"
+	"github.com/czcorpus/cqlizer/eval/threshold"
 	"github.com/czcorpus/cqlizer/eval/xg"
 	"github.com/rs/zerolog/log"
 	"github.com/schollz/progressbar/v3"
@@ -43,11 +46,26 @@ func runActionKlogImport(
 	modelType string,
 	numTrees int,
 	voteThreshold float64,
+	thresholdSpec string,
+	balanceConf eval.BalanceConf,
+	singleThreaded bool,
 	misclassLogPath string,
+	ver apiserver.VersionInfo,
 ) {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	thrDef, err := threshold.ParseSpec(thresholdSpec)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid slow query threshold specification")
+		return
+	}
+	balanceConf = balanceConf.WithDefaults()
+	if err := balanceConf.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid balancing settings")
+		return
+	}
+
 	/*
 		model := &eval.BasicModel{
 			SlowQueryPercentile: slowQueryPerc,
@@ -55,24 +73,14 @@ func runActionKlogImport(
 		dataimport.ReadStatsFile(ctx, srcPath, model)
 	*/
 
-	f, err := os.Open(srcPath)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to open features file")
-		return
-	}
-	defer f.Close()
-	data, err := io.ReadAll(f)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to open features file")
-		return
-	}
-
 	var mlModel eval.MLModel
 	switch modelType {
 	case "rf":
-		mlModel = rf.NewModel(numTrees, voteThreshold)
+		rfModel := rf.NewModel(numTrees, voteThreshold, balanceConf.Seed)
+		rfModel.SingleThreaded = singleThreaded
+		mlModel = rfModel
 	case "nn":
-		mlModel = nn.NewModel()
+		mlModel = nn.NewModel(balanceConf.Seed)
 	case "xg":
 		mlModel = xg.NewModel()
 	default:
@@ -80,22 +88,76 @@ func runActionKlogImport(
 		return
 	}
 
+	if err := trainAndSaveModel(
+		ctx, conf, srcPath, modelType, mlModel, thrDef, balanceConf, misclassLogPath, ver,
+	); err != nil {
+		fmt.Fprintf(os.Stderr, "RF training failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loadFeatures creates a predictor for `mlModel` with learning
+// data loaded from a features file
+func loadFeatures(conf *cnf.Conf, mlModel eval.MLModel, srcPath string) (*eval.Predictor, error) {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open features file: %w", err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open features file: %w", err)
+	}
 	model := eval.NewPredictor(mlModel, conf)
 	if err := msgpack.Unmarshal(data, &model); err != nil {
-		log.Fatal().Err(err).Msg("failed to open features file")
-		return
+		return nil, fmt.Errorf("failed to open features file: %w", err)
 	}
+	return model, nil
+}
 
-	allEvals := model.BalanceSample()
+// trainAndSaveModel trains `mlModel` using data from the `srcPath` features
+// file, evaluates it and saves it along with its training manifest.
+func trainAndSaveModel(
+	ctx context.Context,
+	conf *cnf.Conf,
+	srcPath string,
+	modelType string,
+	mlModel eval.MLModel,
+	thrDef threshold.Definition,
+	balanceConf eval.BalanceConf,
+	misclassLogPath string,
+	ver apiserver.VersionInfo,
+) error {
+	featsHash, err := manifest.FileSHA256(srcPath)
+	if err != nil {
+		return err
+	}
+	model, err := loadFeatures(conf, mlModel, srcPath)
+	if err != nil {
+		return err
+	}
+	if err := model.ResolveThreshold(thrDef); err != nil {
+		return fmt.Errorf("failed to determine slow query threshold: %w", err)
+	}
+	allEvals, err := model.BalanceSample(balanceConf)
+	if err != nil {
+		return fmt.Errorf("failed to create balanced sample: %w", err)
+	}
 	reporter := &eval.Reporter{
 		RFAccuracyScript:       rfChartScript,
 		MisclassQueriesOutPath: misclassLogPath,
 	}
 
-	if err := model.CreateAndTestModel(ctx, allEvals, srcPath, reporter); err != nil {
-		fmt.Fprintf(os.Stderr, "RF training failed: %v\n", err)
-		os.Exit(1)
+	mf := manifest.Manifest{
+		ModelType:      modelType,
+		FeaturesSHA256: featsHash,
+		Seed:           balanceConf.Seed,
+		Balancing:      fmt.Sprintf("%s (neg/pos ratio: %.2f)", balanceConf.Strategy, balanceConf.NegPosRatio),
+		Version:        ver.Version,
+		BuildDate:      ver.BuildDate,
+		GitCommit:      ver.GitCommit,
 	}
+	return model.CreateAndTestModel(ctx, allEvals, srcPath, mf, reporter)
 }
 
 func runActionEvaluate(
@@ -130,7 +192,10 @@ func runActionEvaluate(
 		log.Fatal().Err(err).Msg("failed to open features file")
 		return
 	}
-	predictor.FindAndSetDataMidpoint()
+	if err := predictor.UseModelThreshold(); err != nil {
+		log.Fatal().Err(err).Msg("failed to determine slow query threshold")
+		return
+	}
 
 	reporter := &eval.Reporter{
 		RFAccuracyScript:       rfChartScript,
@@ -166,3 +231,26 @@ func runActionEvaluate(
 	}
 	reporter.SaveMisclassifiedQueries()
 }
+
+func runActionModelInfo(modelType string, modelPath string) {
+	if modelType == "" {
+		modelType = eval.InferModelType(modelPath)
+	}
+	mlModel, err := eval.GetMLModel(modelType, modelPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load the ML model")
+		return
+	}
+	fmt.Println(mlModel.GetInfo())
+	mf := mlModel.GetManifest()
+	if mf.IsZero() {
+		fmt.Println("no training manifest found (the model was probably created by an older version)")
+		return
+	}
+	out, err := mf.JSON()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to show model manifest")
+		return
+	}
+	fmt.Println(out)
+}
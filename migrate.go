@@ -0,0 +1,49 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/cqlizer/cnf"
+	"github.com/czcorpus/cqlizer/monitoring"
+	"github.com/rs/zerolog/log"
+)
+
+func runActionMigrateMonitoring(conf *cnf.Conf, printOnly bool) {
+	if printOnly {
+		for _, stmt := range monitoring.SchemaStatements {
+			fmt.Printf("%s;\n\n", strings.TrimSpace(stmt))
+		}
+		return
+	}
+	if conf.Monitoring == nil {
+		log.Fatal().Msg("monitoring not configured, nothing to migrate")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := monitoring.Migrate(ctx, conf.Monitoring.DB); err != nil {
+		log.Error().Err(err).Send()
+		os.Exit(1)
+	}
+	log.Info().Str("host", conf.Monitoring.DB.Host).Msg("monitoring schema migrated")
+}
@@ -18,9 +18,106 @@
 
 package monitoring
 
-import "github.com/czcorpus/hltscl"
+import (
+	"fmt"
+
+	"github.com/czcorpus/hltscl"
+)
+
+const (
+	WriterTypeTimescaleDB = "timescaledb"
+	WriterTypeJSONL       = "jsonl"
+	WriterTypeStdout      = "stdout"
+)
+
+// WriterConf configures a single status writer backend
+type WriterConf struct {
+
+	// Type is one of "timescaledb", "jsonl", "stdout"
+	Type string `json:"type"`
+
+	// Path is a JSONL file path (jsonl type only)
+	Path string `json:"path"`
+
+	// MaxFileSizeMB, MaxFiles and MaxAgeDays control rotation
+	// of the JSONL file (zero values mean lumberjack defaults)
+	MaxFileSizeMB int `json:"maxFileSizeMb"`
+	MaxFiles      int `json:"maxFiles"`
+	MaxAgeDays    int `json:"maxAgeDays"`
+}
+
+func (wc WriterConf) Validate() error {
+	switch wc.Type {
+	case WriterTypeTimescaleDB, WriterTypeStdout:
+		return nil
+	case WriterTypeJSONL:
+		if wc.Path == "" {
+			return fmt.Errorf("missing path for the jsonl status writer")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown status writer type %s", wc.Type)
+	}
+}
+
+const (
+	dfltQueueSize        = 10000
+	dfltBatchSize        = 100
+	dfltFlushIntervalMs  = 1000
+	dfltWriteTimeoutSecs = 20
+)
+
+// QueueConf configures asynchronous writing to TimescaleDB
+type QueueConf struct {
+
+	// Size is the maximum number of reports waiting to be written
+	Size int `json:"size"`
+
+	// BatchSize is the maximum number of reports written at once
+	BatchSize int `json:"batchSize"`
+
+	// FlushIntervalMs is the maximum time a report waits for a batch
+	FlushIntervalMs int `json:"flushIntervalMs"`
+
+	WriteTimeoutSecs int `json:"writeTimeoutSecs"`
+
+	// SpillPath is a JSONL file where reports are written in case
+	// the queue is full or the database is failing. If empty,
+	// such reports are dropped.
+	SpillPath string `json:"spillPath"`
+}
+
+func (qc QueueConf) WithDefaults() QueueConf {
+	if qc.Size <= 0 {
+		qc.Size = dfltQueueSize
+	}
+	if qc.BatchSize <= 0 {
+		qc.BatchSize = dfltBatchSize
+	}
+	if qc.FlushIntervalMs <= 0 {
+		qc.FlushIntervalMs = dfltFlushIntervalMs
+	}
+	if qc.WriteTimeoutSecs <= 0 {
+		qc.WriteTimeoutSecs = dfltWriteTimeoutSecs
+	}
+	return qc
+}
 
 type Conf struct {
 	TimeZone string        `json:"timeZone"`
 	DB       hltscl.PgConf `json:"db"`
+	Queue    QueueConf     `json:"queue"`
+
+	// Writers specifies status writer backends. If empty,
+	// only the TimescaleDB writer (configured via DB) is used
+	// for backward compatibility.
+	Writers []WriterConf `json:"writers"`
+}
+
+// WriterConfs returns configured writers including the implicit TimescaleDB one
+func (conf *Conf) WriterConfs() []WriterConf {
+	if len(conf.Writers) == 0 {
+		return []WriterConf{{Type: WriterTypeTimescaleDB}}
+	}
+	return conf.Writers
 }
@@ -0,0 +1,328 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "cqlizer"
+	unmatchedRoute   = "unmatched"
+	noCorpusLabel    = "-"
+)
+
+// Metrics collects API server telemetry in the Prometheus format.
+// All the methods can be called on a nil instance (in such case
+// they do nothing) so metrics can be easily disabled.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	parseErrors     prometheus.Counter
+	decisions       *prometheus.CounterVec
+	modelVotes      *prometheus.HistogramVec
+	llmDuration     *prometheus.HistogramVec
+	modelInfo       *prometheus.GaugeVec
+}
+
+// GinMiddleware counts requests and measures their latency per route.
+// Route patterns (e.g. /cql/:corpusId) are used instead of actual paths
+// to keep the number of time series low.
+func (m *Metrics) GinMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if m == nil {
+			ctx.Next()
+			return
+		}
+		t0 := time.Now()
+		ctx.Next()
+		route := ctx.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		m.requests.WithLabelValues(
+			route, ctx.Request.Method, strconv.Itoa(ctx.Writer.Status()),
+		).Inc()
+		m.requestDuration.WithLabelValues(
+			route, ctx.Request.Method,
+		).Observe(time.Since(t0).Seconds())
+	}
+}
+
+// Handler returns an HTTP handler exposing the metrics
+// in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveParseError records a query which could not be parsed
+func (m *Metrics) ObserveParseError() {
+	if m == nil {
+		return
+	}
+	m.parseErrors.Inc()
+}
+
+// ObserveDecision records a final slow/fast decision of the ensemble
+func (m *Metrics) ObserveDecision(corpus string, isSlow bool) {
+	if m == nil {
+		return
+	}
+	if corpus == "" {
+		corpus = noCorpusLabel
+	}
+	decision := "fast"
+	if isSlow {
+		decision = "slow"
+	}
+	m.decisions.WithLabelValues(corpus, decision).Inc()
+}
+
+// ObserveModelVote records a "slow query" vote (probability)
+// of a single model
+func (m *Metrics) ObserveModelVote(modelPath string, vote float64) {
+	if m == nil {
+		return
+	}
+	m.modelVotes.WithLabelValues(filepath.Base(modelPath)).Observe(vote)
+}
+
+// ObserveLLMTranslation records latency of a NL -> CQL translation
+func (m *Metrics) ObserveLLMTranslation(dur time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	m.llmDuration.WithLabelValues(status).Observe(dur.Seconds())
+}
+
+// SetModelInfo records a loaded model. The value of the gauge
+// is the time (UNIX timestamp) the model has been loaded.
+func (m *Metrics) SetModelInfo(modelPath, modelType string, shadow bool, loadedAt time.Time) {
+	if m == nil {
+		return
+	}
+	role := "live"
+	if shadow {
+		role = "shadow"
+	}
+	m.modelInfo.WithLabelValues(
+		filepath.Base(modelPath), modelType, role,
+	).Set(float64(loadedAt.Unix()))
+}
+
+// QueueStats provides state of an asynchronous status writer
+type QueueStats interface {
+	QueueDepth() int
+	QueueCapacity() int
+	NumDropped() int64
+	NumSpilled() int64
+	NumWritten() int64
+	NumFailed() int64
+}
+
+// RegisterStatusQueue exposes state of an asynchronous status writer
+func (m *Metrics) RegisterStatusQueue(writer string, stats QueueStats) {
+	if m == nil {
+		return
+	}
+	labels := prometheus.Labels{"writer": writer}
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace:   metricsNamespace,
+				Name:        "status_queue_depth",
+				Help:        "Number of vote reports waiting to be written",
+				ConstLabels: labels,
+			},
+			func() float64 { return float64(stats.QueueDepth()) },
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace:   metricsNamespace,
+				Name:        "status_queue_capacity",
+				Help:        "Maximum number of vote reports waiting to be written",
+				ConstLabels: labels,
+			},
+			func() float64 { return float64(stats.QueueCapacity()) },
+		),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace:   metricsNamespace,
+				Name:        "status_reports_dropped_total",
+				Help:        "Number of vote reports dropped due to a full queue",
+				ConstLabels: labels,
+			},
+			func() float64 { return float64(stats.NumDropped()) },
+		),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace:   metricsNamespace,
+				Name:        "status_reports_spilled_total",
+				Help:        "Number of vote reports spilled to disk",
+				ConstLabels: labels,
+			},
+			func() float64 { return float64(stats.NumSpilled()) },
+		),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace:   metricsNamespace,
+				Name:        "status_reports_written_total",
+				Help:        "Number of vote reports written",
+				ConstLabels: labels,
+			},
+			func() float64 { return float64(stats.NumWritten()) },
+		),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace:   metricsNamespace,
+				Name:        "status_reports_failed_total",
+				Help:        "Number of vote reports which failed to be written",
+				ConstLabels: labels,
+			},
+			func() float64 { return float64(stats.NumFailed()) },
+		),
+	)
+}
+
+// CacheStats provides hit/miss counts of a cache
+type CacheStats interface {
+	NumHits() int64
+	NumMisses() int64
+	Len() int
+}
+
+// RegisterEvalCache exposes state of the query evaluation cache
+func (m *Metrics) RegisterEvalCache(stats CacheStats) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "eval_cache_hits_total",
+				Help:      "Number of query evaluations served from the cache",
+			},
+			func() float64 { return float64(stats.NumHits()) },
+		),
+		prometheus.NewCounterFunc(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "eval_cache_misses_total",
+				Help:      "Number of query evaluations not found in the cache",
+			},
+			func() float64 { return float64(stats.NumMisses()) },
+		),
+		prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "eval_cache_size",
+				Help:      "Number of cached query evaluations",
+			},
+			func() float64 { return float64(stats.Len()) },
+		),
+	)
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "http_requests_total",
+				Help:      "Number of processed HTTP requests",
+			},
+			[]string{"route", "method", "status"},
+		),
+		requestDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: metricsNamespace,
+				Name:      "http_request_duration_seconds",
+				Help:      "Latency of HTTP requests",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{"route", "method"},
+		),
+		parseErrors: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "query_parse_errors_total",
+				Help:      "Number of queries which could not be parsed",
+			},
+		),
+		decisions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: metricsNamespace,
+				Name:      "decisions_total",
+				Help:      "Number of slow/fast decisions of the model ensemble",
+			},
+			[]string{"corpus", "decision"},
+		),
+		modelVotes: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: metricsNamespace,
+				Name:      "model_slow_vote",
+				Help:      "Distribution of \"slow query\" votes of individual models",
+				Buckets:   prometheus.LinearBuckets(0.1, 0.1, 10),
+			},
+			[]string{"model"},
+		),
+		llmDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: metricsNamespace,
+				Name:      "llm_translation_duration_seconds",
+				Help:      "Latency of natural language to CQL translations",
+				Buckets:   []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120},
+			},
+			[]string{"status"},
+		),
+		modelInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "model_loaded_timestamp_seconds",
+				Help:      "Loaded models along with the time they have been loaded",
+			},
+			[]string{"model", "type", "role"},
+		),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.parseErrors,
+		m.decisions,
+		m.modelVotes,
+		m.llmDuration,
+		m.modelInfo,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
@@ -0,0 +1,57 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNilMetricsIsNoop(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.ObserveParseError()
+		m.ObserveDecision("syn2020", true)
+		m.ObserveModelVote("model.rf.json", 0.7)
+		m.ObserveLLMTranslation(time.Second, nil)
+		m.SetModelInfo("model.rf.json", "rf", false, time.Now())
+	})
+}
+
+func TestMetricsExposition(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveParseError()
+	m.ObserveDecision("syn2020", true)
+	m.ObserveDecision("", false)
+	m.ObserveModelVote("/models/model.rf.json", 0.7)
+	m.SetModelInfo("/models/model.rf.json", "rf", true, time.Unix(1700000000, 0))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	assert.NoError(t, err)
+	out := string(body)
+	assert.Contains(t, out, "cqlizer_query_parse_errors_total 1")
+	assert.Contains(t, out, `cqlizer_decisions_total{corpus="syn2020",decision="slow"} 1`)
+	assert.Contains(t, out, `cqlizer_decisions_total{corpus="-",decision="fast"} 1`)
+	assert.Contains(t, out, `cqlizer_model_slow_vote_count{model="model.rf.json"} 1`)
+	assert.Contains(t, out, `cqlizer_model_loaded_timestamp_seconds{model="model.rf.json",role="shadow",type="rf"} 1.7e+09`)
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/czcorpus/hltscl"
+	"github.com/jackc/pgx/v5"
+)
+
+// SchemaStatements contains DDL statements creating (or updating) tables
+// required by TimescaleDBWriter. All the statements are idempotent so they
+// can be applied to an existing database (e.g. one created by an older
+// version with fewer columns).
+var SchemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS ` + evaluationsTable + ` (
+  "time" timestamp with time zone NOT NULL,
+  votes_for int,
+  votes_against int,
+  avg_certainty float,
+  corpus text,
+  num_errors int
+)`,
+	`SELECT create_hypertable('` + evaluationsTable + `', 'time', if_not_exists => TRUE)`,
+	`ALTER TABLE ` + evaluationsTable + ` ADD COLUMN IF NOT EXISTS latency_ms float`,
+	`ALTER TABLE ` + evaluationsTable + ` ADD COLUMN IF NOT EXISTS query_hash text`,
+
+	`CREATE TABLE IF NOT EXISTS ` + modelVotesTable + ` (
+  "time" timestamp with time zone NOT NULL,
+  query_hash text,
+  corpus text,
+  model text NOT NULL,
+  is_shadow boolean NOT NULL DEFAULT FALSE,
+  slow_vote float,
+  result int,
+  corpus_size bigint,
+  num_positions int,
+  has_wildcards boolean,
+  starts_with_wildcard boolean,
+  has_range boolean,
+  has_negation boolean,
+  has_structures boolean
+)`,
+	`SELECT create_hypertable('` + modelVotesTable + `', 'time', if_not_exists => TRUE)`,
+	`CREATE INDEX IF NOT EXISTS ` + modelVotesTable + `_model_idx ON ` + modelVotesTable + ` (model, "time" DESC)`,
+}
+
+// Migrate creates or updates the monitoring schema
+// (in a single transaction)
+func Migrate(ctx context.Context, conf hltscl.PgConf) error {
+	conn, err := pgx.Connect(ctx, conf.CreateConnString())
+	if err != nil {
+		return fmt.Errorf("failed to migrate monitoring schema: %w", err)
+	}
+	defer conn.Close(ctx)
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to migrate monitoring schema: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	for _, stmt := range SchemaStatements {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to migrate monitoring schema: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to migrate monitoring schema: %w", err)
+	}
+	return nil
+}
@@ -20,33 +20,87 @@ package monitoring
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/czcorpus/cqlizer/eval/feats"
 	"github.com/czcorpus/hltscl"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/zerolog/log"
 )
 
-/*
-Expected tables:
+const (
+	evaluationsTable = "cqlizer_queries_evaluations"
+	modelVotesTable  = "cqlizer_model_votes"
 
-create table cqlizer_queries_evaluations (
-  "time" timestamp with time zone NOT NULL,
-  votes_for int,
-  votes_against int,
-  avg_certainty float,
-  corpus text,
-  num_errors int
-);
-select create_hypertable('cqlizer_queries_evaluations', 'time');
+	// dropLogInterval specifies how often (in number of dropped
+	// reports) a warning about a full queue is logged
+	dropLogInterval = 1000
+)
 
-*/
+// The expected database schema is defined in schema.go (see Migrate)
 
 type VoteReport struct {
-	VotesFor     int
-	VotesAgainst int
-	AvgCertainty float64
-	Corpus       string
-	IsError      bool
+	VotesFor     int     `json:"votesFor"`
+	VotesAgainst int     `json:"votesAgainst"`
+	AvgCertainty float64 `json:"avgCertainty"`
+	Corpus       string  `json:"corpus,omitempty"`
+	IsError      bool    `json:"isError"`
+
+	// QueryHash is a hex encoded SHA-256 hash of the evaluated query
+	QueryHash string `json:"queryHash,omitempty"`
+
+	// LatencyMs is the time spent on the query evaluation
+	LatencyMs float64 `json:"latencyMs"`
+
+	// ModelVersions identify models of the live ensemble
+	ModelVersions []string `json:"modelVersions,omitempty"`
+
+	// ModelVotes contains votes of individual models (including shadow ones)
+	ModelVotes []ModelVote `json:"modelVotes,omitempty"`
+
+	// Features is nil in case the query could not be evaluated
+	Features *QueryFeatures `json:"features,omitempty"`
+}
+
+// ModelVote is a vote of a single model of the ensemble
+type ModelVote struct {
+	Model    string  `json:"model"`
+	SlowVote float64 `json:"slowVote"`
+	Result   int     `json:"result"`
+	IsShadow bool    `json:"isShadow,omitempty"`
+}
+
+// QueryFeatures is a compact summary of an evaluated query
+// allowing for analysis of queries triggering slow verdicts
+type QueryFeatures struct {
+	NumPositions       int   `json:"numPositions"`
+	HasWildcards       bool  `json:"hasWildcards"`
+	StartsWithWildcard bool  `json:"startsWithWildcard"`
+	HasRange           bool  `json:"hasRange"`
+	HasNegation        bool  `json:"hasNegation"`
+	HasStructures      bool  `json:"hasStructures"`
+	CorpusSize         int64 `json:"corpusSize"`
+}
+
+// NewQueryFeatures summarizes an evaluated query. The corpusSize must be
+// the actual number of tokens as the QueryEvaluation contains a log-scaled value.
+func NewQueryFeatures(qe feats.QueryEvaluation, corpusSize int) *QueryFeatures {
+	ans := &QueryFeatures{
+		NumPositions:  len(qe.Positions),
+		HasStructures: qe.ContainsWithin > 0 || qe.ContainsContaining > 0,
+		CorpusSize:    int64(corpusSize),
+	}
+	for _, pos := range qe.Positions {
+		ans.HasWildcards = ans.HasWildcards || pos.Regexp.WildcardScore > 0
+		ans.StartsWithWildcard = ans.StartsWithWildcard || pos.Regexp.StartsWithWildCard > 0
+		ans.HasRange = ans.HasRange || pos.Regexp.HasRange > 0
+		ans.HasNegation = ans.HasNegation || pos.HasNegation > 0
+	}
+	return ans
 }
 
 // ------------
@@ -63,72 +117,239 @@ func (n *NullStatusWriter) Write(rec VoteReport) {}
 
 // -------------
 
+// TimescaleDBWriter writes vote reports to TimescaleDB asynchronously.
+// Reports are put into a bounded queue and written in batches by a background
+// goroutine (see Start) so request processing never waits for the database.
+// If the queue is full, reports are spilled to a JSONL file (if configured)
+// or dropped.
 type TimescaleDBWriter struct {
-	tableWriter *hltscl.TableWriter
-	opsDataCh   chan<- hltscl.Entry
-	errCh       <-chan hltscl.WriteError
-	location    *time.Location
+	conn          *pgxpool.Pool
+	tableWriter   *hltscl.TableWriter
+	queue         chan jsonRecord
+	batchSize     int
+	flushInterval time.Duration
+	writeTimeout  time.Duration
+	location      *time.Location
+
+	// spill is nil if spilling is not configured
+	spill *JSONLWriter
+
+	// sendBatch is replaceable for testing purposes
+	sendBatch func(ctx context.Context, items []jsonRecord) error
+
+	numDropped atomic.Int64
+	numSpilled atomic.Int64
+	numWritten atomic.Int64
+	numFailed  atomic.Int64
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	done     chan struct{}
+}
+
+func (sw *TimescaleDBWriter) QueueDepth() int {
+	return len(sw.queue)
+}
+
+func (sw *TimescaleDBWriter) QueueCapacity() int {
+	return cap(sw.queue)
+}
+
+func (sw *TimescaleDBWriter) NumDropped() int64 {
+	return sw.numDropped.Load()
+}
+
+func (sw *TimescaleDBWriter) NumSpilled() int64 {
+	return sw.numSpilled.Load()
+}
+
+func (sw *TimescaleDBWriter) NumWritten() int64 {
+	return sw.numWritten.Load()
 }
 
-func (sw *TimescaleDBWriter) Start(ctx context.Context) {
+func (sw *TimescaleDBWriter) NumFailed() int64 {
+	return sw.numFailed.Load()
+}
+
+func (sw *TimescaleDBWriter) flush(items []jsonRecord) {
+	if len(items) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sw.writeTimeout)
+	defer cancel()
+	if err := sw.sendBatch(ctx, items); err != nil {
+		sw.numFailed.Add(int64(len(items)))
+		log.Error().
+			Err(err).
+			Int("batchSize", len(items)).
+			Str("table", evaluationsTable).
+			Msg("error writing data to TimescaleDB")
+		if sw.spill != nil {
+			for _, item := range items {
+				sw.spill.writeRecord(item)
+			}
+			sw.numSpilled.Add(int64(len(items)))
+		}
+		return
+	}
+	sw.numWritten.Add(int64(len(items)))
+}
+
+// Start runs the background goroutine writing queued reports.
+// The goroutine ends only once Stop (or Close) is called - i.e. after
+// the HTTP server has finished the running requests - and it flushes
+// the remaining reports before returning.
+func (sw *TimescaleDBWriter) Start() {
 	go func() {
+		defer close(sw.done)
+		ticker := time.NewTicker(sw.flushInterval)
+		defer ticker.Stop()
+		batch := make([]jsonRecord, 0, sw.batchSize)
 		for {
 			select {
-			case <-ctx.Done():
-				log.Info().Msg("about to close StatusWriter")
+			case item := <-sw.queue:
+				batch = append(batch, item)
+				if len(batch) >= sw.batchSize {
+					sw.flush(batch)
+					batch = batch[:0]
+				}
+			case <-ticker.C:
+				sw.flush(batch)
+				batch = batch[:0]
+			case <-sw.stopCh:
+				sw.drain(batch)
 				return
-			case err := <-sw.errCh:
-				log.Error().
-					Err(err.Err).
-					Str("entry", err.Entry.String()).
-					Str("table", "cqlizer_queries_evaluations").
-					Msg("error writing data to TimescaleDB")
 			}
 		}
 	}()
 }
 
+func (sw *TimescaleDBWriter) drain(batch []jsonRecord) {
+	log.Info().Int("remaining", len(batch)+len(sw.queue)).Msg("about to close StatusWriter")
+	for {
+		select {
+		case item := <-sw.queue:
+			batch = append(batch, item)
+			if len(batch) >= sw.batchSize {
+				sw.flush(batch)
+				batch = batch[:0]
+			}
+		default:
+			sw.flush(batch)
+			return
+		}
+	}
+}
+
+// Stop waits for the background goroutine to write remaining reports
 func (sw *TimescaleDBWriter) Stop(ctx context.Context) error {
 	log.Warn().Msg("stopping StatusWriter")
+	sw.stopOnce.Do(func() { close(sw.stopCh) })
+	select {
+	case <-sw.done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop TimescaleDB writer: %w", ctx.Err())
+	}
+	if sw.spill != nil {
+		return sw.spill.Close()
+	}
 	return nil
 }
 
+func (sw *TimescaleDBWriter) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), sw.writeTimeout)
+	defer cancel()
+	return sw.Stop(ctx)
+}
+
+// Write enqueues a report without blocking
 func (sw *TimescaleDBWriter) Write(item VoteReport) {
-	if sw.tableWriter != nil {
+	rec := jsonRecord{Time: time.Now().In(sw.location), VoteReport: item}
+	select {
+	case sw.queue <- rec:
+	default:
+		if sw.spill != nil {
+			sw.spill.writeRecord(rec)
+			sw.numSpilled.Add(1)
+			return
+		}
+		if sw.numDropped.Add(1)%dropLogInterval == 1 {
+			log.Warn().
+				Int64("numDropped", sw.numDropped.Load()).
+				Msg("monitoring queue full, dropping vote reports")
+		}
+	}
+}
+
+func (sw *TimescaleDBWriter) pgSendBatch(ctx context.Context, items []jsonRecord) error {
+	batch := &pgx.Batch{}
+	for _, item := range items {
 		var numErr int
 		if item.IsError {
 			numErr = 1
 		}
-		sw.opsDataCh <- *sw.tableWriter.NewEntry(time.Now().In(sw.location)).
+		sql, args := sw.tableWriter.NewEntry(item.Time).
 			Int("votes_for", item.VotesFor).
 			Int("votes_against", item.VotesAgainst).
 			Float("avg_certainty", item.AvgCertainty).
 			Int("num_errors", numErr).
-			Str("corpus", item.Corpus)
+			Str("corpus", item.Corpus).
+			Float("latency_ms", item.LatencyMs).
+			Str("query_hash", item.QueryHash).
+			ExportForSQL(evaluationsTable, "time")
+		batch.Queue(sql, args...)
+		for _, mv := range item.ModelVotes {
+			entry := sw.tableWriter.NewEntry(item.Time).
+				Str("query_hash", item.QueryHash).
+				Str("corpus", item.Corpus).
+				Str("model", mv.Model).
+				Bool("is_shadow", mv.IsShadow).
+				Float("slow_vote", mv.SlowVote).
+				Int("result", mv.Result)
+			if item.Features != nil {
+				entry.
+					Int("corpus_size", int(item.Features.CorpusSize)).
+					Int("num_positions", item.Features.NumPositions).
+					Bool("has_wildcards", item.Features.HasWildcards).
+					Bool("starts_with_wildcard", item.Features.StartsWithWildcard).
+					Bool("has_range", item.Features.HasRange).
+					Bool("has_negation", item.Features.HasNegation).
+					Bool("has_structures", item.Features.HasStructures)
+			}
+			sql, args := entry.ExportForSQL(modelVotesTable, "time")
+			batch.Queue(sql, args...)
+		}
 	}
+	return sw.conn.SendBatch(ctx, batch).Close()
 }
 
-func NewTimescaleDBWriter(
-	ctx context.Context,
-	conf hltscl.PgConf,
-	tz *time.Location,
-	onError func(err error),
-) (*TimescaleDBWriter, error) {
+func newTimescaleDBWriter(conf *Conf, tz *time.Location) *TimescaleDBWriter {
+	aconf := conf.Queue.WithDefaults()
+	sw := &TimescaleDBWriter{
+		queue:         make(chan jsonRecord, aconf.Size),
+		batchSize:     aconf.BatchSize,
+		flushInterval: time.Duration(aconf.FlushIntervalMs) * time.Millisecond,
+		writeTimeout:  time.Duration(aconf.WriteTimeoutSecs) * time.Second,
+		location:      tz,
+		stopCh:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if aconf.SpillPath != "" {
+		sw.spill = NewJSONLFileWriter(WriterConf{Type: WriterTypeJSONL, Path: aconf.SpillPath}, tz)
+	}
+	return sw
+}
 
-	conn, err := hltscl.CreatePool(conf)
+// NewTimescaleDBWriter creates a writer. Start must be called
+// to actually write the data.
+func NewTimescaleDBWriter(conf *Conf, tz *time.Location) (*TimescaleDBWriter, error) {
+	conn, err := hltscl.CreatePool(conf.DB)
 	if err != nil {
 		return nil, err
 	}
-	twriter := hltscl.NewTableWriter(conn, "cqlizer_queries_evaluations", "time", tz)
-	opsDataCh, errCh := twriter.Activate(
-		ctx,
-		hltscl.WithTimeout(20*time.Second),
-	)
-
-	return &TimescaleDBWriter{
-		tableWriter: twriter,
-		opsDataCh:   opsDataCh,
-		errCh:       errCh,
-		location:    tz,
-	}, nil
+	sw := newTimescaleDBWriter(conf, tz)
+	sw.conn = conn
+	sw.tableWriter = hltscl.NewTableWriter(conn, evaluationsTable, "time", tz)
+	sw.sendBatch = sw.pgSendBatch
+	return sw, nil
 }
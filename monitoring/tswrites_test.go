@@ -0,0 +1,143 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBatchSender struct {
+	mu      sync.Mutex
+	batches [][]jsonRecord
+	block   chan struct{}
+	err     error
+}
+
+func (fs *fakeBatchSender) send(ctx context.Context, items []jsonRecord) error {
+	if fs.block != nil {
+		<-fs.block
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.batches = append(fs.batches, append([]jsonRecord{}, items...))
+	return fs.err
+}
+
+func (fs *fakeBatchSender) numItems() int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var ans int
+	for _, b := range fs.batches {
+		ans += len(b)
+	}
+	return ans
+}
+
+func TestTimescaleDBWriterBatchesAndFlushesOnStop(t *testing.T) {
+	sender := &fakeBatchSender{}
+	sw := newTimescaleDBWriter(&Conf{Queue: QueueConf{BatchSize: 3, FlushIntervalMs: 60000}}, time.UTC)
+	sw.sendBatch = sender.send
+	sw.Start()
+	for range 7 {
+		sw.Write(VoteReport{VotesFor: 1})
+	}
+	assert.NoError(t, sw.Close())
+	assert.Equal(t, 7, sender.numItems())
+	assert.Equal(t, int64(7), sw.NumWritten())
+	for _, b := range sender.batches {
+		assert.LessOrEqual(t, len(b), 3)
+	}
+}
+
+func TestTimescaleDBWriterKeepsReportsUntilClosed(t *testing.T) {
+	sender := &fakeBatchSender{}
+	sw := newTimescaleDBWriter(&Conf{Queue: QueueConf{BatchSize: 10, FlushIntervalMs: 60000}}, time.UTC)
+	sw.sendBatch = sender.send
+	sw.Start()
+	// reports of requests still running during shutdown must be kept
+	// until the writer is explicitly closed
+	sw.Write(VoteReport{VotesFor: 1})
+	sw.Write(VoteReport{VotesFor: 1})
+	assert.NoError(t, sw.Close())
+	assert.Equal(t, 2, sender.numItems())
+}
+
+func TestTimescaleDBWriterDropsWhenFull(t *testing.T) {
+	sender := &fakeBatchSender{block: make(chan struct{})}
+	sw := newTimescaleDBWriter(&Conf{Queue: QueueConf{Size: 2, BatchSize: 1}}, time.UTC)
+	sw.sendBatch = sender.send
+	// writing without a running consumer must not block
+	for range 5 {
+		sw.Write(VoteReport{})
+	}
+	assert.Equal(t, 2, sw.QueueDepth())
+	assert.Equal(t, int64(3), sw.NumDropped())
+	close(sender.block)
+}
+
+func TestTimescaleDBWriterSpillsWhenFull(t *testing.T) {
+	spillPath := filepath.Join(t.TempDir(), "spill.jsonl")
+	sw := newTimescaleDBWriter(&Conf{Queue: QueueConf{Size: 1, SpillPath: spillPath}}, time.UTC)
+	sw.sendBatch = (&fakeBatchSender{}).send
+	sw.Write(VoteReport{})
+	sw.Write(VoteReport{})
+	assert.Equal(t, int64(0), sw.NumDropped())
+	assert.Equal(t, int64(1), sw.NumSpilled())
+	assert.NoError(t, sw.spill.Close())
+	assert.FileExists(t, spillPath)
+}
+
+func TestTimescaleDBWriterCountsFailures(t *testing.T) {
+	sender := &fakeBatchSender{err: fmt.Errorf("db unavailable")}
+	sw := newTimescaleDBWriter(&Conf{Queue: QueueConf{BatchSize: 2}}, time.UTC)
+	sw.sendBatch = sender.send
+	sw.Start()
+	sw.Write(VoteReport{})
+	sw.Write(VoteReport{})
+	assert.NoError(t, sw.Close())
+	assert.Equal(t, int64(2), sw.NumFailed())
+	assert.Equal(t, int64(0), sw.NumWritten())
+}
+
+func TestNewQueryFeatures(t *testing.T) {
+	qe, err := feats.NewQueryEvaluation(
+		`[word=".*ing"] [lemma!="be"] within <doc />`, 1e9, 0, 0, feats.GetCharProbabilityProvider("en"))
+	require.NoError(t, err)
+	qf := NewQueryFeatures(qe, 1e9)
+	assert.Equal(t, 2, qf.NumPositions)
+	assert.True(t, qf.HasWildcards)
+	assert.True(t, qf.StartsWithWildcard)
+	assert.True(t, qf.HasNegation)
+	assert.True(t, qf.HasStructures)
+	assert.False(t, qf.HasRange)
+	assert.Equal(t, int64(1e9), qf.CorpusSize)
+}
+
+func TestSchemaStatementsAreIdempotent(t *testing.T) {
+	for _, stmt := range SchemaStatements {
+		assert.Regexp(t, `IF NOT EXISTS|if_not_exists => TRUE`, stmt)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/natefinch/lumberjack"
+	"github.com/rs/zerolog/log"
+)
+
+type jsonRecord struct {
+	Time time.Time `json:"time"`
+	VoteReport
+}
+
+// JSONLWriter writes vote reports as JSON lines. It is used
+// both for (rotated) files and for the standard output.
+type JSONLWriter struct {
+	w        io.Writer
+	location *time.Location
+	mu       sync.Mutex
+}
+
+func (sw *JSONLWriter) Write(item VoteReport) {
+	sw.writeRecord(jsonRecord{Time: time.Now().In(sw.location), VoteReport: item})
+}
+
+func (sw *JSONLWriter) writeRecord(rec jsonRecord) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to serialize vote report")
+		return
+	}
+	data = append(data, '\n')
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if _, err := sw.w.Write(data); err != nil {
+		log.Error().Err(err).Msg("failed to write vote report")
+	}
+}
+
+// Close closes the underlying file (if any)
+func (sw *JSONLWriter) Close() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if c, ok := sw.w.(io.Closer); ok && sw.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
+
+// NewJSONLFileWriter creates a writer producing a JSONL file
+// which is rotated based on its size
+func NewJSONLFileWriter(conf WriterConf, tz *time.Location) *JSONLWriter {
+	return &JSONLWriter{
+		w: &lumberjack.Logger{
+			Filename:   conf.Path,
+			MaxSize:    conf.MaxFileSizeMB,
+			MaxBackups: conf.MaxFiles,
+			MaxAge:     conf.MaxAgeDays,
+		},
+		location: tz,
+	}
+}
+
+func NewStdoutWriter(tz *time.Location) *JSONLWriter {
+	return &JSONLWriter{w: os.Stdout, location: tz}
+}
+
+// -------------
+
+// MultiWriter passes vote reports to all the contained writers
+type MultiWriter struct {
+	writers []StatusWriter
+}
+
+func (mw *MultiWriter) Write(item VoteReport) {
+	for _, w := range mw.writers {
+		w.Write(item)
+	}
+}
+
+// Close closes all the contained writers which can be closed
+func (mw *MultiWriter) Close() error {
+	var errs []error
+	for _, w := range mw.writers {
+		if c, ok := w.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func NewMultiWriter(writers ...StatusWriter) *MultiWriter {
+	return &MultiWriter{writers: writers}
+}
@@ -0,0 +1,73 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingWriter struct {
+	items []VoteReport
+}
+
+func (rw *recordingWriter) Write(item VoteReport) {
+	rw.items = append(rw.items, item)
+}
+
+func TestJSONLWriterWritesLines(t *testing.T) {
+	var buf bytes.Buffer
+	w := &JSONLWriter{w: &buf, location: time.UTC}
+	w.Write(VoteReport{VotesFor: 2, VotesAgainst: 1, QueryHash: "abc", LatencyMs: 1.5, ModelVersions: []string{"m1"}})
+	w.Write(VoteReport{IsError: true})
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	assert.Len(t, lines, 2)
+	var rec map[string]any
+	assert.NoError(t, json.Unmarshal(lines[0], &rec))
+	assert.Equal(t, float64(2), rec["votesFor"])
+	assert.Equal(t, "abc", rec["queryHash"])
+	assert.Equal(t, 1.5, rec["latencyMs"])
+	assert.Contains(t, rec, "time")
+}
+
+func TestJSONLFileWriterCreatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "votes.jsonl")
+	w := NewJSONLFileWriter(WriterConf{Type: WriterTypeJSONL, Path: path}, time.UTC)
+	w.Write(VoteReport{VotesFor: 1})
+	assert.NoError(t, w.Close())
+	assert.FileExists(t, path)
+}
+
+func TestMultiWriterFansOut(t *testing.T) {
+	w1, w2 := &recordingWriter{}, &recordingWriter{}
+	mw := NewMultiWriter(w1, w2)
+	mw.Write(VoteReport{Corpus: "syn2020"})
+	assert.Len(t, w1.items, 1)
+	assert.Len(t, w2.items, 1)
+	assert.NoError(t, mw.Close())
+}
+
+func TestWriterConfValidate(t *testing.T) {
+	assert.NoError(t, WriterConf{Type: WriterTypeStdout}.Validate())
+	assert.Error(t, WriterConf{Type: WriterTypeJSONL}.Validate())
+	assert.Error(t, WriterConf{Type: "kafka"}.Validate())
+}
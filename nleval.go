@@ -0,0 +1,146 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/czcorpus/cqlizer/ai"
+	"github.com/czcorpus/cqlizer/ai/examples"
+	"github.com/czcorpus/cqlizer/ai/nleval"
+	"github.com/czcorpus/cqlizer/ai/prompts"
+	"github.com/czcorpus/cqlizer/apiserver"
+	"github.com/czcorpus/cqlizer/cnf"
+	"github.com/rs/zerolog/log"
+)
+
+// initCQLTranslator creates the NL -> CQL translator
+// along with its corpus info provider
+func initCQLTranslator(conf *cnf.Conf) (*ai.CQLTranslator, *ai.CorpInfoProvider, error) {
+	sysprompt, err := os.ReadFile(conf.AI.SystemPromptFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load system prompt: %w", err)
+	}
+	var promptStore *prompts.Store
+	if conf.AI.CustomSystemPromptsDir != "" {
+		promptStore, err = prompts.NewStore(conf.AI.CustomSystemPromptsDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize prompt store: %w", err)
+		}
+
+	} else {
+		log.Warn().Msg("ai.customSystemPromptsDir not set, prompt versioning will not be available")
+	}
+	corpusInfo := ai.NewCorpInfoProvider(conf.AI.CorporaRegistryDir)
+	if conf.AI.PreloadRegistries {
+		numLoaded, err := corpusInfo.Preload()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to preload corpora registries: %w", err)
+		}
+		log.Info().Int("numRegistries", numLoaded).Msg("preloaded corpora registries")
+	}
+	cqlTranslat, err := ai.NewCQLTRanslator(
+		conf.AI.Backends,
+		string(sysprompt),
+		promptStore,
+		corpusInfo,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize CQL translator: %w", err)
+	}
+	if conf.AI.ExamplesPath != "" {
+		exampleStore, err := examples.NewStore(conf.AI.ExamplesPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize example store: %w", err)
+		}
+		cqlTranslat.SetExampleStore(exampleStore, conf.AI.NumExamples)
+		log.Info().
+			Str("path", conf.AI.ExamplesPath).
+			Int("numExamples", conf.AI.NumExamples).
+			Msg("enabled few-shot examples")
+	}
+	return cqlTranslat, corpusInfo, nil
+}
+
+// runActionEvalNL evaluates NL -> CQL translation of a gold dataset
+// using one or more system prompts and prints a comparison report
+func runActionEvalNL(
+	ctx context.Context,
+	conf *cnf.Conf,
+	datasetPath string,
+	promptSpecs string,
+	backendName string,
+	reportPath string,
+	noCost bool,
+) {
+	cases, err := nleval.LoadDataset(datasetPath)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	translator, corpusInfo, err := initCQLTranslator(conf)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	if !noCost {
+		estimator, err := apiserver.NewCostEstimator(ctx, conf, corpusInfo)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to initialize query cost estimation")
+			return
+		}
+		if estimator != nil {
+			translator.SetCostEstimator(estimator, conf.AI.MaxRevisions)
+
+		} else {
+			log.Warn().Msg("no model enabled in rfEnsemble, query cost will not be estimated")
+		}
+	}
+	evalPrompts, err := nleval.ResolvePrompts(strings.Split(promptSpecs, ","), translator)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	log.Info().
+		Int("numCases", len(cases)).
+		Int("numPrompts", len(evalPrompts)).
+		Msg("running NL -> CQL evaluation")
+	report, err := nleval.Run(ctx, translator, evalPrompts, cases, backendName)
+	if err != nil {
+		log.Fatal().Err(err).Msg("evaluation failed")
+		return
+	}
+	if err := report.WriteText(os.Stdout); err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	if reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatal().Err(err).Send()
+			return
+		}
+		if err := os.WriteFile(reportPath, data, 0644); err != nil {
+			log.Fatal().Err(err).Msg("failed to write report")
+			return
+		}
+		log.Info().Str("path", reportPath).Msg("report written")
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/czcorpus/cqlizer/ai/prompts"
+	"github.com/czcorpus/cqlizer/cnf"
+	"github.com/rs/zerolog/log"
+)
+
+// runActionActivatePrompt sets the active system prompt in the prompt store.
+// A running server picks the change up after restart (for an immediate change,
+// use the /nl-to-cql/activate-prompt endpoint).
+func runActionActivatePrompt(conf *cnf.Conf, name string, version int, reset bool) {
+	store, err := prompts.NewStore(conf.AI.CustomSystemPromptsDir)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	if reset {
+		if err := store.ClearActive(); err != nil {
+			log.Fatal().Err(err).Send()
+			return
+		}
+		fmt.Println("active prompt cleared, the default system prompt will be used")
+		return
+	}
+	if name == "" {
+		log.Fatal().Msg("missing prompt name")
+		return
+	}
+	active, err := store.SetActive(name, version, "cli")
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	fmt.Printf("activated prompt %s@v%d\n", active.Name, active.Version)
+}
@@ -0,0 +1,263 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/czcorpus/cqlizer/apiserver"
+	"github.com/czcorpus/cqlizer/cnf"
+	"github.com/czcorpus/cqlizer/eval"
+	"github.com/czcorpus/cqlizer/eval/feats"
+	"github.com/czcorpus/cqlizer/eval/manifest"
+	"github.com/czcorpus/cqlizer/eval/nn"
+	"github.com/czcorpus/cqlizer/eval/rf"
+	"github.com/czcorpus/cqlizer/feedback"
+	"github.com/rs/zerolog/log"
+)
+
+// newModelLike creates an untrained model with the same
+// hyperparameters as the `model`
+func newModelLike(model eval.MLModel, seed uint64, singleThreaded bool) (eval.MLModel, error) {
+	switch tModel := model.(type) {
+	case *rf.Model:
+		ans := rf.NewModel(tModel.NumTrees, tModel.VotingThreshold, seed)
+		ans.SingleThreaded = singleThreaded
+		return ans, nil
+	case *nn.Model:
+		ans := nn.NewModel(seed)
+		ans.Layout = slices.Clone(tModel.Layout)
+		if tModel.NumEpochs > 0 {
+			ans.NumEpochs = tModel.NumEpochs
+		}
+		if tModel.LearningRate > 0 {
+			ans.LearningRate = tModel.LearningRate
+		}
+		return ans, nil
+	}
+	return nil, fmt.Errorf("model %T cannot be retrained (only rf and nn models are supported)", model)
+}
+
+// loadFeedback converts feedback records into deduplicated evaluations
+func loadFeedback(conf *cnf.Conf, path string) (*eval.Predictor, error) {
+	records, err := feedback.ReadAll(path)
+	if err != nil {
+		return nil, err
+	}
+	predictor := eval.NewPredictor(nil, conf)
+	var numFailed int
+	for _, rec := range records {
+		if err := predictor.ProcessEntry(rec.AsStatsRecord()); err != nil {
+			log.Warn().Err(err).Str("query", rec.Query).Msg("skipping feedback record")
+			numFailed++
+		}
+	}
+	predictor.SetStats(len(records), numFailed)
+	if len(predictor.Evaluations) == 0 {
+		return nil, fmt.Errorf("no usable feedback records found in %s", path)
+	}
+	predictor.Deduplicate(eval.DedupConf{}.WithDefaults())
+	return predictor, nil
+}
+
+func bestMetrics(items []manifest.Metrics) manifest.Metrics {
+	var mf manifest.Manifest
+	for _, item := range items {
+		mf.AddMetrics(item)
+	}
+	if mf.BestMetrics == nil {
+		return manifest.Metrics{}
+	}
+	return *mf.BestMetrics
+}
+
+// candidateModelPath creates a path for a retrained model next to the current one
+func candidateModelPath(modelPath string) string {
+	modelPath = strings.TrimSuffix(strings.TrimSuffix(modelPath, ".gz"), ".gzip")
+	ext := filepath.Ext(modelPath)
+	return fmt.Sprintf("%s.candidate-%s%s", strings.TrimSuffix(modelPath, ext), time.Now().Format("20060102T150405"), ext)
+}
+
+// promoteModel replaces the current model by the candidate one.
+// The current model file is kept as a backup.
+func promoteModel(modelPath, candidatePath string) error {
+	if strings.HasSuffix(modelPath, ".gz") || strings.HasSuffix(modelPath, ".gzip") {
+		return fmt.Errorf("cannot replace compressed model file %s, please replace it manually", modelPath)
+	}
+	backupPath := fmt.Sprintf("%s.%s.bak", modelPath, time.Now().Format("20060102T150405"))
+	if err := os.Rename(modelPath, backupPath); err != nil {
+		return fmt.Errorf("failed to back up current model: %w", err)
+	}
+	if err := os.Rename(candidatePath, modelPath); err != nil {
+		return fmt.Errorf("failed to replace current model: %w", err)
+	}
+	log.Info().Str("backup", backupPath).Msg("current model backed up")
+	return nil
+}
+
+func runActionRetrain(
+	conf *cnf.Conf,
+	featsPath string,
+	feedbackPath string,
+	modelType string,
+	modelPath string,
+	holdoutRatio float64,
+	minImprovement float64,
+	balanceConf eval.BalanceConf,
+	singleThreaded bool,
+	ver apiserver.VersionInfo,
+) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if holdoutRatio <= 0 || holdoutRatio >= 1 {
+		log.Fatal().Float64("holdout", holdoutRatio).Msg("invalid holdout ratio (expected value between 0 and 1)")
+		return
+	}
+	balanceConf = balanceConf.WithDefaults()
+	if err := balanceConf.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid balancing settings")
+		return
+	}
+	if balanceConf.Strategy == eval.BalanceClassWeights {
+		log.Fatal().Msg("class weights balancing is not supported for retraining")
+		return
+	}
+	if modelType == "" {
+		modelType = eval.InferModelType(modelPath)
+	}
+	currModel, err := eval.GetMLModel(modelType, modelPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load the ML model")
+		return
+	}
+	thr := currModel.GetThreshold()
+	if !thr.IsResolved() {
+		log.Fatal().Msg("current model does not contain slow query threshold, cannot retrain it")
+		return
+	}
+	newModel, err := newModelLike(currModel, balanceConf.Seed, singleThreaded)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+
+	predictor, err := loadFeatures(conf, nil, featsPath)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	fbPredictor, err := loadFeedback(conf, feedbackPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load feedback")
+		return
+	}
+	// we evaluate both models on feedback data not seen by the new model
+	fbTrain, fbHoldout := eval.SplitHoldout(fbPredictor.Evaluations, holdoutRatio, thr.IsSlow, balanceConf.Seed)
+	if len(fbHoldout) == 0 {
+		log.Fatal().Msg("not enough feedback data for evaluation")
+		return
+	}
+	trainData := make([]feats.QueryEvaluation, 0, len(predictor.Evaluations)+len(fbTrain))
+	trainData = append(trainData, predictor.Evaluations...)
+	trainData = append(trainData, fbTrain...)
+	trainData, numPos, numNeg := balanceConf.Balance(trainData, thr.IsSlow)
+	log.Info().
+		Int("featuresSize", len(predictor.Evaluations)).
+		Int("feedbackTrainSize", len(fbTrain)).
+		Int("feedbackHoldoutSize", len(fbHoldout)).
+		Int("positiveExamples", numPos).
+		Int("negativeExamples", numNeg).
+		Msg("prepared data for retraining")
+
+	if err := newModel.Train(ctx, trainData, thr, fbPredictor.LearningDataStats.AsComment()); err != nil {
+		log.Fatal().Err(err).Msg("failed to train new model")
+		return
+	}
+
+	currMetrics := eval.EvaluateModel(currModel, fbHoldout, thr)
+	newMetrics := eval.EvaluateModel(newModel, fbHoldout, thr)
+	currBest := bestMetrics(currMetrics)
+	newBest := bestMetrics(newMetrics)
+
+	featsHash, err := manifest.FileSHA256(featsPath)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	feedbackHash, err := manifest.FileSHA256(feedbackPath)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	mf := manifest.Manifest{
+		ModelType:      modelType,
+		TrainedAt:      time.Now().Format(time.RFC3339),
+		FeaturesFile:   filepath.Base(featsPath),
+		FeaturesSHA256: featsHash,
+		FeedbackFile:   filepath.Base(feedbackPath),
+		FeedbackSHA256: feedbackHash,
+		ParentModel:    filepath.Base(modelPath),
+		Seed:           balanceConf.Seed,
+		Hyperparams:    newModel.GetHyperparams(),
+		Threshold:      thr,
+		Balancing:      fmt.Sprintf("%s (neg/pos ratio: %.2f)", balanceConf.Strategy, balanceConf.NegPosRatio),
+		DataStats:      fbPredictor.LearningDataStats.AsComment(),
+		TrainingSize:   len(trainData),
+		TestSize:       len(fbHoldout),
+		Version:        ver.Version,
+		BuildDate:      ver.BuildDate,
+		GitCommit:      ver.GitCommit,
+	}
+	for _, m := range newMetrics {
+		mf.AddMetrics(m)
+	}
+	newModel.SetManifest(mf)
+	candidatePath := candidateModelPath(modelPath)
+	if err := newModel.SaveToFile(candidatePath); err != nil {
+		log.Fatal().Err(err).Msg("failed to save new model")
+		return
+	}
+
+	fmt.Printf(
+		"current model: F-beta %.4f (precision %.4f, recall %.4f, vote %.2f)\n",
+		currBest.FBeta, currBest.Precision, currBest.Recall, currBest.VoteThreshold,
+	)
+	fmt.Printf(
+		"new model:     F-beta %.4f (precision %.4f, recall %.4f, vote %.2f)\n",
+		newBest.FBeta, newBest.Precision, newBest.Recall, newBest.VoteThreshold,
+	)
+	if newBest.FBeta <= currBest.FBeta+minImprovement {
+		log.Warn().
+			Str("candidate", candidatePath).
+			Msg("new model does not improve metrics, keeping the current one")
+		return
+	}
+	if err := promoteModel(modelPath, candidatePath); err != nil {
+		log.Error().Err(err).Str("candidate", candidatePath).Msg("failed to promote new model")
+		os.Exit(1)
+	}
+	log.Info().Str("path", modelPath).Msg("new model promoted")
+}
@@ -19,8 +19,11 @@
 """Train LightGBM model for CQL query performance classification."""
 
 import argparse
+import csv
+import itertools
 import json
 import os
+import random
 
 import lightgbm as lgb
 import msgpack
@@ -29,33 +32,63 @@ from sklearn.metrics import auc, classification_report, precision_recall_curve
 from sklearn.model_selection import train_test_split
 
 
-def load_msgpack_features(path: str) -> tuple[np.ndarray, np.ndarray]:
+def load_msgpack_features(path: str) -> tuple[np.ndarray, np.ndarray, np.ndarray, dict, bool, dict]:
     """Load features from msgpack file.
 
     Adjust unpacking based on your actual msgpack structure.
+    Older feature files come without sample weights - in such
+    case, all the samples have weight 1.
+    The returned dict is the slow query threshold definition used
+    to label the data. It is stored in model metadata so the model
+    is always evaluated using the same definition.
+    The returned bool specifies whether the sample weights already
+    compensate for class imbalance.
+    The last returned dict is the training manifest (seed, features
+    file hash, build info etc.) which is completed here and stored
+    in the model metadata.
     """
     with open(path, "rb") as f:
         data = msgpack.unpack(f)
     X = np.array([item for item in data["features"]])
     y = np.array([item for item in data["label"]])
-    return X, y
+    w = data.get("weight")
+    if w is None:
+        w = np.ones(len(y))
+    else:
+        w = np.array(w)
+    return (
+        X,
+        y,
+        w,
+        data.get("threshold", {}),
+        data.get("classWeighted", False),
+        data.get("manifest", {}),
+    )
 
 
-def train_model(X: np.ndarray, y: np.ndarray, output_path: str):
-    """Train LightGBM and save model."""
+# Hyperparameter candidates used with --tune
+SEARCH_SPACE = {
+    "num_leaves": [31, 63, 81, 127],
+    "max_depth": [4, 6, 8],
+    "learning_rate": [0.03, 0.05, 0.1],
+    "min_child_samples": [10, 20, 40],
+}
 
-    X_train, X_test, y_train, y_test = train_test_split(
-        X, y, test_size=0.2, random_state=42, stratify=y
-    )
 
+def get_seed(manifest: dict) -> int:
+    # LightGBM and sklearn accept only 32-bit seeds
+    return manifest.get("seed", 42) % 2**31
+
+
+def base_params(y: np.ndarray, class_weighted: bool, seed: int) -> dict:
     # Calculate scale_pos_weight for class imbalance (your 1-5% slow queries)
-    neg_count = np.sum(y_train == 0)
-    pos_count = np.sum(y_train == 1)
-    scale_pos_weight = neg_count / pos_count
+    neg_count = np.sum(y == 0)
+    pos_count = np.sum(y == 1)
+    scale_pos_weight = 1.0 if class_weighted else neg_count / pos_count
 
     print(f"Scale pos weight: {scale_pos_weight:.2f}")
 
-    params = {
+    return {
         "objective": "binary",
         "metric": ["auc", "binary_logloss"],
         "scale_pos_weight": scale_pos_weight,
@@ -65,12 +98,91 @@ def train_model(X: np.ndarray, y: np.ndarray, output_path: str):
         "min_child_samples": 20,
         "subsample": 0.8,
         "colsample_bytree": 0.8,
-        "random_state": 42,
+        "random_state": seed,
         "verbose": -1,
     }
 
-    train_data = lgb.Dataset(X_train, label=y_train)
-    valid_data = lgb.Dataset(X_test, label=y_test, reference=train_data)
+
+def tune_params(
+    X: np.ndarray,
+    y: np.ndarray,
+    w: np.ndarray,
+    class_weighted: bool,
+    manifest: dict,
+    search: str,
+    num_trials: int,
+    num_folds: int,
+    leaderboard_path: str,
+) -> dict | None:
+    """Search hyperparameters using cross-validation (metric: average precision).
+
+    The leaderboard is written even if the search is interrupted (SIGINT).
+    In such case, None is returned.
+    """
+    seed = get_seed(manifest)
+    keys = sorted(SEARCH_SPACE.keys())
+    candidates = [dict(zip(keys, values)) for values in itertools.product(*(SEARCH_SPACE[k] for k in keys))]
+    if search == "random" and num_trials < len(candidates):
+        candidates = random.Random(seed).sample(candidates, num_trials)
+    params = base_params(y, class_weighted, seed)
+    params["metric"] = "average_precision"
+    leaderboard = []
+    interrupted = False
+    try:
+        for i, cand in enumerate(candidates):
+            print(f"Trial {i + 1}/{len(candidates)}: {cand}")
+            res = lgb.cv(
+                dict(params, **cand),
+                lgb.Dataset(X, label=y, weight=w),
+                num_boost_round=200,
+                nfold=num_folds,
+                stratified=True,
+                seed=seed,
+                callbacks=[lgb.early_stopping(stopping_rounds=20, verbose=False)],
+            )
+            mean_key = next(k for k in res if k.endswith("average_precision-mean"))
+            std_key = next(k for k in res if k.endswith("average_precision-stdv"))
+            leaderboard.append((res[mean_key][-1], res[std_key][-1], len(res[mean_key]), cand))
+    except KeyboardInterrupt:
+        print("Search interrupted, writing partial leaderboard")
+        interrupted = True
+
+    leaderboard.sort(key=lambda x: x[0], reverse=True)
+    with open(leaderboard_path, "w", newline="") as fw:
+        writer = csv.writer(fw, delimiter=";")
+        writer.writerow(["rank", "params", "pr-auc", "pr-auc-stddev", "boost-rounds"])
+        for rank, (score, std, rounds, cand) in enumerate(leaderboard, 1):
+            writer.writerow([rank, json.dumps(cand), f"{score:.4f}", f"{std:.4f}", rounds])
+    print(f"Leaderboard saved to: {leaderboard_path}")
+    if interrupted or len(leaderboard) == 0:
+        return None
+    return leaderboard[0][3]
+
+
+def train_model(
+    X: np.ndarray,
+    y: np.ndarray,
+    w: np.ndarray,
+    threshold: dict,
+    class_weighted: bool,
+    manifest: dict,
+    output_path: str,
+    overrides: dict | None = None,
+):
+    """Train LightGBM and save model.
+
+    The `overrides` (if any) replace default hyperparameters.
+    """
+    seed = get_seed(manifest)
+
+    X_train, X_test, y_train, y_test, w_train, w_test = train_test_split(
+        X, y, w, test_size=0.2, random_state=seed, stratify=y
+    )
+
+    params = dict(base_params(y_train, class_weighted, seed), **(overrides or {}))
+
+    train_data = lgb.Dataset(X_train, label=y_train, weight=w_train)
+    valid_data = lgb.Dataset(X_test, label=y_test, weight=w_test, reference=train_data)
 
     model = lgb.train(
         params,
@@ -109,7 +221,13 @@ def train_model(X: np.ndarray, y: np.ndarray, output_path: str):
     print(f"Best iteration: {model.best_iteration}")
 
     with open(os.path.splitext(output_path)[0] + ".metadata.json", "w") as fw:
-        json.dump(params, fw)
+        manifest = dict(
+            manifest,
+            hyperparams=dict(params, num_boost_round=200, best_iteration=model.best_iteration),
+            testSize=len(y_test),
+            prAuc=pr_auc,
+        )
+        json.dump(dict(params, threshold=threshold, manifest=manifest), fw)
 
 
 if __name__ == "__main__":
@@ -123,11 +241,31 @@ if __name__ == "__main__":
         default="model.txt",
         help="Output model path (.txt for leaves compatibility)",
     )
+    parser.add_argument(
+        "--tune",
+        choices=["grid", "random"],
+        help="Search hyperparameters using cross-validation and train the best model",
+    )
+    parser.add_argument("--trials", type=int, default=10, help="Number of trials for the random search")
+    parser.add_argument("--folds", type=int, default=5, help="Number of cross-validation folds")
+    parser.add_argument(
+        "--leaderboard",
+        default="leaderboard.csv",
+        help="Output path of the tuning leaderboard (CSV)",
+    )
     args = parser.parse_args()
 
-    X, y = load_msgpack_features(args.input)
+    X, y, w, threshold, class_weighted, manifest = load_msgpack_features(args.input)
     print(f"Loaded {len(X)} samples, {X.shape[1]} features")
     print(
         f"Class distribution: {np.sum(y == 0)} normal, {np.sum(y == 1)} slow ({100 * np.mean(y):.2f}% positive)"
     )
-    train_model(X, y, args.output)
+    overrides = None
+    if args.tune:
+        overrides = tune_params(
+            X, y, w, class_weighted, manifest, args.tune, args.trials, args.folds, args.leaderboard
+        )
+        if overrides is None:
+            raise SystemExit(1)
+        print(f"Best hyperparameters: {overrides}")
+    train_model(X, y, w, threshold, class_weighted, manifest, args.output, overrides)
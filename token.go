@@ -0,0 +1,51 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/cqlizer/auth"
+	"github.com/czcorpus/cqlizer/cnf"
+	"github.com/rs/zerolog/log"
+)
+
+func runActionIssueToken(conf *cnf.Conf, name, scopes string, ttl time.Duration) {
+	if conf.Auth == nil || conf.Auth.HMACSecret == "" {
+		log.Fatal().Msg("auth.hmacSecret not configured, cannot issue tokens")
+		return
+	}
+	if name == "" {
+		log.Fatal().Msg("missing token subject name")
+		return
+	}
+	claims := auth.Claims{
+		Subject: name,
+		Scopes:  strings.Split(scopes, ","),
+	}
+	if ttl > 0 {
+		claims.ExpiresAt = time.Now().Add(ttl).Unix()
+	}
+	token, err := auth.IssueToken(conf.Auth.HMACSecret, claims)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	fmt.Println(token)
+}
@@ -0,0 +1,200 @@
+// Copyright 2025 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2025 Department of Linguistics,
+// Faculty of Arts, Charles University
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/czcorpus/cqlizer/apiserver"
+	"github.com/czcorpus/cqlizer/cnf"
+	"github.com/czcorpus/cqlizer/eval"
+	"github.com/czcorpus/cqlizer/eval/modutils"
+	"github.com/czcorpus/cqlizer/eval/threshold"
+	"github.com/czcorpus/cqlizer/eval/tune"
+	"github.com/czcorpus/cqlizer/eval/xg"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// pythonStopTimeout specifies how long we wait for the learning
+	// script to write its partial results after being interrupted
+	pythonStopTimeout = 30 * time.Second
+)
+
+func writeLeaderboard(lb tune.Leaderboard, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write leaderboard: %w", err)
+	}
+	defer f.Close()
+	if err := lb.WriteCSV(f); err != nil {
+		return fmt.Errorf("failed to write leaderboard: %w", err)
+	}
+	return nil
+}
+
+// tuneXGModel prepares training data and runs the learning script
+// in the tuning mode (the actual training of XGBoost happens in Python).
+func tuneXGModel(
+	ctx context.Context,
+	conf *cnf.Conf,
+	srcPath string,
+	thrDef threshold.Definition,
+	balanceConf eval.BalanceConf,
+	tuneConf tune.Conf,
+	leaderboardPath string,
+	ver apiserver.VersionInfo,
+) error {
+	mlModel := xg.NewModel()
+	if err := trainAndSaveModel(ctx, conf, srcPath, "xg", mlModel, thrDef, balanceConf, "", ver); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(
+		ctx,
+		"python3", "-c", learnXGBScript,
+		"--input", mlModel.CreateModelFileName(srcPath),
+		"--output", modutils.ExtractModelNameBaseFromFeatFile(srcPath)+".model.xg.txt",
+		"--tune", tuneConf.Search,
+		"--trials", strconv.Itoa(tuneConf.NumTrials),
+		"--folds", strconv.Itoa(tuneConf.NumFolds),
+		"--leaderboard", leaderboardPath,
+	)
+	// let the script write partial leaderboard on interruption
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = pythonStopTimeout
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("learning script failed: %w", err)
+	}
+	return nil
+}
+
+func runActionTune(
+	conf *cnf.Conf,
+	srcPath string,
+	modelType string,
+	spacePath string,
+	thresholdSpec string,
+	balanceConf eval.BalanceConf,
+	tuneConf tune.Conf,
+	singleThreaded bool,
+	ver apiserver.VersionInfo,
+) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	thrDef, err := threshold.ParseSpec(thresholdSpec)
+	if err != nil {
+		log.Fatal().Err(err).Msg("invalid slow query threshold specification")
+		return
+	}
+	balanceConf = balanceConf.WithDefaults()
+	if err := balanceConf.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid balancing settings")
+		return
+	}
+	tuneConf = tuneConf.WithDefaults()
+	if err := tuneConf.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid tuning settings")
+		return
+	}
+	leaderboardPath := fmt.Sprintf(
+		"%s.tune.%s.csv", modutils.ExtractModelNameBaseFromFeatFile(srcPath), modelType)
+
+	if modelType == "xg" {
+		if spacePath != "" {
+			log.Warn().Msg("custom search space is not supported for the xg model, using the one from the learning script")
+		}
+		err := tuneXGModel(ctx, conf, srcPath, thrDef, balanceConf, tuneConf, leaderboardPath, ver)
+		if errors.Is(err, context.Canceled) {
+			log.Warn().Msg("tuning interrupted")
+			return
+
+		} else if err != nil {
+			log.Fatal().Err(err).Msg("failed to tune model")
+		}
+		return
+	}
+
+	space := tune.DefaultSpace(modelType)
+	if space == nil {
+		log.Fatal().Str("modelType", modelType).Msg("model cannot be tuned")
+		return
+	}
+	if spacePath != "" {
+		space, err = tune.LoadSpace(spacePath)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to load search space")
+			return
+		}
+	}
+
+	predictor, err := loadFeatures(conf, nil, srcPath)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	if err := predictor.ResolveThreshold(thrDef); err != nil {
+		log.Fatal().Err(err).Msg("failed to determine slow query threshold")
+		return
+	}
+	lb, searchErr := tune.Run(ctx, predictor, modelType, space, tuneConf, balanceConf, singleThreaded)
+	if err := writeLeaderboard(lb, leaderboardPath); err != nil {
+		log.Fatal().Err(err).Send()
+		return
+	}
+	log.Info().Str("path", leaderboardPath).Int("numTrials", len(lb)).Msg("saved leaderboard")
+	if errors.Is(searchErr, context.Canceled) {
+		log.Warn().Msg("tuning interrupted, no model will be trained")
+		return
+	}
+	best, ok := lb.Best()
+	if !ok {
+		log.Fatal().Msg("no successful trial, no model will be trained")
+		return
+	}
+	log.Info().
+		Str("params", best.Params.String()).
+		Float64("fBeta", best.Result.MeanFBeta).
+		Msg("training model with the best hyperparameters")
+
+	mlModel, err := tune.NewModel(modelType, best.Params, balanceConf.Seed, singleThreaded)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create model")
+		return
+	}
+	mlModel.SetClassThreshold(best.Result.VoteThreshold)
+	if err := trainAndSaveModel(
+		ctx, conf, srcPath, modelType, mlModel, thrDef, balanceConf, "", ver,
+	); err != nil {
+		log.Fatal().Err(err).Msg("failed to train model")
+	}
+}